@@ -0,0 +1,145 @@
+// Package app holds the application container, the dependencies shared by the
+// handlers. It is built once in main and passed to routes.NewRouter.
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wangfenjin/mojito/common"
+	"github.com/wangfenjin/mojito/email"
+	"github.com/wangfenjin/mojito/middleware"
+	"github.com/wangfenjin/mojito/models"
+	"github.com/wangfenjin/mojito/models/migrations"
+	"github.com/wangfenjin/mojito/outbox"
+)
+
+type contextKey struct{}
+
+// App is the application container. Users and Items default to Store and can
+// be replaced with fakes in tests. Dispatcher is nil when this instance doesn't
+// deliver the outbox, Migrator is nil unless Store is a PostgreSQL database.
+type App struct {
+	Config     *common.Config
+	Store      models.Store
+	Users      models.UserRepository
+	Items      models.ItemRepository
+	Tokens     *common.TokenService
+	Passwords  common.PasswordPolicy
+	Sender     *email.Sender
+	Dispatcher *outbox.Dispatcher
+	Migrator   *migrations.Migrator
+	Binder     *middleware.Binder
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// New creates an application container on top of store
+func New(cfg *common.Config, store models.Store, tokens *common.TokenService, sender *email.Sender) *App {
+	return &App{
+		Config:    cfg,
+		Store:     store,
+		Users:     store,
+		Items:     store,
+		Tokens:    tokens,
+		Passwords: common.NewPasswordPolicy(cfg.Auth),
+		Sender:    sender,
+		Binder:    newBinder(cfg.Server),
+		stop:      make(chan struct{}),
+	}
+}
+
+// newBinder creates the request binder with the body and upload limits of cfg, given in MB
+func newBinder(cfg common.ServerConfig) *middleware.Binder {
+	binder := middleware.NewBinder()
+	if cfg.MaxBodySize > 0 {
+		binder.MaxBodyBytes = int64(cfg.MaxBodySize) << 20
+	}
+	if cfg.MaxUploadSize > 0 {
+		binder.MaxFileSize = int64(cfg.MaxUploadSize) << 20
+	}
+	return binder
+}
+
+// Build creates the application main runs on top of store: it initializes token
+// signing, loads the email templates and the migrations
+// of a database store and, when the outbox is enabled, creates the dispatcher
+// delivering through mailer, which Run starts.
+func Build(cfg *common.Config, store models.Store, mailer email.Mailer, logger *slog.Logger) (*App, error) {
+	tokens, err := common.NewTokenService(cfg.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize token service: %w", err)
+	}
+
+	templates, err := email.NewTemplates(cfg.Email.DefaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load email templates: %w", err)
+	}
+	sender := email.NewSender(mailer, templates, cfg.Server.FrontendHost, cfg.Email.FromName)
+
+	a := New(cfg, store, tokens, sender)
+	if db, ok := store.(*models.DB); ok {
+		if a.Migrator, err = migrations.New(db.Pool, logger); err != nil {
+			return nil, fmt.Errorf("failed to load migrations: %w", err)
+		}
+	}
+	if cfg.Outbox.Enabled {
+		a.Dispatcher = newDispatcher(cfg.Outbox, store, mailer, logger)
+	}
+	return a, nil
+}
+
+// newDispatcher creates an outbox dispatcher with the email sink and, when configured, the webhook sink
+func newDispatcher(cfg common.OutboxConfig, store models.Store, mailer email.Mailer, logger *slog.Logger) *outbox.Dispatcher {
+	dispatcher := outbox.NewDispatcher(store, outbox.Options{
+		PollInterval: time.Duration(cfg.PollInterval) * time.Second,
+		BatchSize:    cfg.BatchSize,
+		MaxAttempts:  cfg.MaxAttempts,
+		BaseBackoff:  time.Duration(cfg.BaseBackoff) * time.Second,
+		MaxBackoff:   time.Duration(cfg.MaxBackoff) * time.Second,
+		Lease:        time.Duration(cfg.Lease) * time.Second,
+		Retention:    time.Duration(cfg.Retention) * time.Second,
+	}, logger)
+	dispatcher.Register(outbox.TopicEmail, &outbox.EmailSink{Mailer: mailer})
+	if cfg.WebhookURL != "" {
+		dispatcher.Register(outbox.TopicWebhook, outbox.NewWebhookSink(
+			cfg.WebhookURL, cfg.WebhookSecret, time.Duration(cfg.WebhookTimeout)*time.Second))
+	}
+	return dispatcher
+}
+
+// RequireAuth creates middleware that requires authentication against this application
+func (a *App) RequireAuth() func(http.Handler) http.Handler {
+	return middleware.RequireAuth(a.Tokens, a.Users)
+}
+
+// Inject creates middleware that makes a available to handlers through From
+// and has them bind requests with its Binder
+func Inject(a *App) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := middleware.NewBinderContext(NewContext(r.Context(), a), a.Binder)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// NewContext returns a copy of ctx carrying a
+func NewContext(ctx context.Context, a *App) context.Context {
+	return context.WithValue(ctx, contextKey{}, a)
+}
+
+// From returns the application stored in ctx.
+// It panics if the request didn't pass through Inject.
+func From(ctx context.Context) *App {
+	a, ok := ctx.Value(contextKey{}).(*App)
+	if !ok {
+		panic("application is missing from the context. Mount the routes with routes.RegisterRoutes.")
+	}
+	return a
+}
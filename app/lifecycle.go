@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Stop asks Run to shut the application down gracefully. It returns immediately
+// and may be called more than once.
+func (a *App) Stop() {
+	a.stopOnce.Do(func() { close(a.stop) })
+}
+
+// Stopping returns a channel that is closed once shutdown has been requested,
+// by Stop or by the context of Run
+func (a *App) Stopping() <-chan struct{} {
+	return a.stop
+}
+
+// Run serves srv and delivers the outbox until ctx is canceled, Stop is called
+// or the server fails. It then shuts down in order: the server keeps serving for
+// ServerConfig.ShutdownDelay while /readyz reports it isn't ready, stops accepting
+// connections and drains in-flight requests within ServerConfig.ShutdownTimeout,
+// the dispatcher finishes its batch, and the store is closed last.
+func (a *App) Run(ctx context.Context, srv *http.Server, logger *slog.Logger) error {
+	var workers sync.WaitGroup
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	if a.Dispatcher != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			a.Dispatcher.Run(workersCtx)
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	logger.Info("Starting server on " + srv.Addr)
+
+	var err error
+	select {
+	case <-ctx.Done():
+		logger.Info("Shutdown signal received")
+	case <-a.stop:
+		logger.Info("Shutdown requested")
+	case err = <-serveErr:
+		logger.Error("Server failed", "error", err)
+	}
+	a.Stop()
+
+	// Give load balancers time to see the failing readiness probe before connections are refused
+	if delay := time.Duration(a.Config.Server.ShutdownDelay) * time.Second; delay > 0 && err == nil {
+		logger.Info("Waiting before draining requests", "delay", delay)
+		time.Sleep(delay)
+	}
+
+	// Drain in-flight requests, connections still open after the timeout are closed
+	shutdownCtx := context.Background()
+	if timeout := time.Duration(a.Config.Server.ShutdownTimeout) * time.Second; timeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, timeout)
+		defer cancel()
+	}
+	if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+		logger.Warn("Requests didn't finish in time, closing their connections", "error", shutdownErr)
+		srv.Close()
+	}
+
+	stopWorkers()
+	workers.Wait()
+
+	if closer, ok := a.Store.(interface{ Close() }); ok {
+		closer.Close()
+	}
+	logger.Info("Server stopped")
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package app_test
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/wangfenjin/mojito/common"
+	"github.com/wangfenjin/mojito/testutil"
+)
+
+func TestRunShutdownDelay(t *testing.T) {
+	s := testutil.New(t, testutil.Options{Configure: func(cfg *common.Config) {
+		cfg.Server.ShutdownDelay = 1
+	}})
+
+	// Serve the application on a free port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	srv := &http.Server{Addr: addr, Handler: s.Config.Handler}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.App.Run(context.Background(), srv, slog.New(slog.DiscardHandler))
+	}()
+
+	readyz := func() int {
+		resp, err := http.Get("http://" + addr + "/readyz")
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for deadline := time.Now().Add(5 * time.Second); readyz() != http.StatusOK; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("server didn't become ready")
+		}
+	}
+
+	// Requests are still served during the delay, the server reports it isn't ready
+	start := time.Now()
+	s.App.Stop()
+	if status := readyz(); status != http.StatusServiceUnavailable {
+		t.Errorf("readyz during the shutdown delay = %d, want 503", status)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("Run() returned after %v, want the 1s shutdown delay", elapsed)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run() didn't return")
+	}
+	if status := readyz(); status != 0 {
+		t.Errorf("readyz after shutdown = %d, want the connection to be refused", status)
+	}
+}
@@ -2,18 +2,24 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/cors"
 	"github.com/go-chi/httplog/v2"
+	"github.com/wangfenjin/mojito/app"
 	"github.com/wangfenjin/mojito/common"
+	"github.com/wangfenjin/mojito/email"
 	"github.com/wangfenjin/mojito/models"
+	"github.com/wangfenjin/mojito/models/memory"
+	"github.com/wangfenjin/mojito/models/migrations"
 	"github.com/wangfenjin/mojito/routes"
 )
 
@@ -44,10 +50,63 @@ func main() {
 		// SourceFieldName: "source",
 	})
 
+	// Subcommands, the server runs when there is none
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			if err := runMigrate(cfg, logger.Logger, os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "openapi":
+			if err := runOpenAPI(cfg, logger, os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		default:
+			log.Fatalf("unknown command %q, expected migrate or openapi", os.Args[1])
+		}
+	}
+
 	logger.Info("Configuration loaded", "config", cfg)
 
+	// Initialize email delivery
+	mailer, err := email.New(cfg.Email)
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
 	// Initialize database connection
-	_, err = models.Connect(models.ConnectionParams{
+	store, err := openStore(cfg, logger.Logger)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	application, err := app.Build(cfg, store, mailer, logger.Logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:           routes.NewRouter(application, logger),
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout) * time.Second,
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout) * time.Second,
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout) * time.Second,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+
+	// Serve until SIGINT or SIGTERM, then shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := application.Run(ctx, srv, logger.Logger); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// databaseParams returns the connection parameters for the configured database
+func databaseParams(cfg *common.Config) models.ConnectionParams {
+	return models.ConnectionParams{
 		Host:     cfg.Database.Host,
 		Port:     cfg.Database.Port,
 		User:     cfg.Database.User,
@@ -55,37 +114,39 @@ func main() {
 		DBName:   cfg.Database.Name,
 		SSLMode:  cfg.Database.SSLMode,
 		TimeZone: cfg.Database.TimeZone,
-	})
-	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
-	}
-
-	// Create Chi router
-	r := chi.NewRouter()
 
-	// Add middleware
-	r.Use(httplog.RequestLogger(logger))
-	// r.Use(middleware.Heartbeat("/ping"))
-
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   cfg.Server.AllowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
+		MaxConns:          cfg.Database.MaxConns,
+		MinConns:          cfg.Database.MinConns,
+		MaxConnLifetime:   time.Duration(cfg.Database.MaxConnLifetime) * time.Minute,
+		MaxConnIdleTime:   time.Duration(cfg.Database.MaxConnIdleTime) * time.Minute,
+		HealthCheckPeriod: time.Duration(cfg.Database.HealthCheckPeriod) * time.Second,
+		ConnectTimeout:    time.Duration(cfg.Database.ConnectTimeout) * time.Second,
+	}
+}
 
-	// Set up API routes
-	routes.RegisterRoutes(r)
-	if os.Getenv("ENV") != "production" {
-		routes.RegisterTestRoutes(r)
+// openStore opens the configured store and applies pending migrations when AutoMigrate is set
+func openStore(cfg *common.Config, logger *slog.Logger) (models.Store, error) {
+	switch cfg.Database.Driver {
+	case models.DriverMemory:
+		logger.Warn("Using the in-memory store, data is lost on exit")
+		return memory.New(), nil
+	case "", models.DriverPostgres:
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Database.Driver)
 	}
 
-	// Start the server
-	port := strconv.Itoa(cfg.Server.Port)
-	logger.Info("Starting server on :" + port)
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		panic(err)
+	db, err := models.Open(context.Background(), databaseParams(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Database.AutoMigrate {
+		migrator, err := migrations.New(db.Pool, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load migrations: %w", err)
+		}
+		if _, err := migrator.Up(context.Background(), 0); err != nil {
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
 	}
+	return db, nil
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/wangfenjin/mojito/common"
+	"github.com/wangfenjin/mojito/models"
+	"github.com/wangfenjin/mojito/models/migrations"
+)
+
+const migrateUsage = `usage: mojito migrate <command> [flags]
+
+commands:
+  up [-n N]              apply pending migrations, all of them by default
+  down [-n N]            roll back the last N migrations, 1 by default
+  status                 list migrations and when they were applied
+  create [-dir DIR] NAME write empty up and down files for a new migration`
+
+// runMigrate runs a migrate subcommand
+func runMigrate(cfg *common.Config, logger *slog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	cmd, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("migrate "+cmd, flag.ContinueOnError)
+	n := flags.Int("n", 0, "number of migrations")
+	dir := flags.String("dir", "models/migrations", "directory of the migration files")
+
+	switch cmd {
+	case "create":
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New("usage: mojito migrate create [-dir DIR] NAME")
+		}
+		up, down, err := migrations.Create(*dir, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Println("created", up)
+		fmt.Println("created", down)
+		return nil
+
+	case "up", "down", "status":
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", cmd, migrateUsage)
+	}
+
+	if cfg.Database.Driver == models.DriverMemory {
+		return errors.New("the memory store has no migrations")
+	}
+	ctx := context.Background()
+	db, err := models.Open(ctx, databaseParams(cfg))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := migrations.New(db.Pool, logger)
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "up":
+		done, err := migrator.Up(ctx, *n)
+		if len(done) == 0 && err == nil {
+			fmt.Println("no pending migrations")
+		}
+		return err
+
+	case "down":
+		_, err := migrator.Down(ctx, *n)
+		return err
+
+	default:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			name, applied := s.Name, "pending"
+			if name == "" {
+				name = "(unknown)"
+			}
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, name, applied)
+		}
+		return w.Flush()
+	}
+}
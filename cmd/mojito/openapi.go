@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/httplog/v2"
+	"github.com/wangfenjin/mojito/app"
+	"github.com/wangfenjin/mojito/common"
+	"github.com/wangfenjin/mojito/email"
+	"github.com/wangfenjin/mojito/models/memory"
+	"github.com/wangfenjin/mojito/openapi"
+	"github.com/wangfenjin/mojito/routes"
+)
+
+const openapiUsage = `usage: mojito openapi <command> [flags]
+
+commands:
+  export [-format json|yaml] [-o FILE]  write the spec, to stdout by default
+  diff [-base FILE]                     compare the spec with FILE, api/openapi.json by default,
+                                        and fail on breaking changes unless the major version changed.
+                                        FILE - reads stdin`
+
+// runOpenAPI runs an openapi subcommand
+func runOpenAPI(cfg *common.Config, logger *httplog.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(openapiUsage)
+	}
+	cmd, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("openapi "+cmd, flag.ContinueOnError)
+	format := flags.String("format", openapi.FormatJSON, "format of the spec, json or yaml")
+	out := flags.String("o", "", "file to write the spec to")
+	base := flags.String("base", "api/openapi.json", "spec to compare with, - reads stdin")
+
+	switch cmd {
+	case "export", "diff":
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown openapi command %q\n%s", cmd, openapiUsage)
+	}
+
+	doc, err := buildDocument(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	if cmd == "export" {
+		data, err := doc.Encode(*format)
+		if err != nil {
+			return err
+		}
+		if *out == "" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		return os.WriteFile(*out, data, 0o644)
+	}
+
+	var baseSpec []byte
+	if *base == "-" {
+		baseSpec, err = io.ReadAll(os.Stdin)
+	} else {
+		baseSpec, err = os.ReadFile(*base)
+	}
+	if err != nil {
+		return err
+	}
+	changes, err := openapi.Diff(baseSpec, doc.JSON())
+	if err != nil {
+		return err
+	}
+	breaking := 0
+	for _, c := range changes {
+		fmt.Println(c)
+		if c.Breaking {
+			breaking++
+		}
+	}
+
+	baseMajor, err := openapi.MajorVersion(baseSpec)
+	if err != nil {
+		return err
+	}
+	headMajor, _ := openapi.MajorVersion(doc.JSON())
+	switch {
+	case breaking > 0 && baseMajor == headMajor:
+		return fmt.Errorf("%d breaking changes, bump the major version of the API if they are intended", breaking)
+	case len(changes) == 0:
+		fmt.Println("no changes")
+	}
+	return nil
+}
+
+// buildDocument generates the spec of the routes served with cfg. The router is
+// built on the memory store, so no database is needed.
+func buildDocument(cfg *common.Config, logger *httplog.Logger) (*openapi.Document, error) {
+	// Keep stdout for the spec
+	quiet := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	a, err := app.Build(cfg, memory.New(), email.NewMemoryMailer(), quiet)
+	if err != nil {
+		return nil, err
+	}
+	router, ok := routes.NewRouter(a, logger).(chi.Routes)
+	if !ok {
+		return nil, errors.New("the router can't be walked")
+	}
+	return openapi.NewDocument(router)
+}
@@ -3,6 +3,10 @@ package common
 
 import (
 	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
 	"strings"
 
 	"github.com/spf13/viper"
@@ -14,51 +18,109 @@ type Config struct {
 	Database DatabaseConfig
 	Auth     AuthConfig
 	Email    EmailConfig
+	Outbox   OutboxConfig
 	Logging  LoggingConfig
 }
 
-// ServerConfig holds all server-related configuration
+// ServerConfig holds all server-related configuration.
+// FrontendHost is the base URL of the web app, used for links in emails.
+// The timeouts are in seconds, zero means no timeout. ShutdownDelay is how long,
+// in seconds, the server keeps taking requests once it is stopping, so load balancers
+// notice the failing readiness probe. ShutdownTimeout then bounds how long in-flight
+// requests may take to finish.
 type ServerConfig struct {
-	Host            string
-	Port            int
-	BasePath        string
-	AllowedOrigins  []string
-	ShutdownTimeout int
+	Host              string
+	FrontendHost      string
+	Port              int
+	BasePath          string
+	AllowedOrigins    []string
+	ReadTimeout       int
+	ReadHeaderTimeout int
+	WriteTimeout      int
+	IdleTimeout       int
+	ShutdownDelay     int
+	ShutdownTimeout   int
+	MaxBodySize       int
+	MaxUploadSize     int
 }
 
-// DatabaseConfig holds all database-related configuration
+// DatabaseConfig holds all database-related configuration.
+// Driver is postgres, the default, or memory to keep all data in memory.
+// MaxConnLifetime and MaxConnIdleTime are in minutes, HealthCheckPeriod and
+// ConnectTimeout in seconds. Zero pool settings keep the pgxpool defaults.
+// AutoMigrate applies pending migrations on startup.
 type DatabaseConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	Name     string
-	SSLMode  string
-	TimeZone string
+	Driver            string
+	Host              string
+	Port              int
+	User              string
+	Password          string
+	Name              string
+	SSLMode           string
+	TimeZone          string
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   int
+	MaxConnIdleTime   int
+	HealthCheckPeriod int
+	ConnectTimeout    int
+	AutoMigrate       bool
 }
 
-// AuthConfig holds all authentication-related configuration
+// AuthConfig holds all authentication-related configuration.
+// AccessTokenExpire is in minutes, RefreshTokenExpire in days and
+// PasswordResetExpire and VerificationExpire in hours.
+// RequireEmailVerification refuses logins until the user has verified their email.
 type AuthConfig struct {
-	SecretKey            string
-	AccessTokenExpire    int
-	RefreshTokenExpire   int
-	PasswordResetExpire  int
-	VerificationExpire   int
-	PasswordMinLength    int
-	PasswordHashCost     int
-	FirstSuperuserEmail  string
-	FirstSuperuserPasswd string
+	SecretKey                string
+	SecretKeyID              string
+	PreviousSecretKeys       map[string]string
+	Issuer                   string
+	Audience                 string
+	AccessTokenExpire        int
+	RefreshTokenExpire       int
+	PasswordResetExpire      int
+	VerificationExpire       int
+	PasswordMinLength        int
+	PasswordHashCost         int
+	RequireEmailVerification bool
+	FirstSuperuserEmail      string
+	FirstSuperuserPasswd     string
 }
 
-// EmailConfig holds all email-related configuration
+// EmailConfig holds all email-related configuration.
+// Driver is smtp, file or memory; SMTPTLS is starttls, tls or none and SMTPTimeout is in seconds.
+// DefaultLocale is the language of emails when the request doesn't ask for one we have templates for.
 type EmailConfig struct {
-	Enabled    bool
-	SMTPHost   string
-	SMTPPort   int
-	SMTPUser   string
-	SMTPPasswd string
-	FromEmail  string
-	FromName   string
+	Enabled       bool
+	Driver        string
+	SMTPHost      string
+	SMTPPort      int
+	SMTPUser      string
+	SMTPPasswd    string
+	SMTPTLS       string
+	SMTPTimeout   int
+	FileDir       string
+	FromEmail     string
+	FromName      string
+	DefaultLocale string
+}
+
+// OutboxConfig holds the outbox dispatcher configuration.
+// PollInterval, BaseBackoff, MaxBackoff, Lease, Retention and WebhookTimeout are in seconds.
+// Events are posted to WebhookURL when it is set, signed with WebhookSecret.
+type OutboxConfig struct {
+	Enabled        bool
+	PollInterval   int
+	BatchSize      int
+	MaxAttempts    int
+	BaseBackoff    int
+	MaxBackoff     int
+	Lease          int
+	Retention      int
+	WebhookURL     string
+	WebhookSecret  string
+	WebhookTimeout int
 }
 
 // LoggingConfig holds all logging-related configuration
@@ -97,5 +159,67 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
+
+// redacted replaces secrets in logged configurations
+const redacted = "REDACTED"
+
+// LogValue implements slog.LogValuer, passwords and secrets are redacted so the
+// configuration can be logged. Empty ones are kept to show they aren't set.
+func (c Config) LogValue() slog.Value {
+	redact := func(secret *string) {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	redact(&c.Database.Password)
+	redact(&c.Auth.SecretKey)
+	redact(&c.Auth.FirstSuperuserPasswd)
+	redact(&c.Email.SMTPPasswd)
+	redact(&c.Outbox.WebhookSecret)
+	if c.Auth.PreviousSecretKeys != nil {
+		previous := make(map[string]string, len(c.Auth.PreviousSecretKeys))
+		for kid := range c.Auth.PreviousSecretKeys {
+			previous[kid] = redacted
+		}
+		c.Auth.PreviousSecretKeys = previous
+	}
+
+	// Log the fields of the copy, not its LogValue
+	type config Config
+	return slog.AnyValue(config(c))
+}
+
+// placeholderSecrets are example secrets that must never be used in production
+var placeholderSecrets = []string{"", "supersecretkey", "your-secret-key", "changethis"}
+
+// minProductionSecretLength is the minimum length of the signing secret in production
+const minProductionSecretLength = 32
+
+// IsProduction reports whether the application runs in the production environment
+func IsProduction() bool {
+	return os.Getenv("ENV") == "production"
+}
+
+// Validate checks the configuration for values that are unsafe to run with
+func (c *Config) Validate() error {
+	if !IsProduction() {
+		return nil
+	}
+	secrets := map[string]string{c.Auth.SecretKeyID: c.Auth.SecretKey}
+	maps.Copy(secrets, c.Auth.PreviousSecretKeys)
+	for kid, secret := range secrets {
+		if slices.Contains(placeholderSecrets, secret) {
+			return fmt.Errorf("auth secret key %q is a placeholder, set MOJITO_AUTH_SECRETKEY for production", kid)
+		}
+		if len(secret) < minProductionSecretLength {
+			return fmt.Errorf("auth secret key %q must be at least %d characters in production", kid, minProductionSecretLength)
+		}
+	}
+	return nil
+}
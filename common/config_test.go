@@ -0,0 +1,52 @@
+package common_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/wangfenjin/mojito/common"
+)
+
+func TestConfigLogValue(t *testing.T) {
+	cfg := &common.Config{
+		Database: common.DatabaseConfig{User: "postgres", Password: "db-password"},
+		Auth: common.AuthConfig{
+			SecretKey:            "current-secret",
+			SecretKeyID:          "2",
+			PreviousSecretKeys:   map[string]string{"1": "previous-secret"},
+			FirstSuperuserEmail:  "admin@example.com",
+			FirstSuperuserPasswd: "admin-password",
+		},
+		Email:  common.EmailConfig{SMTPUser: "mojito", SMTPPasswd: "smtp-password"},
+		Outbox: common.OutboxConfig{WebhookSecret: "webhook-secret"},
+	}
+	secrets := []string{"db-password", "current-secret", "previous-secret", "admin-password", "smtp-password", "webhook-secret"}
+
+	for name, newHandler := range map[string]func(*bytes.Buffer) slog.Handler{
+		"json": func(b *bytes.Buffer) slog.Handler { return slog.NewJSONHandler(b, nil) },
+		"text": func(b *bytes.Buffer) slog.Handler { return slog.NewTextHandler(b, nil) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			slog.New(newHandler(&out)).Info("Configuration loaded", "config", cfg)
+
+			for _, secret := range secrets {
+				if strings.Contains(out.String(), secret) {
+					t.Errorf("log contains %q:\n%s", secret, out.String())
+				}
+			}
+			for _, want := range []string{"postgres", "admin@example.com", "mojito", "REDACTED"} {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("log doesn't contain %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+
+	// The configuration itself is unchanged
+	if cfg.Auth.SecretKey != "current-secret" || cfg.Auth.PreviousSecretKeys["1"] != "previous-secret" {
+		t.Errorf("secrets were changed: %+v", cfg.Auth)
+	}
+}
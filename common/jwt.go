@@ -1,42 +1,182 @@
 package common
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte("your-secret-key") // In production, this should be in config
+// DefaultKeyID is the kid used when AuthConfig.SecretKeyID is not set
+const DefaultKeyID = "default"
+
+// ErrInvalidActionToken is returned when an action token has a bad signature
+var ErrInvalidActionToken = errors.New("invalid action token")
 
 // Claims is a custom JWT claims
 type Claims struct {
 	UserID      string `json:"user_id"`
 	Email       string `json:"email"`
 	IsSuperUser bool
+	// TokenVersion must match the user's token_version, bumping it revokes all issued tokens
+	TokenVersion int32 `json:"ver"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token
-func GenerateToken(userID, email string) (string, error) {
+// TokenService signs and validates access tokens with keys from AuthConfig.
+// New tokens are signed with the current key and carry its id in the `kid` header;
+// tokens signed with any of the previous keys keep validating until they expire,
+// which allows rotating the secret without logging everybody out.
+type TokenService struct {
+	keyID      string
+	keys       map[string][]byte
+	issuer     string
+	audience   string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	resetTTL   time.Duration
+	verifyTTL  time.Duration
+}
+
+// NewTokenService creates a token service from the authentication configuration
+func NewTokenService(cfg AuthConfig) (*TokenService, error) {
+	if cfg.SecretKey == "" {
+		return nil, errors.New("auth.secretKey is required")
+	}
+	if cfg.AccessTokenExpire <= 0 {
+		return nil, errors.New("auth.accessTokenExpire must be positive")
+	}
+	if cfg.RefreshTokenExpire <= 0 {
+		return nil, errors.New("auth.refreshTokenExpire must be positive")
+	}
+	if cfg.PasswordResetExpire <= 0 {
+		return nil, errors.New("auth.passwordResetExpire must be positive")
+	}
+	if cfg.VerificationExpire <= 0 {
+		return nil, errors.New("auth.verificationExpire must be positive")
+	}
+
+	keyID := cfg.SecretKeyID
+	if keyID == "" {
+		keyID = DefaultKeyID
+	}
+	keys := map[string][]byte{keyID: []byte(cfg.SecretKey)}
+	for kid, secret := range cfg.PreviousSecretKeys {
+		if kid == keyID {
+			return nil, fmt.Errorf("auth.previousSecretKeys must not reuse the current key id %q", kid)
+		}
+		keys[kid] = []byte(secret)
+	}
+
+	return &TokenService{
+		keyID:      keyID,
+		keys:       keys,
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		accessTTL:  time.Duration(cfg.AccessTokenExpire) * time.Minute,
+		refreshTTL: time.Duration(cfg.RefreshTokenExpire) * 24 * time.Hour,
+		resetTTL:   time.Duration(cfg.PasswordResetExpire) * time.Hour,
+		verifyTTL:  time.Duration(cfg.VerificationExpire) * time.Hour,
+	}, nil
+}
+
+// AccessTokenTTL returns how long access tokens are valid
+func (s *TokenService) AccessTokenTTL() time.Duration {
+	return s.accessTTL
+}
+
+// RefreshTokenTTL returns how long refresh tokens are valid
+func (s *TokenService) RefreshTokenTTL() time.Duration {
+	return s.refreshTTL
+}
+
+// PasswordResetTTL returns how long password reset tokens are valid
+func (s *TokenService) PasswordResetTTL() time.Duration {
+	return s.resetTTL
+}
+
+// VerificationTTL returns how long email verification tokens are valid
+func (s *TokenService) VerificationTTL() time.Duration {
+	return s.verifyTTL
+}
+
+// NewActionToken creates a token for a single-use action such as a password reset.
+// The token is signed for the given purpose, so forged tokens or tokens minted for another
+// purpose are rejected before any lookup. Only the returned hash should be stored.
+func (s *TokenService) NewActionToken(purpose string) (token string, hash string, err error) {
+	nonce, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	token = nonce + "." + s.signAction(s.keys[s.keyID], purpose, nonce)
+	return token, HashOpaqueToken(token), nil
+}
+
+// VerifyActionToken checks the signature of a token created by NewActionToken
+// and returns the hash it was stored under
+func (s *TokenService) VerifyActionToken(purpose, token string) (string, error) {
+	nonce, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidActionToken
+	}
+	for _, key := range s.keys {
+		if hmac.Equal([]byte(sig), []byte(s.signAction(key, purpose, nonce))) {
+			return HashOpaqueToken(token), nil
+		}
+	}
+	return "", ErrInvalidActionToken
+}
+
+func (s *TokenService) signAction(key []byte, purpose, nonce string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose + "." + nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateToken generates a signed access token for the user
+func (s *TokenService) GenerateToken(userID, email string, tokenVersion int32) (string, error) {
+	now := time.Now()
 	claims := Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:       userID,
+		Email:        email,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    s.issuer,
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
+	if s.audience != "" {
+		claims.Audience = jwt.ClaimStrings{s.audience}
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	token.Header["kid"] = s.keyID
+	return token.SignedString(s.keys[s.keyID])
 }
 
-// ValidateToken validates a JWT token
-func ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(_ *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+// ValidateToken validates the signature, expiry, issuer and audience of a token
+func (s *TokenService) ValidateToken(tokenString string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if s.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(s.issuer))
+	}
+	if s.audience != "" {
+		opts = append(opts, jwt.WithAudience(s.audience))
+	}
 
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.keyFunc, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,3 +187,16 @@ func ValidateToken(tokenString string) (*Claims, error) {
 
 	return nil, jwt.ErrSignatureInvalid
 }
+
+// keyFunc picks the verification key named by the token's kid header
+func (s *TokenService) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = s.keyID
+	}
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
@@ -0,0 +1,115 @@
+package common_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wangfenjin/mojito/common"
+)
+
+// authConfig returns a valid authentication configuration signing with secret under kid
+func authConfig(kid, secret string) common.AuthConfig {
+	return common.AuthConfig{
+		SecretKey:           secret,
+		SecretKeyID:         kid,
+		Issuer:              "mojito",
+		Audience:            "mojito-api",
+		AccessTokenExpire:   30,
+		RefreshTokenExpire:  7,
+		PasswordResetExpire: 24,
+		VerificationExpire:  48,
+	}
+}
+
+func newTokenService(t *testing.T, cfg common.AuthConfig) *common.TokenService {
+	t.Helper()
+	tokens, err := common.NewTokenService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestValidateTokenRotation(t *testing.T) {
+	token, err := newTokenService(t, authConfig("1", "old-secret")).GenerateToken("user-id", "user@example.com", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens signed with the previous key keep validating after the rotation
+	rotated := authConfig("2", "new-secret")
+	rotated.PreviousSecretKeys = map[string]string{"1": "old-secret"}
+	claims, err := newTokenService(t, rotated).ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v, want the previous key to be accepted", err)
+	}
+	if claims.UserID != "user-id" || claims.Email != "user@example.com" || claims.TokenVersion != 1 {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// They are rejected once the previous key is dropped
+	if _, err := newTokenService(t, authConfig("2", "new-secret")).ValidateToken(token); err == nil {
+		t.Error("ValidateToken() accepted a token signed with a dropped key")
+	}
+}
+
+func TestValidateTokenRejected(t *testing.T) {
+	tokens := newTokenService(t, authConfig("1", "secret"))
+	otherIssuer := authConfig("1", "secret")
+	otherIssuer.Issuer = "other"
+	otherAudience := authConfig("1", "secret")
+	otherAudience.Audience = "other"
+
+	tests := []struct {
+		name string
+		cfg  common.AuthConfig
+		want string
+	}{
+		{"unknown kid", authConfig("9", "secret"), `unknown signing key "9"`},
+		{"wrong issuer", otherIssuer, "invalid issuer"},
+		{"wrong audience", otherAudience, "invalid audience"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := newTokenService(t, tt.cfg).GenerateToken("user-id", "user@example.com", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tokens.ValidateToken(token)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ValidateToken() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateProductionSecrets(t *testing.T) {
+	strong := strings.Repeat("s", 32)
+	tests := []struct {
+		name     string
+		secret   string
+		previous map[string]string
+		wantErr  bool
+	}{
+		{"placeholder", "supersecretkey", nil, true},
+		{"short", "short-secret", nil, true},
+		{"placeholder previous key", strong, map[string]string{"0": "changethis"}, true},
+		{"strong", strong, map[string]string{"0": strings.Repeat("p", 32)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &common.Config{Auth: authConfig("1", tt.secret)}
+			cfg.Auth.PreviousSecretKeys = tt.previous
+
+			t.Setenv("ENV", "development")
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("Validate() outside production error = %v", err)
+			}
+			t.Setenv("ENV", "production")
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,10 +1,41 @@
 package common
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"fmt"
 
-// HashPassword creates a bcrypt hash from a password string
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordPolicy holds the rules applied to user passwords
+type PasswordPolicy struct {
+	MinLength int
+	HashCost  int
+}
+
+// NewPasswordPolicy creates the password policy of the authentication configuration.
+// Zero values keep the defaults.
+func NewPasswordPolicy(cfg AuthConfig) PasswordPolicy {
+	policy := PasswordPolicy{MinLength: 8, HashCost: 14}
+	if cfg.PasswordMinLength > 0 {
+		policy.MinLength = cfg.PasswordMinLength
+	}
+	if cfg.PasswordHashCost > 0 {
+		policy.HashCost = cfg.PasswordHashCost
+	}
+	return policy
+}
+
+// Validate checks a new password against the policy
+func (p PasswordPolicy) Validate(password string) error {
+	if len(password) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	return nil
+}
+
+// Hash creates a bcrypt hash from a password string with the cost of the policy
+func (p PasswordPolicy) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), p.HashCost)
 	return string(bytes), err
 }
 
@@ -0,0 +1,90 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/wangfenjin/mojito/common"
+)
+
+// FileMailer writes every email as an .eml file into a directory, for local development
+type FileMailer struct {
+	dir  string
+	from mail.Address
+}
+
+// NewFileMailer creates a file mailer writing to EmailConfig.FileDir
+func NewFileMailer(cfg common.EmailConfig) (*FileMailer, error) {
+	if cfg.FileDir == "" {
+		return nil, errors.New("email.fileDir is required for the file driver")
+	}
+	if err := os.MkdirAll(cfg.FileDir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating email directory: %w", err)
+	}
+	return &FileMailer{
+		dir:  cfg.FileDir,
+		from: mail.Address{Name: cfg.FromName, Address: cfg.FromEmail},
+	}, nil
+}
+
+// Send implements Mailer
+func (m *FileMailer) Send(_ context.Context, msg *Message) error {
+	body, err := msg.bytes(m.from)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), randomHex(4))
+	return os.WriteFile(filepath.Join(m.dir, name), body, 0o640)
+}
+
+// MemoryMailer keeps sent emails in memory so tests can inspect them
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryMailer creates an empty in-memory mailer
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send implements Mailer
+func (m *MemoryMailer) Send(_ context.Context, msg *Message) error {
+	if _, err := msg.recipients(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// Messages returns a copy of all sent emails, oldest first
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the most recently sent email
+func (m *MemoryMailer) Last() (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) == 0 {
+		return Message{}, false
+	}
+	return m.messages[len(m.messages)-1], true
+}
+
+// Reset forgets all sent emails
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
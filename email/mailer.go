@@ -0,0 +1,62 @@
+// Package email delivers transactional emails such as password recovery links
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wangfenjin/mojito/common"
+)
+
+// Drivers selectable with EmailConfig.Driver
+const (
+	DriverSMTP   = "smtp"
+	DriverFile   = "file"
+	DriverMemory = "memory"
+)
+
+// ErrDisabled is returned by the mailer when email delivery is turned off
+var ErrDisabled = errors.New("email delivery is disabled")
+
+// Message is an email with a plain text body and an optional HTML alternative
+type Message struct {
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Text    string   `json:"text"`
+	HTML    string   `json:"html,omitempty"`
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New creates the mailer selected by the email configuration
+func New(cfg common.EmailConfig) (Mailer, error) {
+	if !cfg.Enabled {
+		return disabledMailer{}, nil
+	}
+	if cfg.FromEmail == "" {
+		return nil, errors.New("email.fromEmail is required")
+	}
+
+	switch cfg.Driver {
+	case DriverSMTP, "":
+		return NewSMTPMailer(cfg)
+	case DriverFile:
+		return NewFileMailer(cfg)
+	case DriverMemory:
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown email driver %q", cfg.Driver)
+	}
+}
+
+// disabledMailer is used when email delivery is turned off
+type disabledMailer struct{}
+
+// Send implements Mailer
+func (disabledMailer) Send(_ context.Context, _ *Message) error {
+	return ErrDisabled
+}
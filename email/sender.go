@@ -0,0 +1,100 @@
+package email
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Sender composes the application's emails from templates. Emails caused by a domain
+// change are rendered here and delivered through the outbox.
+type Sender struct {
+	mailer       Mailer
+	templates    *Templates
+	frontendHost string
+	appName      string
+}
+
+// NewSender creates a sender, links in emails point to frontendHost and
+// appName brands the emails
+func NewSender(mailer Mailer, templates *Templates, frontendHost, appName string) *Sender {
+	if appName == "" {
+		appName = "Mojito"
+	}
+	return &Sender{
+		mailer:       mailer,
+		templates:    templates,
+		frontendHost: strings.TrimRight(frontendHost, "/"),
+		appName:      appName,
+	}
+}
+
+// Mailer returns the mailer used for delivery
+func (s *Sender) Mailer() Mailer {
+	return s.mailer
+}
+
+// Templates returns the templates emails are rendered with
+func (s *Sender) Templates() *Templates {
+	return s.templates
+}
+
+// Compose renders the named template for a recipient, locale is an Accept-Language value
+func (s *Sender) Compose(name, locale string, data Data) (*Message, error) {
+	data.AppName = s.appName
+	msg, err := s.templates.Render(name, locale, data)
+	if err != nil {
+		return nil, err
+	}
+	msg.To = []string{data.Email}
+	return msg, nil
+}
+
+// SendTestEmail sends a message to check the email configuration. It bypasses
+// the outbox, so delivery errors are reported to the caller.
+func (s *Sender) SendTestEmail(ctx context.Context, to, locale string) error {
+	msg, err := s.Compose(TemplateTestEmail, locale, Data{Email: to})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, msg)
+}
+
+// PasswordResetLink returns the frontend link that resets the password with token
+func (s *Sender) PasswordResetLink(token string) string {
+	return s.frontendHost + "/reset-password?token=" + url.QueryEscape(token)
+}
+
+// PasswordResetMessage renders the password recovery email with a reset link valid for validFor
+func (s *Sender) PasswordResetMessage(to, token string, validFor time.Duration, locale string) (*Message, error) {
+	return s.Compose(TemplatePasswordReset, locale, Data{
+		Email:    to,
+		Link:     s.PasswordResetLink(token),
+		ValidFor: validFor,
+	})
+}
+
+// VerificationLink returns the frontend link that verifies an email address with token
+func (s *Sender) VerificationLink(token string) string {
+	return s.frontendHost + "/verify-email?token=" + url.QueryEscape(token)
+}
+
+// VerificationMessage renders the email address verification email
+func (s *Sender) VerificationMessage(to, name, token string, validFor time.Duration, locale string) (*Message, error) {
+	return s.Compose(TemplateVerification, locale, Data{
+		Email:    to,
+		Name:     name,
+		Link:     s.VerificationLink(token),
+		ValidFor: validFor,
+	})
+}
+
+// WelcomeMessage renders the welcome email for a new user
+func (s *Sender) WelcomeMessage(to, name, locale string) (*Message, error) {
+	return s.Compose(TemplateWelcome, locale, Data{
+		Email: to,
+		Name:  name,
+		Link:  s.frontendHost + "/login",
+	})
+}
@@ -0,0 +1,161 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/wangfenjin/mojito/common"
+)
+
+// TLS modes selectable with EmailConfig.SMTPTLS
+const (
+	// TLSStartTLS upgrades a plain connection with STARTTLS and fails if the server doesn't support it
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects over TLS from the start, usually on port 465
+	TLSImplicit = "tls"
+	// TLSNone sends in plain text, only meant for local fake SMTP servers
+	TLSNone = "none"
+)
+
+// defaultSMTPTimeout bounds a whole delivery when EmailConfig.SMTPTimeout is not set
+const defaultSMTPTimeout = 10 * time.Second
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	addr     string
+	host     string
+	tlsMode  string
+	username string
+	password string
+	from     mail.Address
+	timeout  time.Duration
+}
+
+// NewSMTPMailer creates an SMTP mailer from the email configuration.
+// When SMTPTLS is empty, port 465 uses implicit TLS and other ports use STARTTLS.
+func NewSMTPMailer(cfg common.EmailConfig) (*SMTPMailer, error) {
+	if cfg.SMTPHost == "" || cfg.SMTPPort == 0 {
+		return nil, errors.New("email.smtpHost and email.smtpPort are required")
+	}
+
+	tlsMode := cfg.SMTPTLS
+	if tlsMode == "" {
+		tlsMode = TLSStartTLS
+		if cfg.SMTPPort == 465 {
+			tlsMode = TLSImplicit
+		}
+	}
+	switch tlsMode {
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, fmt.Errorf("unknown email.smtpTLS mode %q", tlsMode)
+	}
+
+	timeout := defaultSMTPTimeout
+	if cfg.SMTPTimeout > 0 {
+		timeout = time.Duration(cfg.SMTPTimeout) * time.Second
+	}
+
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		host:     cfg.SMTPHost,
+		tlsMode:  tlsMode,
+		username: cfg.SMTPUser,
+		password: cfg.SMTPPasswd,
+		from:     mail.Address{Name: cfg.FromName, Address: cfg.FromEmail},
+		timeout:  timeout,
+	}, nil
+}
+
+// Send implements Mailer
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	to, err := msg.recipients()
+	if err != nil {
+		return err
+	}
+	body, err := msg.bytes(m.from)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	client, err := m.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("error connecting to smtp server: %w", err)
+	}
+	defer client.Close()
+
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("smtp auth failed: %w", err)
+		}
+	}
+	if err := client.Mail(m.from.Address); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s failed: %w", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("error writing email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial connects to the server and negotiates TLS according to the configured mode
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	tlsConfig := &tls.Config{ServerName: m.host, MinVersion: tls.VersionTLS12}
+	if m.tlsMode == TLSImplicit {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if m.tlsMode == TLSStartTLS {
+		// Refuse to continue in plain text, otherwise a downgrade would leak credentials
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
@@ -0,0 +1,185 @@
+package email_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/wangfenjin/mojito/common"
+	"github.com/wangfenjin/mojito/email"
+)
+
+// smtpServer is a fake SMTP server accepting a single connection. Its fields
+// are set by the session and can be read once done is closed.
+type smtpServer struct {
+	port       int
+	extensions []string
+	done       chan struct{}
+
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// newSMTPServer starts a fake SMTP server on a local port, advertising extensions in its EHLO reply
+func newSMTPServer(t *testing.T, extensions ...string) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &smtpServer{
+		port:       ln.Addr().(*net.TCPAddr).Port,
+		extensions: extensions,
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.serve(textproto.NewConn(conn))
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(tp *textproto.Conn) {
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := append([]string{"localhost"}, s.extensions...)
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				tp.PrintfLine("250%s%s", sep, l)
+			}
+		case "AUTH":
+			// AUTH PLAIN with the initial response "\x00user\x00password"
+			_, resp, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(resp)
+			s.auth = string(decoded)
+			tp.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			s.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			s.to = append(s.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data = string(data)
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// mailer creates an SMTP mailer sending to s
+func (s *smtpServer) mailer(t *testing.T, configure func(cfg *common.EmailConfig)) *email.SMTPMailer {
+	t.Helper()
+	cfg := common.EmailConfig{
+		SMTPHost:    "127.0.0.1",
+		SMTPPort:    s.port,
+		SMTPTLS:     email.TLSNone,
+		SMTPTimeout: 5,
+		FromEmail:   "noreply@example.com",
+		FromName:    "Mojito",
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+	m, err := email.NewSMTPMailer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+var testMessage = &email.Message{
+	To:      []string{"user@example.com"},
+	Subject: "Hello",
+	Text:    "Hello from the test",
+	HTML:    "<p>Hello from the test</p>",
+}
+
+func TestSMTPSend(t *testing.T) {
+	s := newSMTPServer(t)
+	if err := s.mailer(t, nil).Send(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	<-s.done
+
+	if s.from != "noreply@example.com" || len(s.to) != 1 || s.to[0] != "user@example.com" {
+		t.Errorf("envelope from %q to %v", s.from, s.to)
+	}
+	for _, want := range []string{"From: \"Mojito\" <noreply@example.com>", "To: user@example.com", "Subject: Hello", "multipart/alternative", "<p>Hello from the test</p>"} {
+		if !strings.Contains(s.data, want) {
+			t.Errorf("data doesn't contain %q:\n%s", want, s.data)
+		}
+	}
+	if s.auth != "" {
+		t.Errorf("authenticated without credentials: %q", s.auth)
+	}
+}
+
+func TestSMTPAuth(t *testing.T) {
+	s := newSMTPServer(t, "AUTH PLAIN")
+	m := s.mailer(t, func(cfg *common.EmailConfig) {
+		cfg.SMTPUser = "mojito"
+		cfg.SMTPPasswd = "secret"
+	})
+	if err := m.Send(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	<-s.done
+
+	if s.auth != "\x00mojito\x00secret" {
+		t.Errorf("auth = %q, want the plain credentials", s.auth)
+	}
+	if s.data == "" {
+		t.Error("message wasn't sent after authenticating")
+	}
+}
+
+func TestSMTPStartTLSRequired(t *testing.T) {
+	s := newSMTPServer(t, "AUTH PLAIN")
+	m := s.mailer(t, func(cfg *common.EmailConfig) {
+		cfg.SMTPTLS = "" // STARTTLS on ports other than 465
+		cfg.SMTPUser = "mojito"
+		cfg.SMTPPasswd = "secret"
+	})
+	err := m.Send(context.Background(), testMessage)
+	if err == nil || !strings.Contains(err.Error(), "does not support STARTTLS") {
+		t.Fatalf("Send() error = %v, want STARTTLS to be required", err)
+	}
+	<-s.done
+
+	// Nothing is sent in plain text
+	if s.auth != "" || s.from != "" || s.data != "" {
+		t.Errorf("server received auth %q, from %q and data %q", s.auth, s.from, s.data)
+	}
+}
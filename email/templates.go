@@ -0,0 +1,179 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Template names, one .html and one .txt file per locale directory in templates/
+const (
+	TemplatePasswordReset = "password_reset"
+	TemplateVerification  = "verification"
+	TemplateWelcome       = "welcome"
+	TemplateTestEmail     = "test_email"
+)
+
+// DefaultLocale is used when no requested locale has templates
+const DefaultLocale = "en"
+
+//go:embed templates
+var templateFS embed.FS
+
+// styles are inlined into the style attribute of HTML emails, since many
+// email clients drop <style> elements
+var styles = map[string]string{
+	"body":      "margin:0;padding:0;background-color:#f4f4f5;font-family:Helvetica,Arial,sans-serif;color:#27272a;",
+	"wrapper":   "background-color:#f4f4f5;padding:24px 0;",
+	"container": "max-width:600px;background-color:#ffffff;border-radius:8px;",
+	"header":    "padding:24px 32px;font-size:20px;font-weight:bold;color:#009688;border-bottom:1px solid #e4e4e7;",
+	"content":   "padding:32px;",
+	"title":     "margin:0 0 16px;font-size:22px;",
+	"paragraph": "margin:0 0 16px;font-size:16px;line-height:24px;",
+	"actions":   "margin:24px 0;text-align:center;",
+	"button":    "display:inline-block;padding:12px 24px;background-color:#009688;color:#ffffff;text-decoration:none;border-radius:4px;font-weight:bold;",
+	"muted":     "margin:0 0 12px;font-size:13px;line-height:20px;color:#71717a;word-break:break-all;",
+	"footer":    "padding:16px 32px;font-size:12px;color:#a1a1aa;border-top:1px solid #e4e4e7;text-align:center;",
+}
+
+// Data is passed to the templates
+type Data struct {
+	AppName  string
+	Locale   string
+	Email    string
+	Name     string
+	Link     string
+	ValidFor time.Duration
+}
+
+// Templates renders the embedded email templates. Every page is rendered
+// inside the shared layout as a text and an HTML part.
+type Templates struct {
+	defaultLocale string
+	html          map[string]*htmltemplate.Template
+	text          map[string]*texttemplate.Template
+}
+
+// NewTemplates parses all embedded templates, defaultLocale is used as a fallback
+// for pages missing in the requested locale
+func NewTemplates(defaultLocale string) (*Templates, error) {
+	if defaultLocale == "" {
+		defaultLocale = DefaultLocale
+	}
+	t := &Templates{
+		defaultLocale: defaultLocale,
+		html:          make(map[string]*htmltemplate.Template),
+		text:          make(map[string]*texttemplate.Template),
+	}
+
+	funcs := map[string]any{
+		"hours": func(d time.Duration) int { return int(d.Hours()) },
+		"year":  func() int { return time.Now().Year() },
+	}
+	htmlFuncs := htmltemplate.FuncMap{
+		"style": func(name string) (htmltemplate.CSS, error) {
+			css, ok := styles[name]
+			if !ok {
+				return "", fmt.Errorf("unknown email style %q", name)
+			}
+			return htmltemplate.CSS(css), nil
+		},
+	}
+	for k, v := range funcs {
+		htmlFuncs[k] = v
+	}
+
+	pages, err := fs.Glob(templateFS, "templates/*/*")
+	if err != nil {
+		return nil, err
+	}
+	for _, page := range pages {
+		locale := path.Base(path.Dir(page))
+		name, ext, _ := strings.Cut(path.Base(page), ".")
+		key := locale + "/" + name
+
+		switch ext {
+		case "html":
+			tmpl, err := htmltemplate.New("layout.html").Funcs(htmlFuncs).ParseFS(templateFS, "templates/layout.html", page)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing email template %s: %w", page, err)
+			}
+			t.html[key] = tmpl
+		case "txt":
+			tmpl, err := texttemplate.New("layout.txt").Funcs(funcs).ParseFS(templateFS, "templates/layout.txt", page)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing email template %s: %w", page, err)
+			}
+			t.text[key] = tmpl
+		}
+	}
+
+	for _, name := range []string{TemplatePasswordReset, TemplateVerification, TemplateWelcome, TemplateTestEmail} {
+		key := defaultLocale + "/" + name
+		if t.html[key] == nil || t.text[key] == nil {
+			return nil, fmt.Errorf("email template %s is missing for the default locale", key)
+		}
+	}
+	return t, nil
+}
+
+// MatchLocale picks the best locale with templates for an Accept-Language header value,
+// "zh-CN,zh;q=0.9,en;q=0.8" matches zh. Quality values are ignored, the first match wins.
+func (t *Templates) MatchLocale(acceptLanguage string) string {
+	for _, tag := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ = strings.Cut(tag, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if t.hasLocale(tag) {
+			return tag
+		}
+		if base, _, ok := strings.Cut(tag, "-"); ok && t.hasLocale(base) {
+			return base
+		}
+	}
+	return t.defaultLocale
+}
+
+func (t *Templates) hasLocale(locale string) bool {
+	_, ok := t.text[locale+"/"+TemplateTestEmail]
+	return ok
+}
+
+// Render renders the named template in the given locale into a message without recipients
+func (t *Templates) Render(name, locale string, data Data) (*Message, error) {
+	locale = t.MatchLocale(locale)
+	textTmpl, htmlTmpl := t.text[locale+"/"+name], t.html[locale+"/"+name]
+	if textTmpl == nil || htmlTmpl == nil {
+		locale = t.defaultLocale
+		textTmpl, htmlTmpl = t.text[locale+"/"+name], t.html[locale+"/"+name]
+	}
+	if textTmpl == nil || htmlTmpl == nil {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+	data.Locale = locale
+
+	var subject, text, html bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("error rendering email subject %s: %w", name, err)
+	}
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("error rendering email text %s: %w", name, err)
+	}
+	if err := htmlTmpl.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("error rendering email html %s: %w", name, err)
+	}
+
+	return &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,76 @@
+package email_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wangfenjin/mojito/email"
+)
+
+func TestRender(t *testing.T) {
+	templates, err := email.NewTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := email.Data{
+		AppName:  "Mojito",
+		Email:    "user@example.com",
+		Name:     "Alice",
+		Link:     "https://example.com/action?token=abc",
+		ValidFor: 48 * time.Hour,
+	}
+	// Pages with a link show it in both parts
+	names := map[string]bool{
+		email.TemplatePasswordReset: true,
+		email.TemplateVerification:  true,
+		email.TemplateWelcome:       true,
+		email.TemplateTestEmail:     false,
+	}
+
+	for name, hasLink := range names {
+		subjects := map[string]string{}
+		for _, locale := range []string{"en", "zh"} {
+			t.Run(locale+"/"+name, func(t *testing.T) {
+				msg, err := templates.Render(name, locale, data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if msg.Subject == "" || strings.TrimSpace(msg.Text) == "" || !strings.Contains(msg.HTML, "<html") {
+					t.Errorf("rendered %+v, want a subject, a text and an HTML part", msg)
+				}
+				if !strings.Contains(msg.HTML, "Mojito") || strings.Contains(msg.HTML+msg.Text, "<no value>") {
+					t.Errorf("data is missing from\n%s\n%s", msg.Text, msg.HTML)
+				}
+				if hasLink && (!strings.Contains(msg.Text, data.Link) || !strings.Contains(msg.HTML, data.Link)) {
+					t.Errorf("link is missing from\n%s\n%s", msg.Text, msg.HTML)
+				}
+				subjects[locale] = msg.Subject
+			})
+		}
+		if subjects["en"] == subjects["zh"] {
+			t.Errorf("%s has the same subject in en and zh: %q", name, subjects["en"])
+		}
+	}
+}
+
+func TestRenderFallsBackToDefaultLocale(t *testing.T) {
+	templates, err := email.NewTemplates("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := templates.Render(email.TemplateTestEmail, "en", email.Data{AppName: "Mojito"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := templates.Render(email.TemplateTestEmail, "fr-FR,fr;q=0.9", email.Data{AppName: "Mojito"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Subject != want.Subject {
+		t.Errorf("subject = %q, want the en subject %q", got.Subject, want.Subject)
+	}
+	if locale := templates.MatchLocale("zh-CN,zh;q=0.9,en;q=0.8"); locale != "zh" {
+		t.Errorf("MatchLocale() = %q, want zh", locale)
+	}
+}
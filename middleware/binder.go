@@ -0,0 +1,552 @@
+package middleware
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wangfenjin/mojito/openapi"
+)
+
+// Binding sources, named after the struct tags that select them
+const (
+	SourceURI    = "uri"
+	SourceQuery  = "query"
+	SourceHeader = "header"
+	SourceCookie = "cookie"
+	SourceForm   = "form"
+	SourceJSON   = "json"
+	SourceFile   = "file"
+)
+
+// Default limits applied by NewBinder
+const (
+	DefaultMaxMemory    = 32 << 20 // 32 MB of multipart data kept in memory, the rest spills to disk
+	DefaultMaxFileSize  = 10 << 20 // 10 MB per uploaded file
+	DefaultMaxBodyBytes = 64 << 20 // 64 MB per request body
+)
+
+// valueSources are the tag driven sources bound field by field; json is decoded as a whole body
+var valueSources = []string{SourceURI, SourceQuery, SourceHeader, SourceCookie, SourceForm, SourceFile}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType     = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+// ErrUnsupportedMediaType is returned when a request body has a content type the binder can't decode
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// ErrRequestTooLarge is returned when a request body or uploaded file exceeds the binder limits
+var ErrRequestTooLarge = errors.New("request entity too large")
+
+// BindError reports request values that could not be converted to their field types
+type BindError struct {
+	Errors []FieldError
+}
+
+// Error implement error interface for BindError
+func (e *BindError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// boundField describes how a single struct field is populated
+type boundField struct {
+	index      []int
+	source     string
+	name       string
+	defaultVal string
+	hasDefault bool
+	accept     []string
+}
+
+// Binder populates request structs from the parts of an HTTP request named by their struct tags:
+// `uri`, `query`, `header`, `cookie`, `form`, `json` and `file`. Fields tagged `default` are pre-filled
+// before binding so that values supplied by the client take precedence. A JSON body
+// only sets the fields openapi.BodyFields documents, not those of other sources.
+//
+// File fields must be *multipart.FileHeader or []*multipart.FileHeader. An optional
+// `accept:"image/png,image/*"` tag restricts the content type, which is sniffed from the
+// file contents rather than trusted from the client.
+type Binder struct {
+	// MaxMemory is the number of bytes of a multipart body kept in memory
+	MaxMemory int64
+	// MaxFileSize limits the size of each uploaded file, 0 means unlimited
+	MaxFileSize int64
+	// MaxBodyBytes limits the size of the request body, 0 means unlimited
+	MaxBodyBytes int64
+
+	cache  sync.Map // reflect.Type -> []boundField
+	bodies sync.Map // reflect.Type -> *jsonBody
+}
+
+// jsonBody is the part of a request type decoded from a JSON body: a struct
+// type holding the body fields, so other keys can't reach the request
+type jsonBody struct {
+	fields []openapi.BodyField
+	typ    reflect.Type
+}
+
+// NewBinder creates a new request binder with the default limits
+func NewBinder() *Binder {
+	return &Binder{
+		MaxMemory:    DefaultMaxMemory,
+		MaxFileSize:  DefaultMaxFileSize,
+		MaxBodyBytes: DefaultMaxBodyBytes,
+	}
+}
+
+// Bind decodes r into dst, which must be a pointer to a struct
+func (b *Binder) Bind(r *http.Request, dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind target must be a non-nil pointer to a struct, got %T", dst)
+	}
+	v = v.Elem()
+	fields := b.fields(v.Type())
+
+	// Apply defaults first
+	for _, f := range fields {
+		if !f.hasDefault {
+			continue
+		}
+		if err := setField(v.FieldByIndex(f.index), []string{f.defaultVal}); err != nil {
+			return fmt.Errorf("invalid default for field %s: %w", f.name, err)
+		}
+	}
+
+	if err := b.bindBody(r, v); err != nil {
+		return err
+	}
+
+	var fieldErrs []FieldError
+	for _, f := range fields {
+		if f.source == SourceJSON {
+			continue
+		}
+		if f.source == SourceFile {
+			fieldErr, err := b.bindFiles(r, v.FieldByIndex(f.index), f)
+			if err != nil {
+				return err
+			}
+			if fieldErr != nil {
+				fieldErrs = append(fieldErrs, *fieldErr)
+			}
+			continue
+		}
+		values, err := sourceValues(r, f.source, f.name)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+			continue
+		}
+		if err := setField(v.FieldByIndex(f.index), values); err != nil {
+			fieldErrs = append(fieldErrs, FieldError{
+				Field:   f.name,
+				Rule:    "type",
+				Param:   v.FieldByIndex(f.index).Type().String(),
+				Message: fmt.Sprintf("%s %s %q is invalid: %v", f.source, f.name, values[0], err),
+			})
+		}
+	}
+	if len(fieldErrs) > 0 {
+		return &BindError{Errors: fieldErrs}
+	}
+	return nil
+}
+
+// bindBody decodes the request body into v according to its content type
+func (b *Binder) bindBody(r *http.Request, v reflect.Value) error {
+	mediaType := ""
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		parsed, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrUnsupportedMediaType, ct)
+		}
+		mediaType = parsed
+	}
+
+	if b.MaxBodyBytes > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = http.MaxBytesReader(nil, r.Body, b.MaxBodyBytes)
+	}
+
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return wrapBodyError("error parsing form", err)
+		}
+	case mediaType == "multipart/form-data":
+		if err := r.ParseMultipartForm(b.MaxMemory); err != nil {
+			return wrapBodyError("error parsing multipart form", err)
+		}
+	case r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0:
+		// Nothing to decode
+	case mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if err := b.decodeJSON(r.Body, v); err != nil {
+			return wrapBodyError("error decoding JSON body", err)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+	}
+	return nil
+}
+
+// decodeJSON decodes a JSON body into the body fields of v. Values already in
+// the fields, such as defaults, are kept when the body doesn't set them.
+func (b *Binder) decodeJSON(body io.Reader, v reflect.Value) error {
+	jb := b.body(v.Type())
+	dst := reflect.New(jb.typ)
+	for i, f := range jb.fields {
+		if fv, err := v.FieldByIndexErr(f.Index); err == nil {
+			dst.Elem().Field(i).Set(fv)
+		}
+	}
+	if err := json.NewDecoder(body).Decode(dst.Interface()); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	for i, f := range jb.fields {
+		value := dst.Elem().Field(i)
+		if fv, err := v.FieldByIndexErr(f.Index); err == nil {
+			fv.Set(value)
+		} else if fv := fieldByIndexAlloc(v, f.Index); fv.IsValid() && !value.IsZero() {
+			fv.Set(value)
+		}
+	}
+	return nil
+}
+
+// body returns the cached JSON body description of t
+func (b *Binder) body(t reflect.Type) *jsonBody {
+	if cached, ok := b.bodies.Load(t); ok {
+		return cached.(*jsonBody)
+	}
+	fields := openapi.BodyFields(t)
+	structFields := make([]reflect.StructField, len(fields))
+	for i, f := range fields {
+		_, opts, _ := strings.Cut(f.Field.Tag.Get(SourceJSON), ",")
+		structFields[i] = reflect.StructField{
+			Name: fmt.Sprintf("F%d", i),
+			Type: f.Field.Type,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s,%s"`, f.Name, opts)),
+		}
+	}
+	jb := &jsonBody{fields: fields, typ: reflect.StructOf(structFields)}
+	b.bodies.Store(t, jb)
+	return jb
+}
+
+// fieldByIndexAlloc returns the field of v at index, allocating the nil embedded
+// struct pointers on the way. The value is invalid when a pointer can't be set,
+// as encoding/json neither sets pointers to unexported structs.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// bindFiles assigns the uploaded files for f to fv, checking size and sniffed content type
+func (b *Binder) bindFiles(r *http.Request, fv reflect.Value, f boundField) (*FieldError, error) {
+	if r.MultipartForm == nil || len(r.MultipartForm.File[f.name]) == 0 {
+		return nil, nil
+	}
+	files := r.MultipartForm.File[f.name]
+
+	for _, fh := range files {
+		if b.MaxFileSize > 0 && fh.Size > b.MaxFileSize {
+			return nil, fmt.Errorf("%w: file %s is larger than %d bytes", ErrRequestTooLarge, fh.Filename, b.MaxFileSize)
+		}
+		contentType, err := sniffContentType(fh)
+		if err != nil {
+			return nil, fmt.Errorf("error reading uploaded file %s: %w", fh.Filename, err)
+		}
+		fh.Header.Set("Content-Type", contentType)
+		if len(f.accept) > 0 && !matchMediaType(contentType, f.accept) {
+			return &FieldError{
+				Field:   f.name,
+				Rule:    "accept",
+				Param:   strings.Join(f.accept, ","),
+				Message: fmt.Sprintf("file %s has content type %s, expected one of [%s]", fh.Filename, contentType, strings.Join(f.accept, ",")),
+			}, nil
+		}
+	}
+
+	switch fv.Type() {
+	case fileHeaderType:
+		fv.Set(reflect.ValueOf(files[0]))
+	case fileHeadersType:
+		fv.Set(reflect.ValueOf(files))
+	default:
+		return nil, fmt.Errorf("file field %s must be *multipart.FileHeader or []*multipart.FileHeader, got %s", f.name, fv.Type())
+	}
+	return nil, nil
+}
+
+// sniffContentType detects the content type of an uploaded file from its first 512 bytes
+func sniffContentType(fh *multipart.FileHeader) (string, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// matchMediaType reports whether contentType matches one of the accepted patterns, e.g. image/*
+func matchMediaType(contentType string, accept []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range accept {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "*/*" || pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapBodyError marks errors caused by an oversized body with ErrRequestTooLarge
+func wrapBodyError(msg string, err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) || errors.Is(err, multipart.ErrMessageTooLarge) {
+		return fmt.Errorf("%w: %s: %v", ErrRequestTooLarge, msg, err)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// fields returns the cached binding description of t
+func (b *Binder) fields(t reflect.Type) []boundField {
+	if cached, ok := b.cache.Load(t); ok {
+		return cached.([]boundField)
+	}
+	fields := collectFields(t, nil)
+	b.cache.Store(t, fields)
+	return fields
+}
+
+// RequestFields describes where b reads the fields of the request type t from,
+// for the OpenAPI spec. Fields of the JSON body are left out.
+func (b *Binder) RequestFields(t reflect.Type) []openapi.RequestField {
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []openapi.RequestField
+	for _, f := range b.fields(t) {
+		if f.source == "" || f.source == SourceJSON {
+			continue
+		}
+		fields = append(fields, openapi.RequestField{
+			Source: f.source,
+			Name:   f.name,
+			Field:  t.FieldByIndex(f.index),
+		})
+	}
+	return fields
+}
+
+func collectFields(t reflect.Type, parent []int) []boundField {
+	var fields []boundField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+
+		// Flatten embedded structs so their tags bind like top-level fields
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && fieldSource(sf) == "" {
+			fields = append(fields, collectFields(sf.Type, index)...)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		source := fieldSource(sf)
+		def, hasDefault := sf.Tag.Lookup("default")
+		if source == "" && !hasDefault {
+			continue
+		}
+		name := sf.Name
+		if source != "" {
+			name = strings.Split(sf.Tag.Get(source), ",")[0]
+		}
+		var accept []string
+		if value := sf.Tag.Get("accept"); value != "" {
+			accept = strings.Split(value, ",")
+		}
+		fields = append(fields, boundField{
+			index:      index,
+			source:     source,
+			name:       name,
+			defaultVal: def,
+			hasDefault: hasDefault,
+			accept:     accept,
+		})
+	}
+	return fields
+}
+
+// fieldSource returns the binding source selected by the field's tags
+func fieldSource(sf reflect.StructField) string {
+	for _, source := range valueSources {
+		if name := strings.Split(sf.Tag.Get(source), ",")[0]; name != "" && name != "-" {
+			return source
+		}
+	}
+	if name := strings.Split(sf.Tag.Get(SourceJSON), ",")[0]; name != "" && name != "-" {
+		return SourceJSON
+	}
+	return ""
+}
+
+// sourceValues returns the raw values for name from the given source
+func sourceValues(r *http.Request, source, name string) ([]string, error) {
+	switch source {
+	case SourceURI:
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if value := rctx.URLParam(name); value != "" {
+				return []string{value}, nil
+			}
+		}
+		return nil, nil
+	case SourceQuery:
+		return r.URL.Query()[name], nil
+	case SourceHeader:
+		return r.Header.Values(name), nil
+	case SourceCookie:
+		var values []string
+		for _, c := range r.Cookies() {
+			if c.Name == name {
+				values = append(values, c.Value)
+			}
+		}
+		return values, nil
+	case SourceForm:
+		if r.Form == nil {
+			if err := r.ParseForm(); err != nil {
+				return nil, fmt.Errorf("error parsing form: %w", err)
+			}
+		}
+		return r.Form[name], nil
+	}
+	return nil, nil
+}
+
+// setField converts values to the type of fv and assigns them
+func setField(fv reflect.Value, values []string) error {
+	if fv.Kind() == reflect.Ptr {
+		elem := reflect.New(fv.Type().Elem())
+		if err := setField(elem.Elem(), values); err != nil {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	}
+
+	if fv.Type() == timeType {
+		t, err := parseTime(values[0])
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0]))
+	}
+
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setField(slice.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+
+	return setScalar(fv, values[0])
+}
+
+func setScalar(fv reflect.Value, value string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return errors.Unwrap(err)
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return errors.Unwrap(err)
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return errors.Unwrap(err)
+		}
+		fv.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.Unwrap(err)
+		}
+		fv.SetBool(b)
+	case reflect.Slice:
+		// []byte
+		fv.SetBytes([]byte(value))
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
+
+// parseTime accepts RFC 3339 timestamps and plain dates
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
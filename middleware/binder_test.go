@@ -0,0 +1,360 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/wangfenjin/mojito/middleware"
+)
+
+// level is a TextUnmarshaler accepting low and high
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return errors.New("unknown level")
+	}
+	return nil
+}
+
+type bindRequest struct {
+	ID      uuid.UUID  `uri:"id"`
+	Page    int        `query:"page" default:"1"`
+	Sort    string     `query:"sort" default:"name"`
+	Limit   *int       `query:"limit"`
+	Tags    []string   `query:"tag"`
+	Sizes   []int      `query:"size"`
+	Since   time.Time  `query:"since"`
+	Until   *time.Time `query:"until"`
+	Level   level      `query:"level"`
+	Token   string     `header:"X-Token"`
+	Session string     `cookie:"session"`
+	Name    string     `form:"name"`
+	Title   string     `json:"title"`
+}
+
+// withURLParam adds the chi route parameter key to r
+func withURLParam(r *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestBind(t *testing.T) {
+	id := uuid.MustParse("7c9e6679-7425-40de-944b-e07fc1f90ae7")
+	limit := 20
+	until := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	defaults := bindRequest{Page: 1, Sort: "name"}
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		want    bindRequest
+	}{
+		{
+			name:    "defaults",
+			request: func() *http.Request { return httptest.NewRequest(http.MethodGet, "/", nil) },
+			want:    defaults,
+		},
+		{
+			name: "uri",
+			request: func() *http.Request {
+				return withURLParam(httptest.NewRequest(http.MethodGet, "/", nil), "id", id.String())
+			},
+			want: bindRequest{ID: id, Page: 1, Sort: "name"},
+		},
+		{
+			name: "query",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/?page=3&sort=&limit=20&tag=a&tag=b&size=1&size=2&level=high", nil)
+			},
+			want: bindRequest{Page: 3, Sort: "name", Limit: &limit, Tags: []string{"a", "b"}, Sizes: []int{1, 2}, Level: 2},
+		},
+		{
+			name: "time",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/?since=2024-02-01T10:30:00Z&until=2024-03-01", nil)
+			},
+			want: bindRequest{Page: 1, Sort: "name", Since: time.Date(2024, 2, 1, 10, 30, 0, 0, time.UTC), Until: &until},
+		},
+		{
+			name: "header and cookie",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set("X-Token", "secret")
+				r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+				return r
+			},
+			want: bindRequest{Page: 1, Sort: "name", Token: "secret", Session: "abc"},
+		},
+		{
+			name: "form",
+			request: func() *http.Request {
+				// Body values don't bind query fields
+				form := url.Values{"name": {"Alice"}, "page": {"2"}}
+				r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				return r
+			},
+			want: bindRequest{Page: 1, Sort: "name", Name: "Alice"},
+		},
+		{
+			name: "json with charset",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/?page=2", strings.NewReader(`{"title": "Hello"}`))
+				r.Header.Set("Content-Type", "application/json; charset=utf-8")
+				return r
+			},
+			want: bindRequest{Page: 2, Sort: "name", Title: "Hello"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bindRequest
+			if err := middleware.NewBinder().Bind(tt.request(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Bind() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Note is embedded by pointer in noteRequest, its fields are promoted to the body
+type Note struct {
+	Text string `json:"text"`
+}
+
+type noteRequest struct {
+	*Note
+	Page int `query:"page" default:"1"`
+}
+
+func TestBindJSONBodyFields(t *testing.T) {
+	id := uuid.New()
+	body := `{
+		"id": "` + uuid.NewString() + `", "ID": "` + uuid.NewString() + `",
+		"page": 9, "Page": 9, "limit": 5, "Limit": 5,
+		"token": "forged", "Token": "forged", "X-Token": "forged",
+		"session": "forged", "Session": "forged",
+		"name": "Mallory", "Name": "Mallory",
+		"title": "Hello"
+	}`
+	r := withURLParam(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), "id", id.String())
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Token", "secret")
+
+	var got bindRequest
+	if err := middleware.NewBinder().Bind(r, &got); err != nil {
+		t.Fatal(err)
+	}
+	// Only the json field is read from the body
+	want := bindRequest{ID: id, Page: 1, Sort: "name", Token: "secret", Title: "Hello"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Bind() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// A body key of another source isn't a type error either
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"page": "nine", "text": "Hi"}`))
+	var req noteRequest
+	if err := middleware.NewBinder().Bind(r, &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Page != 1 || req.Note == nil || req.Text != "Hi" {
+		t.Errorf("Bind() = %+v, want the default page and the promoted text", req)
+	}
+}
+
+func TestBindConversionErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		id    string
+		query string
+		field string
+		param string
+	}{
+		{"int", "", "page=two", "page", "int"},
+		{"pointer", "", "limit=many", "limit", "*int"},
+		{"slice", "", "size=1&size=x", "size", "[]int"},
+		{"time", "", "since=yesterday", "since", "time.Time"},
+		{"uuid", "not-a-uuid", "", "id", "uuid.UUID"},
+		{"text unmarshaler", "", "level=extreme", "level", "middleware_test.level"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := withURLParam(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil), "id", tt.id)
+			var req bindRequest
+			err := middleware.NewBinder().Bind(r, &req)
+
+			var bindErr *middleware.BindError
+			if !errors.As(err, &bindErr) || len(bindErr.Errors) != 1 {
+				t.Fatalf("Bind() error = %v, want a BindError with one field", err)
+			}
+			if fe := bindErr.Errors[0]; fe.Field != tt.field || fe.Rule != "type" || fe.Param != tt.param {
+				t.Errorf("field error = %+v, want the type of %s", fe, tt.field)
+			}
+		})
+	}
+
+	// Every invalid field is reported
+	r := httptest.NewRequest(http.MethodGet, "/?page=two&limit=many", nil)
+	var bindErr *middleware.BindError
+	if err := middleware.NewBinder().Bind(r, &bindRequest{}); !errors.As(err, &bindErr) || len(bindErr.Errors) != 2 {
+		t.Errorf("Bind() error = %v, want both fields reported", err)
+	}
+}
+
+func TestBindUnsupportedMediaType(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("<title>Hello</title>"))
+	r.Header.Set("Content-Type", "application/xml")
+	if err := middleware.NewBinder().Bind(r, &bindRequest{}); !errors.Is(err, middleware.ErrUnsupportedMediaType) {
+		t.Errorf("Bind() error = %v, want ErrUnsupportedMediaType", err)
+	}
+}
+
+// pngData starts with the PNG signature, which is all http.DetectContentType looks at
+var pngData = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+// upload is a file part of a multipart request
+type upload struct {
+	field, name string
+	data        []byte
+}
+
+// multipartRequest creates a POST request with the given files
+func multipartRequest(t *testing.T, files ...upload) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, f := range files {
+		part, err := mw.CreateFormFile(f.field, f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(f.data)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+type uploadRequest struct {
+	Avatar      *multipart.FileHeader   `file:"avatar" accept:"image/png,image/jpeg"`
+	Attachments []*multipart.FileHeader `file:"attachments"`
+}
+
+func TestBindFiles(t *testing.T) {
+	r := multipartRequest(t,
+		upload{"avatar", "avatar.png", pngData},
+		upload{"attachments", "a.txt", []byte("first")},
+		upload{"attachments", "b.txt", []byte("second")},
+	)
+	var req uploadRequest
+	if err := middleware.NewBinder().Bind(r, &req); err != nil {
+		t.Fatal(err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	if req.Avatar == nil || req.Avatar.Filename != "avatar.png" || req.Avatar.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("avatar = %+v, want avatar.png sniffed as image/png", req.Avatar)
+	}
+	if len(req.Attachments) != 2 || req.Attachments[0].Filename != "a.txt" || req.Attachments[1].Filename != "b.txt" {
+		t.Fatalf("attachments = %+v, want a.txt and b.txt", req.Attachments)
+	}
+	if ct := req.Attachments[0].Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("attachment content type = %q, want it sniffed", ct)
+	}
+}
+
+func TestBindFileAccept(t *testing.T) {
+	// The client claims a PNG but sends text
+	r := multipartRequest(t, upload{"avatar", "avatar.png", []byte("not an image")})
+	var req uploadRequest
+	err := middleware.NewBinder().Bind(r, &req)
+	defer r.MultipartForm.RemoveAll()
+
+	var bindErr *middleware.BindError
+	if !errors.As(err, &bindErr) || len(bindErr.Errors) != 1 {
+		t.Fatalf("Bind() error = %v, want a BindError", err)
+	}
+	if fe := bindErr.Errors[0]; fe.Field != "avatar" || fe.Rule != "accept" || fe.Param != "image/png,image/jpeg" {
+		t.Errorf("field error = %+v, want the accept rule of avatar", fe)
+	}
+	if req.Avatar != nil {
+		t.Errorf("rejected file was bound: %+v", req.Avatar)
+	}
+}
+
+func TestBindFileTooLarge(t *testing.T) {
+	binder := middleware.NewBinder()
+	binder.MaxFileSize = 16
+	h := middleware.WithHandler(func(context.Context, uploadRequest) (any, error) {
+		t.Error("handler called with a file over the limit")
+		return nil, nil
+	})
+
+	r := multipartRequest(t, upload{"avatar", "avatar.png", pngData})
+	r = r.WithContext(middleware.NewBinderContext(r.Context(), binder))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var problem middleware.APIError
+	json.NewDecoder(w.Body).Decode(&problem)
+	if w.Code != http.StatusRequestEntityTooLarge || problem.Code != middleware.CodePayloadTooLarge {
+		t.Errorf("status = %d, code = %q, want 413 %s", w.Code, problem.Code, middleware.CodePayloadTooLarge)
+	}
+
+	// Without the binder in the context the default limit applies
+	w = httptest.NewRecorder()
+	h = middleware.WithHandler(func(context.Context, uploadRequest) (any, error) { return nil, nil })
+	h.ServeHTTP(w, multipartRequest(t, upload{"avatar", "avatar.png", pngData}))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d with the default binder, want 200", w.Code)
+	}
+}
+
+func TestHandlerRemovesUploadedFiles(t *testing.T) {
+	binder := middleware.NewBinder()
+	binder.MaxMemory = 1 // spill the files to disk
+	var avatar *multipart.FileHeader
+	h := middleware.WithHandler(func(_ context.Context, req uploadRequest) (any, error) {
+		avatar = req.Avatar
+		f, err := avatar.Open()
+		if err != nil {
+			return nil, err
+		}
+		return nil, f.Close()
+	})
+
+	r := multipartRequest(t, upload{"avatar", "avatar.png", pngData})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r.WithContext(middleware.NewBinderContext(r.Context(), binder)))
+	if w.Code != http.StatusOK || avatar == nil {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+	if f, err := avatar.Open(); err == nil {
+		f.Close()
+		t.Error("uploaded file is still on disk after the request")
+	}
+}
@@ -2,41 +2,196 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/wangfenjin/mojito/models"
+)
+
+// ProblemContentType is the media type of error responses, see RFC 9457
+const ProblemContentType = "application/problem+json"
+
+// StatusClientClosedRequest is the non-standard status used when the client went away before the response
+const StatusClientClosedRequest = 499
+
+// ErrorCode is a stable, machine-readable identifier of an error, e.g. "user.email_taken"
+type ErrorCode string
+
+// Generic error codes, domain specific codes are declared next to the handlers that return them
+const (
+	CodeBadRequest           ErrorCode = "bad_request"
+	CodeUnauthorized         ErrorCode = "unauthorized"
+	CodeTokenRevoked         ErrorCode = "auth.token_revoked"
+	CodeInactiveUser         ErrorCode = "auth.inactive_user"
+	CodeForbidden            ErrorCode = "forbidden"
+	CodeNotFound             ErrorCode = "not_found"
+	CodeConflict             ErrorCode = "conflict"
+	CodePayloadTooLarge      ErrorCode = "payload_too_large"
+	CodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	CodeValidationFailed     ErrorCode = "validation_failed"
+	CodeRateLimited          ErrorCode = "rate_limited"
+	CodeRequestCanceled      ErrorCode = "request_canceled"
+	CodeInternal             ErrorCode = "internal_error"
+	CodeUnavailable          ErrorCode = "service_unavailable"
 )
 
-// APIError represents an error that can be returned by the API
+// ProblemTypeBase prefixes error codes to build the problem "type" URI
+var ProblemTypeBase = "urn:mojito:problem:"
+
+// APIError represents an error that can be returned by the API.
+// It is rendered as an RFC 9457 problem details object.
 type APIError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      ErrorCode    `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	// Extensions are additional members serialized at the top level of the problem object
+	Extensions map[string]any `json:"-"`
 }
 
 // Error implement error interface for APIError
 func (e *APIError) Error() string {
-	return fmt.Sprintf("code: %d, message: %s", e.Code, e.Message)
+	return fmt.Sprintf("status: %d, code: %s, detail: %s", e.Status, e.Code, e.Detail)
+}
+
+// MarshalJSON flattens Extensions into the problem object
+func (e *APIError) MarshalJSON() ([]byte, error) {
+	type problem APIError
+	data, err := json.Marshal((*problem)(e))
+	if err != nil || len(e.Extensions) == 0 {
+		return data, err
+	}
+
+	merged := make(map[string]any, len(e.Extensions))
+	maps.Copy(merged, e.Extensions)
+	var members map[string]any
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	// Standard members win over extensions with the same name
+	maps.Copy(merged, members)
+	return json.Marshal(merged)
+}
+
+// WithCode sets a domain specific error code, which also determines the problem type
+func (e *APIError) WithCode(code ErrorCode) *APIError {
+	e.Code = code
+	e.Type = ProblemTypeBase + string(code)
+	return e
+}
+
+// WithExtension adds an extension member to the problem object
+func (e *APIError) WithExtension(key string, value any) *APIError {
+	if e.Extensions == nil {
+		e.Extensions = make(map[string]any)
+	}
+	e.Extensions[key] = value
+	return e
+}
+
+// NewError creates a new API error with the given status, code and detail message
+func NewError(status int, code ErrorCode, detail string) *APIError {
+	title := http.StatusText(status)
+	if status == StatusClientClosedRequest {
+		title = "Client Closed Request"
+	}
+	return (&APIError{
+		Title:  title,
+		Status: status,
+		Detail: detail,
+	}).WithCode(code)
 }
 
 // NewUnauthorizedError creates a new unauthorized error
 func NewUnauthorizedError(message string) *APIError {
-	return &APIError{
-		Code:    http.StatusUnauthorized,
-		Message: message,
-	}
+	return NewError(http.StatusUnauthorized, CodeUnauthorized, message)
 }
 
 // NewBadRequestError creates a new bad request error
 func NewBadRequestError(message string) *APIError {
-	return &APIError{
-		Code:    http.StatusBadRequest,
-		Message: message,
-	}
+	return NewError(http.StatusBadRequest, CodeBadRequest, message)
 }
 
 // NewForbiddenError creates a new forbidden error
 func NewForbiddenError(message string) *APIError {
-	return &APIError{
-		Code:    http.StatusForbidden,
-		Message: message,
+	return NewError(http.StatusForbidden, CodeForbidden, message)
+}
+
+// NewNotFoundError creates a new not found error
+func NewNotFoundError(message string) *APIError {
+	return NewError(http.StatusNotFound, CodeNotFound, message)
+}
+
+// NewConflictError creates a new conflict error
+func NewConflictError(message string) *APIError {
+	return NewError(http.StatusConflict, CodeConflict, message)
+}
+
+// NewValidationError creates a new validation error with field level details
+func NewValidationError(message string, errs []FieldError) *APIError {
+	apiErr := NewError(http.StatusUnprocessableEntity, CodeValidationFailed, message)
+	apiErr.Errors = errs
+	return apiErr
+}
+
+// NewTooManyRequestsError creates a new rate limit error, retryAfter is in seconds
+func NewTooManyRequestsError(message string, retryAfter int) *APIError {
+	apiErr := NewError(http.StatusTooManyRequests, CodeRateLimited, message)
+	if retryAfter > 0 {
+		apiErr.WithExtension("retry_after", retryAfter)
+	}
+	return apiErr
+}
+
+// NewInternalError creates a new internal server error
+func NewInternalError(message string) *APIError {
+	return NewError(http.StatusInternalServerError, CodeInternal, message)
+}
+
+// ToAPIError translates an error returned by a handler into an APIError.
+// Database errors are mapped to matching statuses, anything unknown becomes a 500
+// carrying a correlation id instead of the internal error message.
+func ToAPIError(ctx context.Context, err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var dbErr *models.DBError
+	if errors.As(models.TranslateError(err), &dbErr) {
+		switch dbErr.Kind {
+		case models.ErrNotFound:
+			return NewNotFoundError("resource not found")
+		case models.ErrUniqueViolation:
+			return NewConflictError(dbErr.Message())
+		case models.ErrForeignKey:
+			return NewValidationError(dbErr.Message(), nil)
+		case models.ErrCanceled:
+			return NewError(StatusClientClosedRequest, CodeRequestCanceled, "request canceled")
+		case models.ErrTimeout:
+			return NewError(http.StatusServiceUnavailable, CodeUnavailable, "service temporarily unavailable")
+		}
+	}
+
+	apiErr = NewInternalError("internal server error")
+	apiErr.RequestID = requestID(ctx)
+	return apiErr
+}
+
+// requestID returns the id assigned by the RequestID middleware, or a fresh one
+func requestID(ctx context.Context) string {
+	if id := chimw.GetReqID(ctx); id != "" {
+		return id
 	}
+	return uuid.NewString()
 }
@@ -3,221 +3,186 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"reflect"
-	"strconv"
 
-	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/httplog/v2"
-	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/wangfenjin/mojito/common"
 	"github.com/wangfenjin/mojito/models"
 	"github.com/wangfenjin/mojito/openapi"
 )
 
-var validate = validator.New()
-
-// WithHandler creates middleware that handles both request parsing and response writing
-func WithHandler[Req any, Resp any](handler func(ctx context.Context, req Req) (Resp, error)) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		logger := httplog.LogEntry(ctx)
-
-		pattern := chi.RouteContext(ctx).RoutePattern()
-		openapi.RegisterHandler(r.Method, pattern, handler)
-
-		var req Req
-		reqType := reflect.TypeOf(req)
-
-		if reqType != nil && reqType.Kind() == reflect.Struct && reqType.NumField() > 0 {
-
-			// Parse HTTP headers
-			reqValue := reflect.ValueOf(&req).Elem()
-			for i := 0; i < reqType.NumField(); i++ {
-				field := reqType.Field(i)
-				headerTag := field.Tag.Get("header")
-				if headerTag != "" {
-					headerValue := r.Header.Get(headerTag)
-					if headerValue != "" {
-						fieldValue := reqValue.Field(i)
-						if fieldValue.CanSet() {
-							fieldValue.SetString(headerValue)
-						}
-					}
-				}
-			}
+// DefaultBinder is the Binder used by WithHandler when the request carries none, see NewBinderContext
+var DefaultBinder = NewBinder()
 
-			contentType := r.Header.Get("Content-Type")
-			if contentType == "application/x-www-form-urlencoded" {
-				if err := r.ParseForm(); err != nil {
-					logger.Error("Form parse error", "error", err)
-					respondWithError(w, NewBadRequestError(err.Error()))
-					return
-				}
-
-				// Iterate through form values and set corresponding struct fields
-				reqValue := reflect.ValueOf(&req).Elem()
-				for i := 0; i < reqType.NumField(); i++ {
-					field := reqType.Field(i)
-					formTag := field.Tag.Get("form")
-					if formTag != "" {
-						// Extract the field name from the form tag (remove binding info)
-						fieldName := formTag
-						if idx := fieldName; idx != "" {
-							formValue := r.FormValue(fieldName)
-							if formValue != "" {
-								fieldValue := reqValue.Field(i)
-								if fieldValue.CanSet() {
-									fieldValue.SetString(formValue)
-								}
-							}
-						}
-					}
-				}
-			} else if r.Method != http.MethodGet && r.ContentLength > 0 {
-				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-					logger.Error("Decode error", "error", err)
-					respondWithError(w, NewBadRequestError(err.Error()))
-					return
-				}
-			} else {
-				// Parse query parameters
-				queryValues := r.URL.Query()
-				if queryValues != nil && len(queryValues) > 0 {
-					for i := 0; i < reqType.NumField(); i++ {
-						field := reqType.Field(i)
-						queryTag := field.Tag.Get("query")
-						if queryTag == "" {
-							continue
-						}
-						if value := queryValues.Get(queryTag); value != "" {
-							fieldValue := reqValue.Field(i)
-							if fieldValue.CanSet() {
-								// Convert string value to appropriate type
-								switch fieldValue.Kind() {
-								case reflect.String:
-									fieldValue.SetString(value)
-								case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-									if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
-										fieldValue.SetInt(intVal)
-									}
-								case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-									if uintVal, err := strconv.ParseUint(value, 10, 64); err == nil {
-										fieldValue.SetUint(uintVal)
-									}
-								case reflect.Float32, reflect.Float64:
-									if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
-										fieldValue.SetFloat(floatVal)
-									}
-								case reflect.Bool:
-									if boolVal, err := strconv.ParseBool(value); err == nil {
-										fieldValue.SetBool(boolVal)
-									}
-								}
-							}
-						}
-					}
-				}
-			}
-			if rctx := chi.RouteContext(ctx); rctx != nil {
-				urlParams := make(map[string]string)
-				for i, key := range rctx.URLParams.Keys {
-					if key != "*" {
-						urlParams[key] = rctx.URLParams.Values[i]
-					}
-				}
-
-				// Map URL parameters to struct fields with uri tag
-				for i := 0; i < reqType.NumField(); i++ {
-					field := reqType.Field(i)
-					uriTag := field.Tag.Get("uri")
-					if uriTag != "" {
-						// Extract the parameter name from the uri tag
-						paramName := uriTag
-						if value, ok := urlParams[paramName]; ok && value != "" {
-							fieldValue := reqValue.Field(i)
-							if fieldValue.CanSet() {
-								fieldValue.SetString(value)
-							}
-						}
-					}
-				}
-
-				// Also try to map URL parameters by field name for backward compatibility
-				for paramName, value := range urlParams {
-					field := reqValue.FieldByName(paramName)
-					if field.IsValid() && field.CanSet() {
-						field.SetString(value)
-					}
-				}
-			}
+type binderKey struct{}
 
-			// Validate request
-			if err := validate.Struct(req); err != nil {
-				logger.Error("Validation error", "error", err)
-				respondWithError(w, NewBadRequestError(err.Error()))
-				return
-			}
+// NewBinderContext returns a copy of ctx carrying b, which handlers bind requests with
+func NewBinderContext(ctx context.Context, b *Binder) context.Context {
+	return context.WithValue(ctx, binderKey{}, b)
+}
+
+// BinderFrom returns the Binder stored in ctx, or DefaultBinder
+func BinderFrom(ctx context.Context) *Binder {
+	if b, ok := ctx.Value(binderKey{}).(*Binder); ok && b != nil {
+		return b
+	}
+	return DefaultBinder
+}
+
+// Handler serves a typed handler: it binds and validates the request, calls the handler
+// and writes its response or error. Mount it with chi's Method, the OpenAPI generator
+// finds it when walking the router.
+type Handler[Req any, Resp any] struct {
+	handler func(ctx context.Context, req Req) (Resp, error)
+	options []openapi.Option
+}
+
+// WithHandler creates a Handler that handles both request parsing and response writing.
+// The options document the operation on top of the annotations of the handler's doc comment.
+func WithHandler[Req any, Resp any](handler func(ctx context.Context, req Req) (Resp, error), options ...openapi.Option) *Handler[Req, Resp] {
+	return &Handler[Req, Resp]{handler: handler, options: options}
+}
+
+// Describe implements openapi.Describer
+func (h *Handler[Req, Resp]) Describe(method, pattern string) openapi.FuncInfo {
+	fi := openapi.Describe(method, pattern, h.handler)
+	fi.RequestFields = DefaultBinder.RequestFields(fi.RequestType)
+	for _, option := range h.options {
+		option(&fi)
+	}
+	return fi
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler[Req, Resp]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := httplog.LogEntry(ctx)
+
+	var req Req
+	reqType := reflect.TypeOf(req)
 
+	if reqType != nil && reqType.Kind() == reflect.Struct && reqType.NumField() > 0 {
+		// Bind uri, query, header, cookie, form and body values
+		err := BinderFrom(ctx).Bind(r, &req)
+		// The server only removes the temporary files of the request it created
+		if r.MultipartForm != nil {
+			defer r.MultipartForm.RemoveAll()
 		}
-		// Call handler
-		resp, err := handler(ctx, req)
 		if err != nil {
-			logger.Error("Handler error", "error", err)
-			if apiErr, ok := err.(*APIError); ok {
-				respondWithError(w, apiErr)
-			} else {
-				respondWithError(w, NewBadRequestError(err.Error()))
-			}
+			logger.Error("Bind error", "error", err)
+			respondWithError(w, r, bindErrorToAPIError(err))
 			return
 		}
 
-		// Write response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			logger.Error("Encode error", "error", err)
-			respondWithError(w, NewBadRequestError(err.Error()))
+		// Validate request against its binding tags
+		if apiErr := validateRequest(req); apiErr != nil {
+			logger.Error("Validation error", "error", apiErr)
+			respondWithError(w, r, apiErr)
 			return
 		}
 	}
-}
+	// Call handler
+	resp, err := h.handler(ctx, req)
+	if err != nil {
+		apiErr := ToAPIError(ctx, err)
+		logger.Error("Handler error", "error", err, "status", apiErr.Status, "code", apiErr.Code)
+		respondWithError(w, r, apiErr)
+		return
+	}
 
-// Helper function to respond with an error
-func respondWithError(w http.ResponseWriter, err *APIError) {
+	// Write response
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(err.Code)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("Encode error", "error", err)
+		respondWithError(w, r, NewBadRequestError(err.Error()))
+		return
+	}
+}
+
+// bindErrorToAPIError converts an error returned by Binder.Bind to an APIError
+func bindErrorToAPIError(err error) *APIError {
+	var bindErr *BindError
+	if errors.As(err, &bindErr) {
+		apiErr := NewBadRequestError("invalid request parameters")
+		apiErr.Errors = bindErr.Errors
+		return apiErr
+	}
+	if errors.Is(err, ErrRequestTooLarge) {
+		return NewError(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, err.Error())
+	}
+	if errors.Is(err, ErrUnsupportedMediaType) {
+		return NewError(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, err.Error())
+	}
+	return NewBadRequestError(err.Error())
+}
+
+// Helper function to respond with an RFC 9457 problem details error
+func respondWithError(w http.ResponseWriter, r *http.Request, err *APIError) {
+	if err.Instance == "" {
+		err.Instance = r.URL.Path
+	}
+	if err.RequestID == "" {
+		err.RequestID = requestID(r.Context())
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(err.Status)
 	json.NewEncoder(w).Encode(err)
 }
 
-// RequireAuth creates middleware that requires authentication
-func RequireAuth() func(http.Handler) http.Handler {
+// RequireAuth creates middleware that requires authentication.
+// Tokens are checked with tokens and their user is loaded from users.
+func RequireAuth(tokens *common.TokenService, users models.UserRepository) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			token := r.Header.Get("Authorization")
 			if token == "" {
-				respondWithError(w, NewUnauthorizedError("Authorization header is required"))
+				respondWithError(w, r, NewUnauthorizedError("Authorization header is required"))
 				return
 			}
 
 			// Extract token from "Bearer <token>"
 			if len(token) < 7 || token[:7] != "Bearer " {
-				respondWithError(w, NewUnauthorizedError("Invalid Authorization header"))
+				respondWithError(w, r, NewUnauthorizedError("Invalid Authorization header"))
 				return
 			}
 			token = token[7:]
 
-			claims, err := common.ValidateToken(token)
+			claims, err := tokens.ValidateToken(token)
 			if err != nil {
-				respondWithError(w, NewUnauthorizedError(err.Error()))
+				httplog.LogEntrySetField(r.Context(), "error", slog.StringValue(err.Error()))
+				respondWithError(w, r, NewUnauthorizedError("invalid token"))
 				return
 			}
-			db := models.GetDB()
 			userID, err := uuid.Parse(claims.UserID)
-			user, err := db.GetUserByID(r.Context(), userID)
 			if err != nil {
-				respondWithError(w, NewUnauthorizedError(err.Error()))
+				respondWithError(w, r, NewUnauthorizedError("invalid user id in token"))
+				return
+			}
+			user, err := users.GetUserByID(r.Context(), userID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				respondWithError(w, r, NewUnauthorizedError("user not found"))
+				return
+			}
+			if err != nil {
+				// A database failure isn't a reason to log in again
+				apiErr := ToAPIError(r.Context(), err)
+				httplog.LogEntry(r.Context()).Error("error loading authenticated user", "error", err, "status", apiErr.Status)
+				respondWithError(w, r, apiErr)
+				return
+			}
+			if !user.IsActive {
+				respondWithError(w, r, NewUnauthorizedError("inactive user").WithCode(CodeInactiveUser))
+				return
+			}
+			// Tokens issued before a password change, deactivation or sign out are rejected
+			if claims.TokenVersion != user.TokenVersion {
+				respondWithError(w, r, NewUnauthorizedError("token has been revoked").WithCode(CodeTokenRevoked))
 				return
 			}
 			claims.IsSuperUser = user.IsSuperuser
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// bindingTag is the struct tag that carries validation rules for request structs
+const bindingTag = "binding"
+
+// fieldNameTags are consulted in order to find the public name of a request field
+var fieldNameTags = []string{"json", "form", "query", "uri", "header", "cookie"}
+
+var validate = newValidator()
+
+// FieldError describes a single field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.SetTagName(bindingTag)
+	// Report fields by the name the client used instead of the Go field name
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return fieldName(field)
+	})
+	return v
+}
+
+// fieldName returns the name a client uses to address the struct field
+func fieldName(field reflect.StructField) string {
+	for _, tag := range fieldNameTags {
+		value, ok := field.Tag.Lookup(tag)
+		if !ok {
+			continue
+		}
+		name := strings.Split(value, ",")[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// validateRequest checks req against its binding tags and converts failures to an APIError
+func validateRequest(req any) *APIError {
+	err := validate.Struct(req)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return NewBadRequestError(err.Error())
+	}
+
+	fieldErrs := make([]FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		fieldErrs = append(fieldErrs, FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: validationMessage(fe),
+		})
+	}
+	return NewValidationError("request validation failed", fieldErrs)
+}
+
+// validationMessage builds a human readable message for a failed rule
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", fe.Field())
+	case "uuid", "uuid4":
+		return fmt.Sprintf("%s must be a valid UUID", fe.Field())
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at least %s characters long", fe.Field(), fe.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s", fe.Field(), fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at most %s characters long", fe.Field(), fe.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s", fe.Field(), fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of [%s]", fe.Field(), fe.Param())
+	default:
+		return fmt.Sprintf("%s failed on the '%s' rule", fe.Field(), fe.Tag())
+	}
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres SQLSTATE codes we translate, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgQueryCanceled       = "57014"
+)
+
+// Errors returned by TranslateError. Use errors.Is to check for them.
+var (
+	ErrNotFound          = errors.New("record not found")
+	ErrUniqueViolation   = errors.New("record already exists")
+	ErrForeignKey        = errors.New("referenced record does not exist")
+	ErrCanceled          = errors.New("request canceled")
+	ErrTimeout           = errors.New("database timeout")
+	ErrDatabaseInternals = errors.New("database error")
+)
+
+// ConstraintUserEmail is the unique index on user emails
+const ConstraintUserEmail = "ix_user_email"
+
+// constraintMessages gives client facing messages for named constraints in the migrations
+var constraintMessages = map[string]string{
+	ConstraintUserEmail: "email already exists",
+	"fk_item_owner":     "item owner does not exist",
+}
+
+// DBError is a database error classified into one of the Err* kinds above
+type DBError struct {
+	Kind       error
+	Constraint string
+	Err        error
+}
+
+// Error implement error interface for DBError
+func (e *DBError) Error() string {
+	if e.Constraint != "" {
+		return fmt.Sprintf("%v (%s): %v", e.Kind, e.Constraint, e.Err)
+	}
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+// Unwrap returns both the kind and the original error so errors.Is matches either
+func (e *DBError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Message returns a message that is safe to show to clients
+func (e *DBError) Message() string {
+	if msg, ok := constraintMessages[e.Constraint]; ok {
+		return msg
+	}
+	return e.Kind.Error()
+}
+
+// TranslateError classifies err coming from pgx into a *DBError.
+// Errors that are not database errors are returned unchanged.
+func TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var dbErr *DBError
+	if errors.As(err, &dbErr) {
+		return dbErr
+	}
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return &DBError{Kind: ErrNotFound, Err: err}
+	case errors.Is(err, context.Canceled):
+		return &DBError{Kind: ErrCanceled, Err: err}
+	case errors.Is(err, context.DeadlineExceeded), pgconn.Timeout(err):
+		return &DBError{Kind: ErrTimeout, Err: err}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return &DBError{Kind: ErrUniqueViolation, Constraint: pgErr.ConstraintName, Err: err}
+		case pgForeignKeyViolation:
+			return &DBError{Kind: ErrForeignKey, Constraint: pgErr.ConstraintName, Err: err}
+		case pgQueryCanceled:
+			return &DBError{Kind: ErrTimeout, Err: err}
+		default:
+			return &DBError{Kind: ErrDatabaseInternals, Constraint: pgErr.ConstraintName, Err: err}
+		}
+	}
+
+	return err
+}
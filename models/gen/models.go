@@ -18,13 +18,49 @@ type Item struct {
 	UpdatedAt   pgtype.Timestamptz
 }
 
+type Outbox struct {
+	ID          uuid.UUID
+	Topic       string
+	Payload     []byte
+	Status      string
+	Attempts    int32
+	AvailableAt pgtype.Timestamptz
+	LastError   pgtype.Text
+	CreatedAt   pgtype.Timestamptz
+	DeliveredAt pgtype.Timestamptz
+}
+
+type RefreshToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	FamilyID   uuid.UUID
+	TokenHash  string
+	ExpiresAt  pgtype.Timestamptz
+	RevokedAt  pgtype.Timestamptz
+	ReplacedBy pgtype.UUID
+	CreatedAt  pgtype.Timestamptz
+}
+
 type User struct {
-	ID             uuid.UUID
-	Email          string
-	HashedPassword string
-	IsActive       bool
-	IsSuperuser    bool
-	FullName       pgtype.Text
-	CreatedAt      pgtype.Timestamptz
-	UpdatedAt      pgtype.Timestamptz
+	ID              uuid.UUID
+	Email           string
+	HashedPassword  string
+	IsActive        bool
+	IsSuperuser     bool
+	FullName        pgtype.Text
+	CreatedAt       pgtype.Timestamptz
+	UpdatedAt       pgtype.Timestamptz
+	TokenVersion    int32
+	EmailVerifiedAt pgtype.Timestamptz
+}
+
+type UserToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Purpose   string
+	TokenHash string
+	ExpiresAt pgtype.Timestamptz
+	UsedAt    pgtype.Timestamptz
+	CreatedAt pgtype.Timestamptz
+	NewEmail  pgtype.Text
 }
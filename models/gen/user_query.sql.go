@@ -12,6 +12,37 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const changeUserEmail = `-- name: ChangeUserEmail :one
+UPDATE public."user" SET
+    email = $2,
+    email_verified_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at, token_version, email_verified_at
+`
+
+type ChangeUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) ChangeUserEmail(ctx context.Context, arg ChangeUserEmailParams) (User, error) {
+	row := q.db.QueryRow(ctx, changeUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsActive,
+		&i.IsSuperuser,
+		&i.FullName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TokenVersion,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO public."user" (
     id,
@@ -19,19 +50,21 @@ INSERT INTO public."user" (
     hashed_password,
     is_active,
     is_superuser,
-    full_name
+    full_name,
+    email_verified_at
 ) VALUES (
-    $1, $2, $3, $4, $5, $6
-) RETURNING id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at
+    $1, $2, $3, $4, $5, $6, $7
+) RETURNING id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at, token_version, email_verified_at
 `
 
 type CreateUserParams struct {
-	ID             uuid.UUID
-	Email          string
-	HashedPassword string
-	IsActive       bool
-	IsSuperuser    bool
-	FullName       pgtype.Text
+	ID              uuid.UUID
+	Email           string
+	HashedPassword  string
+	IsActive        bool
+	IsSuperuser     bool
+	FullName        pgtype.Text
+	EmailVerifiedAt pgtype.Timestamptz
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
@@ -42,6 +75,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		arg.IsActive,
 		arg.IsSuperuser,
 		arg.FullName,
+		arg.EmailVerifiedAt,
 	)
 	var i User
 	err := row.Scan(
@@ -53,15 +87,18 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.FullName,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.TokenVersion,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const deleteUser = `-- name: DeleteUser :exec
 UPDATE public."user" SET
-    is_active = false
+    is_active = false,
+    token_version = token_version + 1
 WHERE id = $1
-RETURNING id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at
+RETURNING id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at, token_version, email_verified_at
 `
 
 func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
@@ -70,7 +107,7 @@ func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at FROM public."user" WHERE email = $1 LIMIT 1
+SELECT id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at, token_version, email_verified_at FROM public."user" WHERE email = $1 LIMIT 1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -85,12 +122,14 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.FullName,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.TokenVersion,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at FROM public."user" WHERE id = $1 LIMIT 1
+SELECT id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at, token_version, email_verified_at FROM public."user" WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
@@ -105,10 +144,26 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.FullName,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.TokenVersion,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
+const incrementUserTokenVersion = `-- name: IncrementUserTokenVersion :one
+UPDATE public."user" SET
+    token_version = token_version + 1
+WHERE id = $1
+RETURNING token_version
+`
+
+func (q *Queries) IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, incrementUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
 const isUserEmailExists = `-- name: IsUserEmailExists :one
 SELECT EXISTS (
     SELECT 1 
@@ -125,7 +180,7 @@ func (q *Queries) IsUserEmailExists(ctx context.Context, email string) (bool, er
 }
 
 const listUsers = `-- name: ListUsers :many
-SELECT id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at FROM public."user" 
+SELECT id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at, token_version, email_verified_at FROM public."user" 
 ORDER BY email
 LIMIT $1 
 OFFSET $2
@@ -154,6 +209,8 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 			&i.FullName,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.TokenVersion,
+			&i.EmailVerifiedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -165,6 +222,31 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 	return items, nil
 }
 
+const markUserEmailVerified = `-- name: MarkUserEmailVerified :one
+UPDATE public."user" SET
+    email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+WHERE id = $1
+RETURNING id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at, token_version, email_verified_at
+`
+
+func (q *Queries) MarkUserEmailVerified(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, markUserEmailVerified, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsActive,
+		&i.IsSuperuser,
+		&i.FullName,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TokenVersion,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE public."user" SET
     email = COALESCE($2, email),
@@ -173,7 +255,7 @@ UPDATE public."user" SET
     is_superuser = COALESCE($5, is_superuser),
     hashed_password = COALESCE($6, hashed_password)
 WHERE id = $1
-RETURNING id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at
+RETURNING id, email, hashed_password, is_active, is_superuser, full_name, created_at, updated_at, token_version, email_verified_at
 `
 
 type UpdateUserParams struct {
@@ -204,6 +286,8 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.FullName,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.TokenVersion,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/wangfenjin/mojito/models/gen"
+)
+
+// CreateItem implements gen.Querier
+func (q *querier) CreateItem(ctx context.Context, arg gen.CreateItemParams) (gen.Item, error) {
+	var item gen.Item
+	err := q.write(ctx, func(t *tables) error {
+		if _, ok := t.items[arg.ID]; ok {
+			return uniqueError("item", "item_pkey")
+		}
+		if _, ok := t.users[arg.OwnerID]; !ok {
+			return foreignKeyError("item", "fk_item_owner")
+		}
+		now := q.timestamp()
+		item = gen.Item{
+			ID:          arg.ID,
+			OwnerID:     arg.OwnerID,
+			Title:       arg.Title,
+			Description: arg.Description,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		t.items[arg.ID] = item
+		return nil
+	})
+	return item, err
+}
+
+// DeleteItem implements gen.Querier
+func (q *querier) DeleteItem(ctx context.Context, id uuid.UUID) error {
+	return q.write(ctx, func(t *tables) error {
+		delete(t.items, id)
+		return nil
+	})
+}
+
+// GetItemByID implements gen.Querier
+func (q *querier) GetItemByID(ctx context.Context, id uuid.UUID) (gen.Item, error) {
+	var item gen.Item
+	err := q.read(ctx, func(t *tables) error {
+		i, ok := t.items[id]
+		if !ok {
+			return pgx.ErrNoRows
+		}
+		item = i
+		return nil
+	})
+	return item, err
+}
+
+// ListItemsByOwner implements gen.Querier, the newest items come first
+func (q *querier) ListItemsByOwner(ctx context.Context, arg gen.ListItemsByOwnerParams) ([]gen.Item, error) {
+	var items []gen.Item
+	err := q.read(ctx, func(t *tables) error {
+		var owned []gen.Item
+		for _, i := range t.items {
+			if i.OwnerID == arg.OwnerID {
+				owned = append(owned, i)
+			}
+		}
+		slices.SortFunc(owned, func(a, b gen.Item) int {
+			if c := b.CreatedAt.Time.Compare(a.CreatedAt.Time); c != 0 {
+				return c
+			}
+			return bytes.Compare(a.ID[:], b.ID[:])
+		})
+		items = page(owned, arg.Limit, arg.Offset)
+		return nil
+	})
+	return items, err
+}
+
+// UpdateItem implements gen.Querier. The title is always set, the description only when valid.
+func (q *querier) UpdateItem(ctx context.Context, arg gen.UpdateItemParams) (gen.Item, error) {
+	var item gen.Item
+	err := q.write(ctx, func(t *tables) error {
+		i, ok := t.items[arg.ID]
+		if !ok {
+			return pgx.ErrNoRows
+		}
+		i.Title = arg.Title
+		if arg.Description.Valid {
+			i.Description = arg.Description
+		}
+		i.UpdatedAt = q.timestamp()
+		t.items[arg.ID] = i
+		item = i
+		return nil
+	})
+	return item, err
+}
@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/wangfenjin/mojito/models/gen"
+)
+
+// Outbox statuses, see outbox.Status*
+const (
+	outboxPending   = "pending"
+	outboxDelivered = "delivered"
+	outboxDead      = "dead"
+)
+
+// updateOutbox applies fn to an outbox message, missing messages are ignored
+func (q *querier) updateOutbox(ctx context.Context, id uuid.UUID, fn func(m *gen.Outbox)) error {
+	return q.write(ctx, func(t *tables) error {
+		if m, ok := t.outbox[id]; ok {
+			fn(&m)
+			t.outbox[id] = m
+		}
+		return nil
+	})
+}
+
+// ClaimOutbox implements gen.Querier. Due pending messages are hidden for the lease and returned oldest first.
+func (q *querier) ClaimOutbox(ctx context.Context, arg gen.ClaimOutboxParams) ([]gen.Outbox, error) {
+	var claimed []gen.Outbox
+	err := q.write(ctx, func(t *tables) error {
+		now := q.store.now()
+		var due []gen.Outbox
+		for _, m := range t.outbox {
+			if m.Status == outboxPending && !m.AvailableAt.Time.After(now) {
+				due = append(due, m)
+			}
+		}
+		slices.SortFunc(due, func(a, b gen.Outbox) int {
+			if c := a.AvailableAt.Time.Compare(b.AvailableAt.Time); c != 0 {
+				return c
+			}
+			return bytes.Compare(a.ID[:], b.ID[:])
+		})
+		claimed = page(due, int64(arg.BatchSize), 0)
+
+		lease := now.Add(time.Duration(arg.LeaseSeconds * float64(time.Second)))
+		for i := range claimed {
+			claimed[i].Attempts++
+			claimed[i].AvailableAt = pgtype.Timestamptz{Time: lease, Valid: true}
+			t.outbox[claimed[i].ID] = claimed[i]
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+// CountOutboxByStatus implements gen.Querier
+func (q *querier) CountOutboxByStatus(ctx context.Context) ([]gen.CountOutboxByStatusRow, error) {
+	var rows []gen.CountOutboxByStatusRow
+	err := q.read(ctx, func(t *tables) error {
+		byStatus := make(map[string]*gen.CountOutboxByStatusRow)
+		for _, m := range t.outbox {
+			row, ok := byStatus[m.Status]
+			if !ok {
+				row = &gen.CountOutboxByStatusRow{Status: m.Status, Oldest: m.CreatedAt}
+				byStatus[m.Status] = row
+			}
+			row.Count++
+			if m.CreatedAt.Time.Before(row.Oldest.Time) {
+				row.Oldest = m.CreatedAt
+			}
+		}
+		for _, row := range byStatus {
+			rows = append(rows, *row)
+		}
+		slices.SortFunc(rows, func(a, b gen.CountOutboxByStatusRow) int { return strings.Compare(a.Status, b.Status) })
+		return nil
+	})
+	return rows, err
+}
+
+// DeadLetterOutbox implements gen.Querier
+func (q *querier) DeadLetterOutbox(ctx context.Context, arg gen.DeadLetterOutboxParams) error {
+	return q.updateOutbox(ctx, arg.ID, func(m *gen.Outbox) {
+		m.Status = outboxDead
+		m.LastError = arg.LastError
+		m.Payload = nil
+	})
+}
+
+// EnqueueOutbox implements gen.Querier
+func (q *querier) EnqueueOutbox(ctx context.Context, arg gen.EnqueueOutboxParams) error {
+	return q.write(ctx, func(t *tables) error {
+		if _, ok := t.outbox[arg.ID]; ok {
+			return uniqueError("outbox", "outbox_pkey")
+		}
+		now := q.timestamp()
+		t.outbox[arg.ID] = gen.Outbox{
+			ID:          arg.ID,
+			Topic:       arg.Topic,
+			Payload:     bytes.Clone(arg.Payload),
+			Status:      outboxPending,
+			AvailableAt: now,
+			CreatedAt:   now,
+		}
+		return nil
+	})
+}
+
+// ListOutboxByStatus implements gen.Querier, the newest messages come first
+func (q *querier) ListOutboxByStatus(ctx context.Context, arg gen.ListOutboxByStatusParams) ([]gen.Outbox, error) {
+	var msgs []gen.Outbox
+	err := q.read(ctx, func(t *tables) error {
+		var matching []gen.Outbox
+		for _, m := range t.outbox {
+			if m.Status == arg.Status {
+				matching = append(matching, m)
+			}
+		}
+		slices.SortFunc(matching, func(a, b gen.Outbox) int { return b.CreatedAt.Time.Compare(a.CreatedAt.Time) })
+		msgs = page(matching, arg.Limit, 0)
+		return nil
+	})
+	return msgs, err
+}
+
+// MarkOutboxDelivered implements gen.Querier
+func (q *querier) MarkOutboxDelivered(ctx context.Context, id uuid.UUID) error {
+	return q.updateOutbox(ctx, id, func(m *gen.Outbox) {
+		m.Status = outboxDelivered
+		m.DeliveredAt = q.timestamp()
+		m.LastError = pgtype.Text{}
+		m.Payload = nil
+	})
+}
+
+// PurgeOutbox implements gen.Querier, it deletes the messages delivered before deliveredAt
+func (q *querier) PurgeOutbox(ctx context.Context, deliveredAt pgtype.Timestamptz) (int64, error) {
+	var purged int64
+	err := q.write(ctx, func(t *tables) error {
+		for id, m := range t.outbox {
+			if m.Status == outboxDelivered && m.DeliveredAt.Time.Before(deliveredAt.Time) {
+				delete(t.outbox, id)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// RetryOutbox implements gen.Querier
+func (q *querier) RetryOutbox(ctx context.Context, arg gen.RetryOutboxParams) error {
+	return q.updateOutbox(ctx, arg.ID, func(m *gen.Outbox) {
+		m.AvailableAt = arg.AvailableAt
+		m.LastError = arg.LastError
+	})
+}
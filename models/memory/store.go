@@ -0,0 +1,224 @@
+// Package memory implements models.Store in memory, for tests and local demos.
+// Queries follow the semantics of their SQL in models/*_query.sql, including the
+// unique and foreign key constraints of the migrations, and fail with the same
+// pgx errors so models.TranslateError classifies them like Postgres errors.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/wangfenjin/mojito/models"
+	"github.com/wangfenjin/mojito/models/gen"
+)
+
+// Postgres SQLSTATE codes of constraint violations
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// tables holds the rows of every table
+type tables struct {
+	users         map[uuid.UUID]gen.User
+	items         map[uuid.UUID]gen.Item
+	refreshTokens map[uuid.UUID]gen.RefreshToken
+	userTokens    map[uuid.UUID]gen.UserToken
+	outbox        map[uuid.UUID]gen.Outbox
+}
+
+func newTables() *tables {
+	return &tables{
+		users:         make(map[uuid.UUID]gen.User),
+		items:         make(map[uuid.UUID]gen.Item),
+		refreshTokens: make(map[uuid.UUID]gen.RefreshToken),
+		userTokens:    make(map[uuid.UUID]gen.UserToken),
+		outbox:        make(map[uuid.UUID]gen.Outbox),
+	}
+}
+
+// clone copies the tables so a transaction can change them without affecting the store.
+// Rows are values, outbox payloads are shared but never modified in place.
+func (t *tables) clone() *tables {
+	return &tables{
+		users:         maps.Clone(t.users),
+		items:         maps.Clone(t.items),
+		refreshTokens: maps.Clone(t.refreshTokens),
+		userTokens:    maps.Clone(t.userTokens),
+		outbox:        maps.Clone(t.outbox),
+	}
+}
+
+// Store is an in-memory models.Store. It is safe for concurrent use.
+//
+// Statements outside a transaction are atomic. Transactions run one at a time on a
+// copy of the data, which replaces the committed data when they succeed. Reads outside
+// a transaction see committed data only, writes outside a transaction wait for running
+// transactions, so don't write through the Store from inside a WithTx callback.
+type Store struct {
+	querier
+
+	txMu sync.Mutex // held by transactions and writes
+	mu   sync.Mutex // guards data
+	data *tables
+
+	clockMu sync.Mutex
+	lastNow time.Time
+}
+
+// querier runs the queries, on the committed data or inside a transaction when tx is set
+type querier struct {
+	store *Store
+	tx    *tables
+}
+
+var _ models.Store = (*Store)(nil)
+
+// New creates an empty store
+func New() *Store {
+	s := &Store{data: newTables()}
+	s.querier = querier{store: s}
+	return s
+}
+
+// Reset deletes all rows
+func (s *Store) Reset() {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = newTables()
+}
+
+// WithTx implements models.Store. fn sees its own changes, which are discarded when it fails.
+func (s *Store) WithTx(ctx context.Context, fn func(gen.Querier) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	tx := s.data.clone()
+	s.mu.Unlock()
+
+	if err := fn(&querier{store: s, tx: tx}); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.data = tx
+	s.mu.Unlock()
+	return nil
+}
+
+// now returns the current time at the microsecond precision of Postgres timestamps.
+// It never returns the same time twice, so rows ordered by creation time keep their insert order.
+func (s *Store) now() time.Time {
+	s.clockMu.Lock()
+	defer s.clockMu.Unlock()
+	now := time.Now().Truncate(time.Microsecond)
+	if !now.After(s.lastNow) {
+		now = s.lastNow.Add(time.Microsecond)
+	}
+	s.lastNow = now
+	return now
+}
+
+// read runs fn on the tables the querier sees
+func (q *querier) read(ctx context.Context, fn func(*tables) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if q.tx != nil {
+		return fn(q.tx)
+	}
+	q.store.mu.Lock()
+	defer q.store.mu.Unlock()
+	return fn(q.store.data)
+}
+
+// write runs fn on the tables the querier sees. fn must check constraints before
+// changing anything, so a failed statement leaves no trace.
+func (q *querier) write(ctx context.Context, fn func(*tables) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if q.tx != nil {
+		return fn(q.tx)
+	}
+	q.store.txMu.Lock()
+	defer q.store.txMu.Unlock()
+	q.store.mu.Lock()
+	defer q.store.mu.Unlock()
+	return fn(q.store.data)
+}
+
+// timestamp returns the current time as a timestamptz value
+func (q *querier) timestamp() pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: q.store.now(), Valid: true}
+}
+
+// CleanupItems implements gen.Querier
+func (q *querier) CleanupItems(ctx context.Context) error {
+	return q.write(ctx, func(t *tables) error {
+		clear(t.items)
+		return nil
+	})
+}
+
+// CleanupUsers implements gen.Querier, rows referencing the users are deleted with them
+func (q *querier) CleanupUsers(ctx context.Context) error {
+	return q.write(ctx, func(t *tables) error {
+		clear(t.users)
+		clear(t.items)
+		clear(t.refreshTokens)
+		clear(t.userTokens)
+		return nil
+	})
+}
+
+func uniqueError(table, constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           uniqueViolation,
+		Message:        fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+		TableName:      table,
+		ConstraintName: constraint,
+	}
+}
+
+func foreignKeyError(table, constraint string) error {
+	return &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           foreignKeyViolation,
+		Message:        fmt.Sprintf("insert or update on table %q violates foreign key constraint %q", table, constraint),
+		TableName:      table,
+		ConstraintName: constraint,
+	}
+}
+
+// page applies LIMIT and OFFSET to rows. Like the generated queries it returns nil for no rows.
+func page[T any](rows []T, limit, offset int64) []T {
+	if offset >= int64(len(rows)) {
+		return nil
+	}
+	rows = rows[max(offset, 0):]
+	if limit >= 0 && limit < int64(len(rows)) {
+		rows = rows[:limit]
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return slices.Clip(rows)
+}
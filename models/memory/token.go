@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/wangfenjin/mojito/models/gen"
+)
+
+// CreateRefreshToken implements gen.Querier
+func (q *querier) CreateRefreshToken(ctx context.Context, arg gen.CreateRefreshTokenParams) (gen.RefreshToken, error) {
+	var token gen.RefreshToken
+	err := q.write(ctx, func(t *tables) error {
+		if _, ok := t.refreshTokens[arg.ID]; ok {
+			return uniqueError("refresh_token", "refresh_token_pkey")
+		}
+		for _, rt := range t.refreshTokens {
+			if rt.TokenHash == arg.TokenHash {
+				return uniqueError("refresh_token", "ix_refresh_token_hash")
+			}
+		}
+		if _, ok := t.users[arg.UserID]; !ok {
+			return foreignKeyError("refresh_token", "fk_refresh_token_user")
+		}
+		token = gen.RefreshToken{
+			ID:        arg.ID,
+			UserID:    arg.UserID,
+			FamilyID:  arg.FamilyID,
+			TokenHash: arg.TokenHash,
+			ExpiresAt: arg.ExpiresAt,
+			CreatedAt: q.timestamp(),
+		}
+		t.refreshTokens[arg.ID] = token
+		return nil
+	})
+	return token, err
+}
+
+// GetRefreshTokenByHash implements gen.Querier
+func (q *querier) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (gen.RefreshToken, error) {
+	var token gen.RefreshToken
+	err := q.read(ctx, func(t *tables) error {
+		for _, rt := range t.refreshTokens {
+			if rt.TokenHash == tokenHash {
+				token = rt
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return token, err
+}
+
+// revokeRefreshTokens revokes the unrevoked refresh tokens matching fn and returns how many there were.
+// replaced_by is set to replacedBy unless it is nil.
+func (q *querier) revokeRefreshTokens(ctx context.Context, match func(gen.RefreshToken) bool, replacedBy *pgtype.UUID) (int64, error) {
+	var n int64
+	err := q.write(ctx, func(t *tables) error {
+		for id, rt := range t.refreshTokens {
+			if rt.RevokedAt.Valid || !match(rt) {
+				continue
+			}
+			rt.RevokedAt = q.timestamp()
+			if replacedBy != nil {
+				rt.ReplacedBy = *replacedBy
+			}
+			t.refreshTokens[id] = rt
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// RevokeRefreshTokenFamily implements gen.Querier
+func (q *querier) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.revokeRefreshTokens(ctx, func(rt gen.RefreshToken) bool { return rt.FamilyID == familyID }, nil)
+	return err
+}
+
+// RevokeUserRefreshTokens implements gen.Querier
+func (q *querier) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.revokeRefreshTokens(ctx, func(rt gen.RefreshToken) bool { return rt.UserID == userID }, nil)
+	return err
+}
+
+// RotateRefreshToken implements gen.Querier, it returns 0 when the token was already revoked
+func (q *querier) RotateRefreshToken(ctx context.Context, arg gen.RotateRefreshTokenParams) (int64, error) {
+	return q.revokeRefreshTokens(ctx, func(rt gen.RefreshToken) bool { return rt.ID == arg.ID }, &arg.ReplacedBy)
+}
+
+// CreateUserToken implements gen.Querier
+func (q *querier) CreateUserToken(ctx context.Context, arg gen.CreateUserTokenParams) (gen.UserToken, error) {
+	var token gen.UserToken
+	err := q.write(ctx, func(t *tables) error {
+		if _, ok := t.userTokens[arg.ID]; ok {
+			return uniqueError("user_token", "user_token_pkey")
+		}
+		for _, ut := range t.userTokens {
+			if ut.TokenHash == arg.TokenHash {
+				return uniqueError("user_token", "ix_user_token_hash")
+			}
+		}
+		if _, ok := t.users[arg.UserID]; !ok {
+			return foreignKeyError("user_token", "fk_user_token_user")
+		}
+		token = gen.UserToken{
+			ID:        arg.ID,
+			UserID:    arg.UserID,
+			Purpose:   arg.Purpose,
+			TokenHash: arg.TokenHash,
+			ExpiresAt: arg.ExpiresAt,
+			CreatedAt: q.timestamp(),
+			NewEmail:  arg.NewEmail,
+		}
+		t.userTokens[arg.ID] = token
+		return nil
+	})
+	return token, err
+}
+
+// GetUserTokenByHash implements gen.Querier
+func (q *querier) GetUserTokenByHash(ctx context.Context, arg gen.GetUserTokenByHashParams) (gen.UserToken, error) {
+	var token gen.UserToken
+	err := q.read(ctx, func(t *tables) error {
+		for _, ut := range t.userTokens {
+			if ut.TokenHash == arg.TokenHash && ut.Purpose == arg.Purpose {
+				token = ut
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return token, err
+}
+
+// useUserTokens marks the unused user tokens matching fn as used and returns how many there were
+func (q *querier) useUserTokens(ctx context.Context, match func(gen.UserToken) bool) (int64, error) {
+	var n int64
+	err := q.write(ctx, func(t *tables) error {
+		for id, ut := range t.userTokens {
+			if ut.UsedAt.Valid || !match(ut) {
+				continue
+			}
+			ut.UsedAt = q.timestamp()
+			t.userTokens[id] = ut
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// InvalidateUserTokens implements gen.Querier
+func (q *querier) InvalidateUserTokens(ctx context.Context, arg gen.InvalidateUserTokensParams) error {
+	_, err := q.useUserTokens(ctx, func(ut gen.UserToken) bool {
+		return ut.UserID == arg.UserID && ut.Purpose == arg.Purpose
+	})
+	return err
+}
+
+// MarkUserTokenUsed implements gen.Querier, it returns 0 when the token was already used
+func (q *querier) MarkUserTokenUsed(ctx context.Context, id uuid.UUID) (int64, error) {
+	return q.useUserTokens(ctx, func(ut gen.UserToken) bool { return ut.ID == id })
+}
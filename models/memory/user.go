@@ -0,0 +1,198 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/wangfenjin/mojito/models"
+	"github.com/wangfenjin/mojito/models/gen"
+)
+
+// checkUserEmail enforces ix_user_email for user id taking email
+func checkUserEmail(t *tables, id uuid.UUID, email string) error {
+	for _, u := range t.users {
+		if u.Email == email && u.ID != id {
+			return uniqueError("user", models.ConstraintUserEmail)
+		}
+	}
+	return nil
+}
+
+// updateUser applies fn to a user and bumps updated_at like the update_user_updated_at trigger
+func (q *querier) updateUser(ctx context.Context, id uuid.UUID, fn func(t *tables, u *gen.User) error) (gen.User, error) {
+	var user gen.User
+	err := q.write(ctx, func(t *tables) error {
+		u, ok := t.users[id]
+		if !ok {
+			return pgx.ErrNoRows
+		}
+		if err := fn(t, &u); err != nil {
+			return err
+		}
+		u.UpdatedAt = q.timestamp()
+		t.users[id] = u
+		user = u
+		return nil
+	})
+	return user, err
+}
+
+// ChangeUserEmail implements gen.Querier
+func (q *querier) ChangeUserEmail(ctx context.Context, arg gen.ChangeUserEmailParams) (gen.User, error) {
+	return q.updateUser(ctx, arg.ID, func(t *tables, u *gen.User) error {
+		if err := checkUserEmail(t, u.ID, arg.Email); err != nil {
+			return err
+		}
+		u.Email = arg.Email
+		u.EmailVerifiedAt = q.timestamp()
+		return nil
+	})
+}
+
+// CreateUser implements gen.Querier
+func (q *querier) CreateUser(ctx context.Context, arg gen.CreateUserParams) (gen.User, error) {
+	var user gen.User
+	err := q.write(ctx, func(t *tables) error {
+		if _, ok := t.users[arg.ID]; ok {
+			return uniqueError("user", "user_pkey")
+		}
+		if err := checkUserEmail(t, arg.ID, arg.Email); err != nil {
+			return err
+		}
+		now := q.timestamp()
+		user = gen.User{
+			ID:              arg.ID,
+			Email:           arg.Email,
+			HashedPassword:  arg.HashedPassword,
+			IsActive:        arg.IsActive,
+			IsSuperuser:     arg.IsSuperuser,
+			FullName:        arg.FullName,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			EmailVerifiedAt: arg.EmailVerifiedAt,
+		}
+		t.users[arg.ID] = user
+		return nil
+	})
+	return user, err
+}
+
+// DeleteUser implements gen.Querier, it deactivates the user and revokes their tokens
+func (q *querier) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.updateUser(ctx, id, func(_ *tables, u *gen.User) error {
+		u.IsActive = false
+		u.TokenVersion++
+		return nil
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// GetUserByEmail implements gen.Querier
+func (q *querier) GetUserByEmail(ctx context.Context, email string) (gen.User, error) {
+	var user gen.User
+	err := q.read(ctx, func(t *tables) error {
+		for _, u := range t.users {
+			if u.Email == email {
+				user = u
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return user, err
+}
+
+// GetUserByID implements gen.Querier
+func (q *querier) GetUserByID(ctx context.Context, id uuid.UUID) (gen.User, error) {
+	var user gen.User
+	err := q.read(ctx, func(t *tables) error {
+		u, ok := t.users[id]
+		if !ok {
+			return pgx.ErrNoRows
+		}
+		user = u
+		return nil
+	})
+	return user, err
+}
+
+// IncrementUserTokenVersion implements gen.Querier
+func (q *querier) IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	user, err := q.updateUser(ctx, id, func(_ *tables, u *gen.User) error {
+		u.TokenVersion++
+		return nil
+	})
+	return user.TokenVersion, err
+}
+
+// IsUserEmailExists implements gen.Querier
+func (q *querier) IsUserEmailExists(ctx context.Context, email string) (bool, error) {
+	var exists bool
+	err := q.read(ctx, func(t *tables) error {
+		for _, u := range t.users {
+			if u.Email == email {
+				exists = true
+				break
+			}
+		}
+		return nil
+	})
+	return exists, err
+}
+
+// ListUsers implements gen.Querier, users are ordered by email
+func (q *querier) ListUsers(ctx context.Context, arg gen.ListUsersParams) ([]gen.User, error) {
+	var users []gen.User
+	err := q.read(ctx, func(t *tables) error {
+		all := make([]gen.User, 0, len(t.users))
+		for _, u := range t.users {
+			all = append(all, u)
+		}
+		slices.SortFunc(all, func(a, b gen.User) int { return strings.Compare(a.Email, b.Email) })
+		users = page(all, arg.Limit, arg.Offset)
+		return nil
+	})
+	return users, err
+}
+
+// MarkUserEmailVerified implements gen.Querier, the first verification time is kept
+func (q *querier) MarkUserEmailVerified(ctx context.Context, id uuid.UUID) (gen.User, error) {
+	return q.updateUser(ctx, id, func(_ *tables, u *gen.User) error {
+		if !u.EmailVerifiedAt.Valid {
+			u.EmailVerifiedAt = q.timestamp()
+		}
+		return nil
+	})
+}
+
+// UpdateUser implements gen.Querier, only the valid fields of arg are changed
+func (q *querier) UpdateUser(ctx context.Context, arg gen.UpdateUserParams) (gen.User, error) {
+	return q.updateUser(ctx, arg.ID, func(t *tables, u *gen.User) error {
+		if arg.Email.Valid {
+			if err := checkUserEmail(t, u.ID, arg.Email.String); err != nil {
+				return err
+			}
+			u.Email = arg.Email.String
+		}
+		if arg.FullName.Valid {
+			u.FullName = arg.FullName
+		}
+		if arg.IsActive.Valid {
+			u.IsActive = arg.IsActive.Bool
+		}
+		if arg.IsSuperuser.Valid {
+			u.IsSuperuser = arg.IsSuperuser.Bool
+		}
+		if arg.HashedPassword.Valid {
+			u.HashedPassword = arg.HashedPassword.String
+		}
+		return nil
+	})
+}
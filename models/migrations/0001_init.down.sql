@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS public.item;
+DROP TABLE IF EXISTS public."user";
+DROP FUNCTION IF EXISTS update_updated_at_column();
@@ -0,0 +1,2 @@
+-- Incremented to revoke every access token issued to the user
+ALTER TABLE public."user" ADD COLUMN IF NOT EXISTS token_version integer NOT NULL DEFAULT 0;
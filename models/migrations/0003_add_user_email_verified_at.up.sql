@@ -0,0 +1 @@
+ALTER TABLE public."user" ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP WITH TIME ZONE;
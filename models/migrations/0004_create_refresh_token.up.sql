@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS public.refresh_token (
+    id uuid NOT NULL PRIMARY KEY,
+    user_id uuid NOT NULL,
+    family_id uuid NOT NULL,
+    token_hash character varying(64) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    replaced_by uuid,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_refresh_token_user FOREIGN KEY (user_id) REFERENCES public."user" (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ix_refresh_token_hash ON public.refresh_token USING btree (token_hash);
+CREATE INDEX IF NOT EXISTS ix_refresh_token_family ON public.refresh_token USING btree (family_id);
@@ -0,0 +1,15 @@
+-- Single-use tokens for actions such as password resets, only the hash is stored
+CREATE TABLE IF NOT EXISTS public.user_token (
+    id uuid NOT NULL PRIMARY KEY,
+    user_id uuid NOT NULL,
+    purpose character varying(32) NOT NULL,
+    token_hash character varying(64) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    new_email character varying(255),
+    CONSTRAINT fk_user_token_user FOREIGN KEY (user_id) REFERENCES public."user" (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ix_user_token_hash ON public.user_token USING btree (token_hash);
+CREATE INDEX IF NOT EXISTS ix_user_token_user_purpose ON public.user_token USING btree (user_id, purpose);
@@ -0,0 +1,15 @@
+-- Messages written in the same transaction as the domain change and delivered by the outbox dispatcher.
+-- status is pending, delivered or dead; available_at is when the next delivery attempt may start.
+CREATE TABLE IF NOT EXISTS public.outbox (
+    id uuid NOT NULL PRIMARY KEY,
+    topic character varying(64) NOT NULL,
+    payload jsonb NOT NULL,
+    status character varying(16) NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    available_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error text,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS ix_outbox_pending ON public.outbox USING btree (available_at) WHERE status = 'pending';
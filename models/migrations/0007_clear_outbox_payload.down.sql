@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS public.ix_outbox_delivered;
+UPDATE public.outbox SET payload = 'null'::jsonb WHERE payload IS NULL;
+ALTER TABLE public.outbox ALTER COLUMN payload SET NOT NULL;
@@ -0,0 +1,4 @@
+-- Settled messages don't keep their payload, it may hold secrets like reset links
+ALTER TABLE public.outbox ALTER COLUMN payload DROP NOT NULL;
+UPDATE public.outbox SET payload = NULL WHERE status IN ('delivered', 'dead');
+CREATE INDEX IF NOT EXISTS ix_outbox_delivered ON public.outbox USING btree (delivered_at) WHERE status = 'delivered';
@@ -0,0 +1,367 @@
+// Package migrations applies the versioned database schema. Migrations are pairs of
+// <version>_<name>.up.sql and <version>_<name>.down.sql files embedded in the binary,
+// applied versions are recorded in the schema_migrations table. sqlc reads the same
+// directory as its schema, ignoring the down files.
+//
+// The first migration is the schema.sql databases were initialized from before
+// migrations existed. Such databases have its tables but no schema_migrations, Up
+// records it as applied and continues from there.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed *.sql
+var embedded embed.FS
+
+// undefinedTable is the SQLSTATE of queries on schema_migrations before the first migration
+const undefinedTable = "42P01"
+
+// lockID is the advisory lock held while migrating, so concurrent instances apply each migration once
+const lockID int64 = 0x6d6f6a69746f // "mojito"
+
+// baselineVersion is the migration holding the former schema.sql
+const baselineVersion = 1
+
+const createTable = `CREATE TABLE IF NOT EXISTS public.schema_migrations (
+    version bigint NOT NULL PRIMARY KEY,
+    name character varying(255) NOT NULL,
+    applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+var (
+	fileName      = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// Migration is one schema change and its rollback
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the state of one migration. Migrations applied to the database but unknown
+// to this binary are reported with an empty Name.
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Load reads the migrations in fsys, sorted by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		m := fileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q, expected <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %q: %w", entry.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names, %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(data)
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if strings.TrimSpace(mig.Up) == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+	logger     *slog.Logger
+}
+
+// New creates a migrator for the embedded migrations
+func New(pool *pgxpool.Pool, logger *slog.Logger) (*Migrator, error) {
+	migrations, err := Load(embedded)
+	if err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Migrator{pool: pool, migrations: migrations, logger: logger}, nil
+}
+
+// Up applies at most n pending migrations in order, all of them when n <= 0.
+// It returns the migrations that were applied.
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn, applied map[int64]time.Time) error {
+		if len(applied) == 0 {
+			adopted, err := m.adopt(ctx, conn)
+			if err != nil {
+				return err
+			}
+			if adopted {
+				applied[baselineVersion] = time.Now()
+			}
+		}
+		for _, mig := range m.migrations {
+			if n > 0 && len(done) == n {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			m.logger.Info("applying migration", "version", mig.Version, "name", mig.Name)
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `INSERT INTO public.schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("error applying migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// adopt records the baseline migration as applied when the database was created
+// from the former schema.sql, it reports whether it did
+func (m *Migrator) adopt(ctx context.Context, conn *pgxpool.Conn) (bool, error) {
+	baseline, ok := m.find(baselineVersion)
+	if !ok {
+		return false, nil
+	}
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass('public."user"') IS NOT NULL`).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error inspecting the schema: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+	m.logger.Info("adopting existing schema", "version", baseline.Version, "name", baseline.Name)
+	_, err := conn.Exec(ctx, `INSERT INTO public.schema_migrations (version, name) VALUES ($1, $2)`, baseline.Version, baseline.Name)
+	if err != nil {
+		return false, fmt.Errorf("error recording migration %d_%s: %w", baseline.Version, baseline.Name, err)
+	}
+	return true, nil
+}
+
+// Down rolls back the n most recently applied migrations, one when n <= 0.
+// It returns the migrations that were rolled back.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if n <= 0 {
+		n = 1
+	}
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn, applied map[int64]time.Time) error {
+		versions := make([]int64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for _, version := range versions {
+			if len(done) == n {
+				break
+			}
+			mig, ok := m.find(version)
+			if !ok {
+				return fmt.Errorf("migration %d is applied but unknown to this binary", version)
+			}
+			if strings.TrimSpace(mig.Down) == "" {
+				return fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+			}
+			m.logger.Info("rolling back migration", "version", mig.Version, "name", mig.Name)
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `DELETE FROM public.schema_migrations WHERE version = $1`, mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("error rolling back migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every known or applied migration, sorted by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(_ *pgxpool.Conn, applied map[int64]time.Time) error {
+		for _, mig := range m.migrations {
+			s := Status{Version: mig.Version, Name: mig.Name}
+			if at, ok := applied[mig.Version]; ok {
+				s.AppliedAt = &at
+			}
+			statuses = append(statuses, s)
+		}
+		for version, at := range applied {
+			if _, ok := m.find(version); !ok {
+				statuses = append(statuses, Status{Version: version, AppliedAt: &at})
+			}
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, err
+}
+
+// Pending returns the number of migrations that aren't applied yet. Unlike Status it
+// neither waits for a running migration nor creates schema_migrations, so it can be
+// polled by health checks.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	rows, err := m.pool.Query(ctx, `SELECT version FROM public.schema_migrations`)
+	if err == nil {
+		var versions []int64
+		versions, err = pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err == nil {
+			pending := len(m.migrations)
+			for _, version := range versions {
+				if _, ok := m.find(version); ok {
+					pending--
+				}
+			}
+			return pending, nil
+		}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == undefinedTable {
+		return len(m.migrations), nil
+	}
+	return 0, fmt.Errorf("error reading schema_migrations: %w", err)
+}
+
+// locked runs fn on a single connection holding the migration lock,
+// with the versions applied so far
+func (m *Migrator) locked(ctx context.Context, fn func(*pgxpool.Conn, map[int64]time.Time) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring connection: %w", err)
+	}
+	defer conn.Release()
+
+	// Session level lock, it is released below or when the connection closes
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("error acquiring migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+			m.logger.Error("error releasing migration lock", "error", err)
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, createTable); err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM public.schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	applied := make(map[int64]time.Time)
+	var (
+		version   int64
+		appliedAt time.Time
+	)
+	_, err = pgx.ForEachRow(rows, []any{&version, &appliedAt}, func() error {
+		applied[version] = appliedAt
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+
+	return fn(conn, applied)
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+// Create writes empty up and down files for a new migration to dir, numbered after
+// the highest version found there. It returns the paths of the new files.
+func Create(dir, name string) (up, down string, err error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	if !migrationName.MatchString(name) {
+		return "", "", errors.New("migration name may only contain letters, digits and underscores")
+	}
+	existing, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	var version int64 = 1
+	if len(existing) > 0 {
+		version = existing[len(existing)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+	up, down = base+".up.sql", base+".down.sql"
+	if err := os.WriteFile(up, []byte("-- "+name+"\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(down, []byte("-- revert "+name+"\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	return up, down, nil
+}
@@ -0,0 +1,163 @@
+package migrations_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wangfenjin/mojito/models/gen"
+	"github.com/wangfenjin/mojito/models/migrations"
+)
+
+// testDatabase creates an empty database on the server of TEST_DATABASE_URL, it is
+// dropped when the test ends. The test is skipped when TEST_DATABASE_URL isn't set.
+func testDatabase(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL isn't set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("mojito_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE DATABASE "+name); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ConnConfig.Database = name
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+		if _, err := admin.Exec(ctx, "DROP DATABASE "+name+" WITH (FORCE)"); err != nil {
+			t.Error(err)
+		}
+		admin.Close(ctx)
+	})
+	return pool
+}
+
+func exists(t *testing.T, pool *pgxpool.Pool, table string) bool {
+	t.Helper()
+	var ok bool
+	if err := pool.QueryRow(context.Background(), `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&ok); err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func pending(t *testing.T, m *migrations.Migrator) int {
+	t.Helper()
+	n, err := m.Pending(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// TestUpAdoptsSchemaSQL migrates a database initialized from the former schema.sql,
+// which is the first migration, without its version recorded
+func TestUpAdoptsSchemaSQL(t *testing.T) {
+	pool := testDatabase(t)
+	ctx := context.Background()
+
+	all, err := migrations.Load(os.DirFS("."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, all[0].Up); err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	_, err = pool.Exec(ctx, `INSERT INTO public."user" (id, email, hashed_password, is_active, is_superuser) VALUES ($1, 'old@example.com', 'hash', true, false)`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := migrations.New(pool, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := m.Up(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(all)-1 || len(done) > 0 && done[0].Version != 2 {
+		t.Fatalf("applied %v, want the %d migrations after the baseline", done, len(all)-1)
+	}
+	if n := pending(t, m); n != 0 {
+		t.Errorf("%d migrations pending", n)
+	}
+
+	// The queries work on the adopted schema and the existing user
+	q := gen.New(pool)
+	user, err := q.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.TokenVersion != 0 || user.EmailVerifiedAt.Valid {
+		t.Errorf("existing user = %+v, want token version 0 and no verification", user)
+	}
+	if _, err := q.IncrementUserTokenVersion(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"refresh_token", "user_token", "outbox"} {
+		if !exists(t, pool, table) {
+			t.Errorf("table %s is missing", table)
+		}
+	}
+
+	// Rolling back to the baseline leaves the former schema
+	if _, err := m.Down(ctx, len(all)-1); err != nil {
+		t.Fatal(err)
+	}
+	if n := pending(t, m); n != len(all)-1 {
+		t.Errorf("%d migrations pending after rolling back, want %d", n, len(all)-1)
+	}
+	if exists(t, pool, "outbox") || !exists(t, pool, `"user"`) {
+		t.Error("rolling back didn't restore the former schema")
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpDownFreshDatabase(t *testing.T) {
+	pool := testDatabase(t)
+	ctx := context.Background()
+
+	m, err := migrations.New(pool, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := m.Up(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := pending(t, m); n != 0 {
+		t.Errorf("%d migrations pending", n)
+	}
+	if _, err := m.Down(ctx, len(done)); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{`"user"`, "item", "refresh_token", "user_token", "outbox"} {
+		if exists(t, pool, table) {
+			t.Errorf("table %s is left after rolling back", table)
+		}
+	}
+}
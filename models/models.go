@@ -4,20 +4,23 @@ package models
 import (
 	"context"
 	"fmt"
-	"sync" // Import sync package for thread safety
+	"net/url"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/wangfenjin/mojito/models/gen"
 )
 
-// globalDB holds the global database connection instance
-var (
-	globalDB *DB
-	once     sync.Once // Use sync.Once to ensure Connect is called only once for initialization
+// Drivers selectable with DatabaseConfig.Driver, the memory store lives in models/memory
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
 )
 
-// ConnectionParams holds the parameters for connecting to the database
+// ConnectionParams holds the parameters for connecting to the database.
+// Zero pool settings keep the pgxpool defaults.
 type ConnectionParams struct {
 	Host     string
 	Port     int
@@ -26,53 +29,105 @@ type ConnectionParams struct {
 	DBName   string
 	SSLMode  string
 	TimeZone string
+
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	ConnectTimeout    time.Duration
 }
 
-// DB wraps the database connection and queries
+// DB wraps the connection pool and queries. Both are safe for concurrent use.
 type DB struct {
-	*pgx.Conn
+	*pgxpool.Pool
 	*gen.Queries
 }
 
-// Connect establishes a connection to the database and initializes the global instance
-func Connect(params ConnectionParams) (*DB, error) {
-	var err error
-	once.Do(func() { // Ensure this block runs only once
-		dsn := fmt.Sprintf(
-			"postgres://%s:%s@%s:%d/%s?sslmode=%s&TimeZone=%s",
-			params.User, params.Password, params.Host, params.Port, params.DBName, params.SSLMode, params.TimeZone,
-		)
+// PoolStats is a snapshot of the connection pool for monitoring
+type PoolStats struct {
+	TotalConns              int32         `json:"total_conns"`
+	AcquiredConns           int32         `json:"acquired_conns"`
+	IdleConns               int32         `json:"idle_conns"`
+	ConstructingConns       int32         `json:"constructing_conns"`
+	MaxConns                int32         `json:"max_conns"`
+	AcquireCount            int64         `json:"acquire_count"`
+	AcquireDuration         time.Duration `json:"acquire_duration_ns"`
+	EmptyAcquireCount       int64         `json:"empty_acquire_count"`
+	CanceledAcquireCount    int64         `json:"canceled_acquire_count"`
+	NewConnsCount           int64         `json:"new_conns_count"`
+	MaxLifetimeDestroyCount int64         `json:"max_lifetime_destroy_count"`
+	MaxIdleDestroyCount     int64         `json:"max_idle_destroy_count"`
+}
+
+// Open creates a connection pool and checks that the database is reachable
+func Open(ctx context.Context, params ConnectionParams) (*DB, error) {
+	dsn := fmt.Sprintf(
+		"postgres://%s:%s@%s:%d/%s?sslmode=%s&TimeZone=%s",
+		url.QueryEscape(params.User), url.QueryEscape(params.Password), params.Host, params.Port, params.DBName, params.SSLMode, params.TimeZone,
+	)
 
-		conn, connErr := pgx.Connect(context.Background(), dsn)
-		if connErr != nil {
-			err = fmt.Errorf("failed to connect to PostgreSQL database: %w", connErr)
-			return
-		}
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
+	if params.MaxConns > 0 {
+		cfg.MaxConns = params.MaxConns
+	}
+	if params.MinConns > 0 {
+		cfg.MinConns = params.MinConns
+	}
+	if params.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = params.MaxConnLifetime
+	}
+	if params.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = params.MaxConnIdleTime
+	}
+	if params.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = params.HealthCheckPeriod
+	}
+	if params.ConnectTimeout > 0 {
+		cfg.ConnConfig.ConnectTimeout = params.ConnectTimeout
+	}
 
-		// Create queries with the database connection
-		queries := gen.New(conn)
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL database: %w", err)
+	}
+	// The pool connects lazily, fail at startup when the database is unreachable
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to PostgreSQL database: %w", err)
+	}
 
-		// Assign the created DB instance to the global variable
-		globalDB = &DB{
-			Conn:    conn,
-			Queries: queries,
-		}
-	})
-	return globalDB, err
+	// Create queries on top of the pool
+	return &DB{
+		Pool:    pool,
+		Queries: gen.New(pool),
+	}, nil
 }
 
-// GetDB returns the globally initialized database instance.
-// It panics if the database is not initialized.
-func GetDB() *DB {
-	if globalDB == nil {
-		// Or return an error: return nil, fmt.Errorf("database not initialized")
-		panic("database connection has not been initialized. Call Connect first.")
+// Stats returns a snapshot of the connection pool
+func (db *DB) Stats() PoolStats {
+	s := db.Stat()
+	return PoolStats{
+		TotalConns:              s.TotalConns(),
+		AcquiredConns:           s.AcquiredConns(),
+		IdleConns:               s.IdleConns(),
+		ConstructingConns:       s.ConstructingConns(),
+		MaxConns:                s.MaxConns(),
+		AcquireCount:            s.AcquireCount(),
+		AcquireDuration:         s.AcquireDuration(),
+		EmptyAcquireCount:       s.EmptyAcquireCount(),
+		CanceledAcquireCount:    s.CanceledAcquireCount(),
+		NewConnsCount:           s.NewConnsCount(),
+		MaxLifetimeDestroyCount: s.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     s.MaxIdleDestroyCount(),
 	}
-	return globalDB
 }
 
 // WithTx executes a function within a transaction
-func (db *DB) WithTx(ctx context.Context, fn func(*gen.Queries) error) error {
+func (db *DB) WithTx(ctx context.Context, fn func(gen.Querier) error) error {
 	tx, err := db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return err
@@ -0,0 +1,60 @@
+-- name: EnqueueOutbox :exec
+INSERT INTO public.outbox (
+    id,
+    topic,
+    payload
+) VALUES (
+    $1, $2, $3
+);
+
+-- name: ClaimOutbox :many
+UPDATE public.outbox SET
+    attempts = attempts + 1,
+    available_at = CURRENT_TIMESTAMP + make_interval(secs => sqlc.arg(lease_seconds)::float8)
+WHERE id IN (
+    SELECT id FROM public.outbox
+    WHERE status = 'pending' AND available_at <= CURRENT_TIMESTAMP
+    ORDER BY available_at
+    LIMIT sqlc.arg(batch_size)::int
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- The payload is cleared once a message is settled, it may hold secrets like reset links
+
+-- name: MarkOutboxDelivered :exec
+UPDATE public.outbox SET
+    status = 'delivered',
+    delivered_at = CURRENT_TIMESTAMP,
+    last_error = NULL,
+    payload = NULL
+WHERE id = $1;
+
+-- name: RetryOutbox :exec
+UPDATE public.outbox SET
+    available_at = $2,
+    last_error = $3
+WHERE id = $1;
+
+-- name: DeadLetterOutbox :exec
+UPDATE public.outbox SET
+    status = 'dead',
+    last_error = $2,
+    payload = NULL
+WHERE id = $1;
+
+-- name: PurgeOutbox :execrows
+DELETE FROM public.outbox
+WHERE status = 'delivered' AND delivered_at < $1;
+
+-- name: CountOutboxByStatus :many
+SELECT status, COUNT(*) AS count, MIN(created_at)::timestamptz AS oldest
+FROM public.outbox
+GROUP BY status
+ORDER BY status;
+
+-- name: ListOutboxByStatus :many
+SELECT * FROM public.outbox
+WHERE status = $1
+ORDER BY created_at DESC
+LIMIT $2;
\ No newline at end of file
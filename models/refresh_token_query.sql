@@ -0,0 +1,29 @@
+-- name: CreateRefreshToken :one
+INSERT INTO public.refresh_token (
+    id,
+    user_id,
+    family_id,
+    token_hash,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: GetRefreshTokenByHash :one
+SELECT * FROM public.refresh_token WHERE token_hash = $1 LIMIT 1 FOR UPDATE;
+
+-- name: RotateRefreshToken :execrows
+UPDATE public.refresh_token SET
+    revoked_at = CURRENT_TIMESTAMP,
+    replaced_by = $2
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE public.refresh_token SET
+    revoked_at = CURRENT_TIMESTAMP
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE public.refresh_token SET
+    revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND revoked_at IS NULL;
\ No newline at end of file
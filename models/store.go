@@ -0,0 +1,44 @@
+package models
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/wangfenjin/mojito/models/gen"
+)
+
+// UserRepository reads and writes users, it is implemented by gen.Queries
+type UserRepository interface {
+	ChangeUserEmail(ctx context.Context, arg gen.ChangeUserEmailParams) (gen.User, error)
+	CreateUser(ctx context.Context, arg gen.CreateUserParams) (gen.User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	GetUserByEmail(ctx context.Context, email string) (gen.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (gen.User, error)
+	IncrementUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error)
+	IsUserEmailExists(ctx context.Context, email string) (bool, error)
+	ListUsers(ctx context.Context, arg gen.ListUsersParams) ([]gen.User, error)
+	MarkUserEmailVerified(ctx context.Context, id uuid.UUID) (gen.User, error)
+	UpdateUser(ctx context.Context, arg gen.UpdateUserParams) (gen.User, error)
+}
+
+// ItemRepository reads and writes items, it is implemented by gen.Queries
+type ItemRepository interface {
+	CreateItem(ctx context.Context, arg gen.CreateItemParams) (gen.Item, error)
+	DeleteItem(ctx context.Context, id uuid.UUID) error
+	GetItemByID(ctx context.Context, id uuid.UUID) (gen.Item, error)
+	ListItemsByOwner(ctx context.Context, arg gen.ListItemsByOwnerParams) ([]gen.Item, error)
+	UpdateItem(ctx context.Context, arg gen.UpdateItemParams) (gen.Item, error)
+}
+
+// Store is the data layer handlers depend on. DB implements it on top of Postgres.
+type Store interface {
+	gen.Querier
+	// WithTx runs fn in a transaction, which commits when fn returns nil
+	WithTx(ctx context.Context, fn func(gen.Querier) error) error
+}
+
+var (
+	_ UserRepository = (gen.Querier)(nil)
+	_ ItemRepository = (gen.Querier)(nil)
+	_ Store          = (*DB)(nil)
+)
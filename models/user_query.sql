@@ -5,9 +5,10 @@ INSERT INTO public."user" (
     hashed_password,
     is_active,
     is_superuser,
-    full_name
+    full_name,
+    email_verified_at
 ) VALUES (
-    $1, $2, $3, $4, $5, $6
+    $1, $2, $3, $4, $5, $6, $7
 ) RETURNING *;
 
 -- name: GetUserByEmail :one
@@ -32,12 +33,32 @@ UPDATE public."user" SET
 WHERE id = $1
 RETURNING *;
 
+-- name: MarkUserEmailVerified :one
+UPDATE public."user" SET
+    email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+WHERE id = $1
+RETURNING *;
+
+-- name: ChangeUserEmail :one
+UPDATE public."user" SET
+    email = $2,
+    email_verified_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
 -- name: DeleteUser :exec
 UPDATE public."user" SET
-    is_active = false
+    is_active = false,
+    token_version = token_version + 1
 WHERE id = $1
 RETURNING *;
 
+-- name: IncrementUserTokenVersion :one
+UPDATE public."user" SET
+    token_version = token_version + 1
+WHERE id = $1
+RETURNING token_version;
+
 -- name: IsUserEmailExists :one
 SELECT EXISTS (
     SELECT 1 
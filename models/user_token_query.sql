@@ -0,0 +1,26 @@
+-- name: CreateUserToken :one
+INSERT INTO public.user_token (
+    id,
+    user_id,
+    purpose,
+    token_hash,
+    expires_at,
+    new_email
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+) RETURNING *;
+
+-- name: GetUserTokenByHash :one
+SELECT * FROM public.user_token
+WHERE token_hash = $1 AND purpose = $2
+LIMIT 1 FOR UPDATE;
+
+-- name: MarkUserTokenUsed :execrows
+UPDATE public.user_token SET
+    used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: InvalidateUserTokens :exec
+UPDATE public.user_token SET
+    used_at = CURRENT_TIMESTAMP
+WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL;
\ No newline at end of file
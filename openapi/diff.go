@@ -0,0 +1,340 @@
+package openapi
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Change is a difference between two versions of a spec. Breaking changes may
+// break clients written against the old version.
+type Change struct {
+	Breaking bool
+	// Operation is the changed operation like "GET /users/{id}"
+	Operation string
+	Message   string
+}
+
+func (c Change) String() string {
+	kind := "change"
+	if c.Breaking {
+		kind = "breaking"
+	}
+	return fmt.Sprintf("%s: %s: %s", kind, c.Operation, c.Message)
+}
+
+// direction is whether a schema is sent by clients or received by them, which
+// decides whether narrowing or widening it breaks them
+type direction int
+
+const (
+	request direction = iota
+	response
+)
+
+// Diff compares the spec head with the spec base, both in JSON or YAML. It
+// reports added, removed and deprecated operations, and the breaking changes of
+// their parameters, request bodies and successful responses. Error responses and
+// descriptions aren't compared. Changes are sorted by operation.
+func Diff(base, head []byte) ([]Change, error) {
+	d := differ{}
+	if err := yaml.Unmarshal(base, &d.base); err != nil {
+		return nil, fmt.Errorf("failed to parse the base spec: %w", err)
+	}
+	if err := yaml.Unmarshal(head, &d.head); err != nil {
+		return nil, fmt.Errorf("failed to parse the new spec: %w", err)
+	}
+	d.diffPaths()
+	slices.SortStableFunc(d.changes, func(a, b Change) int {
+		return strings.Compare(a.Operation, b.Operation)
+	})
+	return d.changes, nil
+}
+
+// MajorVersion returns the major version of the spec's info.version, breaking
+// changes are expected when it changes
+func MajorVersion(spec []byte) (string, error) {
+	var doc struct {
+		Info struct {
+			Version string `yaml:"version"`
+		} `yaml:"info"`
+	}
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return "", err
+	}
+	major, _, _ := strings.Cut(strings.TrimPrefix(doc.Info.Version, "v"), ".")
+	return major, nil
+}
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+type differ struct {
+	base, head map[string]any
+	changes    []Change
+	// seen are the pairs of schema references being compared, for recursive schemas
+	seen map[[2]string]bool
+}
+
+func (d *differ) report(breaking bool, op, format string, args ...any) {
+	d.changes = append(d.changes, Change{Breaking: breaking, Operation: op, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *differ) diffPaths() {
+	basePaths, headPaths := object(d.base["paths"]), object(d.head["paths"])
+	for _, path := range sortedKeys(basePaths, headPaths) {
+		baseItem, headItem := object(basePaths[path]), object(headPaths[path])
+		for _, method := range methods {
+			op := strings.ToUpper(method) + " " + path
+			baseOp, inBase := baseItem[method]
+			headOp, inHead := headItem[method]
+			switch {
+			case inBase && !inHead:
+				d.report(true, op, "operation removed")
+			case !inBase && inHead:
+				d.report(false, op, "operation added")
+			case inBase && inHead:
+				d.diffOperation(op, object(baseOp), object(headOp))
+			}
+		}
+	}
+}
+
+func (d *differ) diffOperation(op string, base, head map[string]any) {
+	if deprecated, _ := head["deprecated"].(bool); deprecated {
+		if was, _ := base["deprecated"].(bool); !was {
+			d.report(false, op, "operation deprecated")
+		}
+	}
+	if len(list(head["security"])) > 0 && len(list(base["security"])) == 0 {
+		d.report(true, op, "authentication required")
+	}
+
+	d.diffParameters(op, list(base["parameters"]), list(head["parameters"]))
+
+	baseBody, headBody := object(base["requestBody"]), object(head["requestBody"])
+	if headBody != nil {
+		if required, _ := headBody["required"].(bool); required && baseBody == nil {
+			d.report(true, op, "request body required")
+		}
+	}
+	baseContent, headContent := object(baseBody["content"]), object(headBody["content"])
+	for _, mediaType := range sortedKeys(baseContent) {
+		if _, ok := headContent[mediaType]; !ok && baseBody != nil && headBody != nil {
+			d.report(true, op, "request body no longer accepts %s", mediaType)
+			continue
+		}
+		d.diffSchema(op, "request body", request,
+			object(object(baseContent[mediaType])["schema"]), object(object(headContent[mediaType])["schema"]))
+	}
+
+	baseResponses, headResponses := object(base["responses"]), object(head["responses"])
+	for _, status := range sortedKeys(baseResponses) {
+		if !strings.HasPrefix(status, "2") {
+			continue
+		}
+		headResponse, ok := headResponses[status]
+		if !ok {
+			d.report(true, op, "response %s removed", status)
+			continue
+		}
+		baseContent, headContent := object(object(baseResponses[status])["content"]), object(object(headResponse)["content"])
+		for _, mediaType := range sortedKeys(baseContent) {
+			if _, ok := headContent[mediaType]; !ok {
+				d.report(true, op, "response %s no longer returns %s", status, mediaType)
+				continue
+			}
+			d.diffSchema(op, "response "+status, response,
+				object(object(baseContent[mediaType])["schema"]), object(object(headContent[mediaType])["schema"]))
+		}
+	}
+}
+
+func (d *differ) diffParameters(op string, base, head []any) {
+	key := func(p map[string]any) string {
+		return fmt.Sprintf("%s parameter %q", p["in"], p["name"])
+	}
+	baseParams := map[string]map[string]any{}
+	for _, p := range base {
+		baseParams[key(object(p))] = object(p)
+	}
+	headParams := map[string]map[string]any{}
+	for _, p := range head {
+		headParams[key(object(p))] = object(p)
+	}
+
+	for _, name := range sortedKeys(baseParams, headParams) {
+		baseParam, inBase := baseParams[name]
+		headParam, inHead := headParams[name]
+		required, _ := headParam["required"].(bool)
+		wasRequired, _ := baseParam["required"].(bool)
+		switch {
+		case !inHead:
+			d.report(false, op, "%s removed", name)
+		case !inBase && required:
+			d.report(true, op, "required %s added", name)
+		case !inBase:
+			d.report(false, op, "%s added", name)
+		default:
+			if required && !wasRequired {
+				d.report(true, op, "%s became required", name)
+			}
+			d.diffSchema(op, name, request, object(baseParam["schema"]), object(headParam["schema"]))
+		}
+	}
+}
+
+// diffSchema compares the schemas at loc of an operation, following references
+func (d *differ) diffSchema(op, loc string, dir direction, base, head map[string]any) {
+	if base == nil || head == nil {
+		return
+	}
+	baseRef, _ := base["$ref"].(string)
+	headRef, _ := head["$ref"].(string)
+	if baseRef != "" || headRef != "" {
+		pair := [2]string{baseRef, headRef}
+		if d.seen[pair] {
+			return
+		}
+		if d.seen == nil {
+			d.seen = map[[2]string]bool{}
+		}
+		d.seen[pair] = true
+		defer delete(d.seen, pair)
+		base, head = resolve(d.base, base), resolve(d.head, head)
+		if base == nil || head == nil {
+			return
+		}
+	}
+
+	// Clients must accept every type the server sends and send types the server accepts
+	baseTypes, headTypes := types(base), types(head)
+	if len(baseTypes) > 0 && len(headTypes) > 0 {
+		narrowed, widened := missing(baseTypes, headTypes), missing(headTypes, baseTypes)
+		if dir == request && len(narrowed) > 0 {
+			d.report(true, op, "%s no longer accepts type %s", loc, strings.Join(narrowed, ", "))
+		}
+		if dir == response && len(widened) > 0 {
+			d.report(true, op, "%s may return type %s", loc, strings.Join(widened, ", "))
+		}
+	}
+
+	baseEnum, headEnum := enum(base), enum(head)
+	if dir == request && len(headEnum) > 0 {
+		if len(baseEnum) == 0 {
+			d.report(true, op, "%s only accepts %s", loc, strings.Join(headEnum, ", "))
+		} else if removed := missing(baseEnum, headEnum); len(removed) > 0 {
+			d.report(true, op, "%s no longer accepts %s", loc, strings.Join(removed, ", "))
+		}
+	}
+	if dir == response && len(baseEnum) > 0 {
+		if len(headEnum) == 0 {
+			d.report(true, op, "%s is no longer an enum", loc)
+		} else if added := missing(headEnum, baseEnum); len(added) > 0 {
+			d.report(true, op, "%s may return %s", loc, strings.Join(added, ", "))
+		}
+	}
+
+	baseProps, headProps := object(base["properties"]), object(head["properties"])
+	baseRequired, headRequired := strs(base["required"]), strs(head["required"])
+	for _, name := range sortedKeys(baseProps, headProps) {
+		prop := loc + "." + name
+		_, inBase := baseProps[name]
+		_, inHead := headProps[name]
+		switch {
+		case dir == request && slices.Contains(headRequired, name) && !slices.Contains(baseRequired, name):
+			d.report(true, op, "%s is required", prop)
+		case dir == response && inBase && !inHead:
+			d.report(true, op, "%s removed", prop)
+		case dir == response && slices.Contains(baseRequired, name) && !slices.Contains(headRequired, name):
+			d.report(true, op, "%s is optional", prop)
+		}
+		if inBase && inHead {
+			d.diffSchema(op, prop, dir, object(baseProps[name]), object(headProps[name]))
+		}
+	}
+
+	d.diffSchema(op, loc+"[]", dir, object(base["items"]), object(head["items"]))
+	d.diffSchema(op, loc+"{}", dir, object(base["additionalProperties"]), object(head["additionalProperties"]))
+}
+
+// resolve returns the schema a local reference like #/components/schemas/User points to
+func resolve(doc, schema map[string]any) map[string]any {
+	ref, ok := schema["$ref"].(string)
+	if !ok {
+		return schema
+	}
+	path, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil
+	}
+	node := doc
+	for _, name := range strings.Split(path, "/") {
+		name = strings.NewReplacer("~1", "/", "~0", "~").Replace(name)
+		node = object(node[name])
+	}
+	return node
+}
+
+// types returns the JSON types a schema allows, its type is a name or a list of names
+func types(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		return strs(t)
+	}
+	return nil
+}
+
+func enum(schema map[string]any) []string {
+	var values []string
+	for _, v := range list(schema["enum"]) {
+		values = append(values, fmt.Sprint(v))
+	}
+	return values
+}
+
+// missing returns the values of a that aren't in b
+func missing(a, b []string) []string {
+	var out []string
+	for _, v := range a {
+		if !slices.Contains(b, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func object(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+func list(v any) []any {
+	l, _ := v.([]any)
+	return l
+}
+
+func strs(v any) []string {
+	var out []string
+	for _, s := range list(v) {
+		if s, ok := s.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// sortedKeys returns the keys of the maps, sorted and without duplicates
+func sortedKeys[V any](maps ...map[string]V) []string {
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
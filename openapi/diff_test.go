@@ -0,0 +1,93 @@
+package openapi_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wangfenjin/mojito/openapi"
+)
+
+const baseSpec = `
+openapi: 3.1.0
+info: {version: 1.0.0}
+paths:
+  /users/{id}:
+    get:
+      parameters:
+        - {name: id, in: path, required: true, schema: {type: string}}
+      responses:
+        "200":
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/User"}
+    delete:
+      responses: {"200": {description: ok}}
+  /users/:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                email: {type: string}
+                role: {type: string, enum: [admin, user]}
+      responses: {"200": {description: ok}}
+components:
+  schemas:
+    User:
+      type: object
+      required: [id, email]
+      properties:
+        id: {type: string}
+        email: {type: string}
+        manager: {$ref: "#/components/schemas/User"}
+`
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		want     string
+		breaking bool
+	}{
+		{"unchanged", "", "", "", false},
+		{"operation removed", "    delete:\n      responses: {\"200\": {description: ok}}\n", "", "DELETE /users/{id}: operation removed", true},
+		{"operation added", "  /users/:\n", "  /users/{id}/avatar:\n    put: {}\n  /users/:\n", "PUT /users/{id}/avatar: operation added", false},
+		{"query parameter added", "required: true, schema: {type: string}}\n", "required: true, schema: {type: string}}\n        - {name: q, in: query, schema: {type: string}}\n", `GET /users/{id}: query parameter "q" added`, false},
+		{"required parameter added", "required: true, schema: {type: string}}\n", "required: true, schema: {type: string}}\n        - {name: q, in: query, required: true, schema: {type: string}}\n", `GET /users/{id}: required query parameter "q" added`, true},
+		{"response property removed", "        email: {type: string}\n        manager", "        manager", "GET /users/{id}: response 200.email removed", true},
+		{"response property optional", "required: [id, email]", "required: [id]", "GET /users/{id}: response 200.email is optional", true},
+		{"response type widened", "        id: {type: string}", "        id: {type: [string, \"null\"]}", "GET /users/{id}: response 200.id may return type null", true},
+		{"request property required", "              type: object\n", "              type: object\n              required: [email]\n", "POST /users/: request body.email is required", true},
+		{"request enum narrowed", "enum: [admin, user]", "enum: [user]", "POST /users/: request body.role no longer accepts admin", true},
+		{"request enum widened", "enum: [admin, user]", "enum: [admin, user, guest]", "", false},
+		{"recursive schema", "manager: {$ref: \"#/components/schemas/User\"}", "manager: {$ref: \"#/components/schemas/User\"}\n        age: {type: integer}", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head := strings.Replace(baseSpec, tt.from, tt.to, 1)
+			if tt.from != "" && head == baseSpec {
+				t.Fatalf("%q isn't in the spec", tt.from)
+			}
+			changes, err := openapi.Diff([]byte(baseSpec), []byte(head))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if len(changes) > 0 {
+					t.Errorf("changes = %v, want none", changes)
+				}
+				return
+			}
+			if len(changes) != 1 {
+				t.Fatalf("changes = %v, want %q", changes, tt.want)
+			}
+			c := changes[0]
+			if got := c.Operation + ": " + c.Message; got != tt.want || c.Breaking != tt.breaking {
+				t.Errorf("change = %q breaking %v, want %q breaking %v", got, c.Breaking, tt.want, tt.breaking)
+			}
+		})
+	}
+}
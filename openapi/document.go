@@ -0,0 +1,60 @@
+package openapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Document is an OpenAPI spec encoded once and served from memory.
+// It never changes after NewDocument, so it is safe for concurrent use.
+type Document struct {
+	spec    *Spec
+	json    []byte
+	etag    string
+	created time.Time
+}
+
+// NewDocument generates the spec of the handlers mounted on r, see Generate
+func NewDocument(r chi.Routes) (*Document, error) {
+	spec, err := Generate(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal OpenAPI spec: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return &Document{
+		spec:    spec,
+		json:    data,
+		etag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+		created: time.Now(),
+	}, nil
+}
+
+// Spec returns the generated spec, it must not be modified
+func (d *Document) Spec() *Spec {
+	return d.spec
+}
+
+// JSON returns the encoded spec
+func (d *Document) JSON() []byte {
+	return d.json
+}
+
+// ServeHTTP serves the spec as JSON. Clients revalidate with the ETag and get
+// 304 Not Modified while the spec is unchanged.
+func (d *Document) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", d.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "openapi.json", d.created, bytes.NewReader(d.json))
+}
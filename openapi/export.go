@@ -0,0 +1,57 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats a spec is exported in
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Encode returns the spec in format, json or yaml. Object keys are sorted and
+// the routes don't depend on registration order, so an unchanged API encodes
+// to the same bytes.
+func (d *Document) Encode(format string) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return append(slices.Clone(d.json), '\n'), nil
+	case FormatYAML:
+		return jsonToYAML(d.json)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected %s or %s", format, FormatJSON, FormatYAML)
+	}
+}
+
+// jsonToYAML converts JSON to block style YAML, keeping the order of the keys
+func jsonToYAML(data []byte) ([]byte, error) {
+	// JSON is YAML in flow style, reset the styles to get the block style
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("failed to convert the OpenAPI spec to YAML: %w", err)
+	}
+	resetStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, fmt.Errorf("failed to convert the OpenAPI spec to YAML: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
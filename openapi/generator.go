@@ -2,16 +2,17 @@
 package openapi
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"net/http"
 	"reflect"
 	"slices"
+	"strconv"
 	"strings"
-	"time"
 
-	"github.com/google/uuid"
+	"github.com/go-chi/chi/v5"
 )
 
 // SwaggerInfo holds the API information used by the OpenAPI spec
@@ -41,9 +42,24 @@ var SwaggerDoc = SwaggerInfo{
 	BasePath:    "/api/v1",
 }
 
-// GenerateSwaggerJSON generates the OpenAPI specification JSON file
-func GenerateSwaggerJSON(outputPath string) error {
-	spec := Spec{
+// Generate builds the OpenAPI spec of the handlers mounted on r.
+// The test routes and the documentation routes are left out.
+func Generate(r chi.Routes) (*Spec, error) {
+	routes, err := collectRoutes(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk routes: %w", err)
+	}
+	g := newSchemaGenerator("ProblemDetails", "ValidationFieldError")
+	paths, err := generatePaths(routes, g)
+	if err != nil {
+		return nil, err
+	}
+	components := generateComponents(g)
+	if err := checkReferences(routes, components); err != nil {
+		return nil, err
+	}
+
+	return &Spec{
 		OpenAPI: "3.1.0",
 		Info: map[string]interface{}{
 			"title":       SwaggerDoc.Title,
@@ -55,81 +71,76 @@ func GenerateSwaggerJSON(outputPath string) error {
 				"url": fmt.Sprintf("http://%s%s", SwaggerDoc.Host, SwaggerDoc.BasePath),
 			},
 		},
-		Paths:      generatePathsFromRegistry(),
-		Components: generateComponents(),
-	}
-
-	// path params?
-	// components schema?
-	// get route group name?
-
-	// Create directory if it doesn't exist
-	dir := filepath.Dir(outputPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
-	}
-
-	// Marshal to JSON with indentation
-	jsonData, err := json.MarshalIndent(spec, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal OpenAPI spec: %w", err)
-	}
-
-	// Write to file
-	if err := os.WriteFile(outputPath, jsonData, 0644); err != nil {
-		return fmt.Errorf("failed to write OpenAPI spec to file: %w", err)
-	}
-
-	return nil
+		Paths:      paths,
+		Components: components,
+	}, nil
 }
 
-// generatePathsFromRegistry creates the paths section of the OpenAPI spec from the route registry
-func generatePathsFromRegistry() map[string]interface{} {
-	// Group routes by path
-	routesByPath := make(map[string][]FuncInfo)
-	for _, route := range handlerFuncs {
-		if strings.HasPrefix(route.Path, "/docs") {
-			continue
+// collectRoutes walks r for handlers that describe themselves, sorted by path and
+// method. Hidden operations are left out.
+func collectRoutes(r chi.Routes) ([]FuncInfo, error) {
+	var routes []FuncInfo
+	err := chi.Walk(r, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if strings.HasPrefix(route, "/docs") || strings.Contains(route, "/test/") {
+			return nil
 		}
+		d, ok := handler.(Describer)
+		if !ok {
+			return nil
+		}
+		fi := d.Describe(method, route)
+		if fi.Hidden {
+			return nil
+		}
+		fi.RequireAuth = requireAuth(middlewares)
+		routes = append(routes, fi)
+		return nil
+	})
+	slices.SortFunc(routes, func(a, b FuncInfo) int {
+		return cmp.Or(strings.Compare(a.Path, b.Path), strings.Compare(a.Method, b.Method))
+	})
+	return routes, err
+}
 
-		// Normalize path for OpenAPI
-		apiPath := strings.TrimPrefix(route.Path, SwaggerDoc.BasePath)
-		routesByPath[apiPath] = append(routesByPath[apiPath], route)
-	}
-
+// generatePaths creates the paths section of the OpenAPI spec.
+// Paths outside SwaggerDoc.BasePath override the server URL.
+func generatePaths(routes []FuncInfo, g *schemaGenerator) (map[string]interface{}, error) {
 	paths := make(map[string]interface{})
-	// Process each path
-	for path, routes := range routesByPath {
-		pathItem := make(map[string]interface{})
-
-		for _, route := range routes {
-			// Convert HTTP method to lowercase
-			method := strings.ToLower(route.Method)
-
-			// Create operation for this method
-			operation := createOperationFromRouteInfo(route)
-
-			// Add to path item
-			pathItem[method] = operation
+	for _, route := range routes {
+		path, _ := openAPIPath(route.Path)
+		apiPath, ok := strings.CutPrefix(path, SwaggerDoc.BasePath)
+		pathItem, _ := paths[apiPath].(map[string]interface{})
+		if pathItem == nil {
+			pathItem = make(map[string]interface{})
+			if !ok {
+				pathItem["servers"] = []map[string]string{
+					{"url": fmt.Sprintf("http://%s", SwaggerDoc.Host)},
+				}
+			}
+			paths[apiPath] = pathItem
+		}
+		operation, err := createOperationFromRouteInfo(route, g)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", route.Method, route.Path, err)
 		}
-		paths[path] = pathItem
+		pathItem[strings.ToLower(route.Method)] = operation
 	}
-
-	return paths
+	return paths, nil
 }
 
 // createOperationFromRouteInfo creates an operation object for a route
-func createOperationFromRouteInfo(route FuncInfo) map[string]interface{} {
-	// Extract tag from route info
-	tag := route.Tag
-
-	// Default values
-	summary := route.Summary
-	description := route.Comment
-
-	// Create extra fields for security if middleware includes auth
+func createOperationFromRouteInfo(route FuncInfo, g *schemaGenerator) (map[string]interface{}, error) {
+	// Create extra fields for security if middleware includes auth, or the
+	// handler reads the token itself, unless the handler lists its schemes
 	var extraFields map[string]interface{}
-	if route.RequireAuth {
+	switch {
+	case route.Security != nil:
+		security := []map[string][]string{}
+		for _, scheme := range route.Security {
+			security = append(security, map[string][]string{scheme: {}})
+		}
+		extraFields = map[string]interface{}{"security": security}
+	case route.RequireAuth || bindsAuthorization(route):
 		extraFields = map[string]interface{}{
 			"security": []map[string][]string{
 				{"OAuth2PasswordBearer": {}},
@@ -138,297 +149,246 @@ func createOperationFromRouteInfo(route FuncInfo) map[string]interface{} {
 	}
 
 	// Create operation
-	return createOperation(route.Method, summary, description, tag, route.RequestType, route.ResponseType, extraFields)
-}
-
-// TODO: make it general
-// convertPathParams converts Hertz path params to OpenAPI path params
-func convertPathParams(path string) string {
-	segments := strings.Split(path, "/")
-	for i, segment := range segments {
-		if strings.HasPrefix(segment, ":") {
-			// Convert :id to {id}
-			paramName := strings.TrimPrefix(segment, ":")
-			segments[i] = "{" + paramName + "}"
-		}
-	}
-	return strings.Join(segments, "/")
-}
-
-// createOperation creates an operation object for the OpenAPI spec
-func createOperation(
-	method string,
-	summary string,
-	description string,
-	tag string,
-	requestType reflect.Type,
-	responseType reflect.Type,
-	extraFields ...map[string]interface{},
-) map[string]interface{} {
-	operation := map[string]interface{}{
-		"summary":     summary,
-		"description": description,
-		"tags":        []string{tag},
-		"responses": map[string]interface{}{
-			"200": map[string]interface{}{
-				"description": "Successful Response",
-				"content": map[string]interface{}{
-					"application/json": map[string]interface{}{
-						"schema": getSchemaRef(responseType),
-					},
-				},
-			},
-			"422": map[string]interface{}{
-				"description": "Validation Error",
-				"content": map[string]interface{}{
-					"application/json": map[string]interface{}{
-						"schema": map[string]interface{}{
-							"$ref": "#/components/schemas/HTTPValidationError",
+	operation, err := createOperation(g, route, extraFields)
+	if err != nil {
+		return nil, err
+	}
+
+	// Document every error the operation may return
+	responses := operation["responses"].(map[string]interface{})
+	for status, codes := range errorCodesByStatus(route) {
+		responses[strconv.Itoa(status)] = map[string]interface{}{
+			"description":   http.StatusText(status),
+			"x-error-codes": codes,
+			"content": map[string]interface{}{
+				ProblemContentType: map[string]interface{}{
+					"schema": map[string]interface{}{
+						"allOf": []interface{}{
+							map[string]interface{}{"$ref": "#/components/schemas/ProblemDetails"},
+							map[string]interface{}{
+								"properties": map[string]interface{}{
+									"status": map[string]interface{}{"const": status},
+									"code":   map[string]interface{}{"enum": codes},
+								},
+							},
 						},
 					},
 				},
 			},
-		},
+		}
 	}
 
-	if requestType != nil {
-		fieldTags := getTypeFieldTags(requestType)
-
-		if slices.Contains([]string{"GET", "DELETE"}, method) {
-			params := getQueryParameters(method, requestType)
-			if len(params) > 0 {
-				examples := generateExample(requestType)
-				// Add examples to each parameter
-				for i, param := range params {
-					fieldName := param["name"].(string)
-					if example, ok := examples[fieldName]; ok {
-						params[i]["example"] = example
-					}
-				}
-				if operation["parameters"] == nil {
-					operation["parameters"] = params
-				} else {
-					existing := operation["parameters"].([]map[string]interface{})
-					operation["parameters"] = append(existing, params...)
-				}
-			}
-		} else {
-			// Handle form data
-			if _, hasForm := fieldTags[TypeForm]; hasForm {
-				operation["requestBody"] = map[string]interface{}{
-					"content": map[string]interface{}{
-						"application/x-www-form-urlencoded": map[string]interface{}{
-							"schema": getSchemaRef(requestType),
-						},
-					},
-					"required": true,
-				}
-			}
-
-			// Handle JSON data
-			if _, hasJSON := fieldTags[TypeJSON]; hasJSON {
-				operation["requestBody"] = map[string]interface{}{
-					"content": map[string]interface{}{
-						"application/json": map[string]interface{}{
-							"schema": getSchemaRef(requestType),
-						},
-					},
-					"required": true,
-				}
+	// Declared responses replace the generated ones, but keep the error codes
+	// documented for their status
+	for _, r := range route.Responses {
+		status := strconv.Itoa(r.Status)
+		existing, _ := responses[status].(map[string]interface{})
+		if _, ok := existing["x-error-codes"]; ok && r.Type == nil && r.Schema == "ProblemDetails" {
+			if r.Description != "" {
+				existing["description"] = r.Description
 			}
+			continue
 		}
+		responses[status] = createResponse(g, r)
+	}
+	return operation, nil
+}
 
-		// Add extra fields if provided
-		if len(extraFields) > 0 {
-			for k, v := range extraFields[0] {
-				operation[k] = v
-			}
+// createResponse creates a response object for a declared response
+func createResponse(g *schemaGenerator, r ResponseInfo) map[string]interface{} {
+	description := r.Description
+	if description == "" {
+		description = http.StatusText(r.Status)
+	}
+	resp := map[string]interface{}{"description": description}
+
+	contentType, schema := TypeJSON, map[string]interface{}(nil)
+	switch {
+	case r.Type != nil:
+		schema = g.body(r.Type, response)
+	case r.Schema == "ProblemDetails":
+		contentType = ProblemContentType
+		schema = map[string]interface{}{"$ref": "#/components/schemas/" + r.Schema}
+	case r.Schema != "":
+		schema = map[string]interface{}{"$ref": "#/components/schemas/" + r.Schema}
+	}
+	if schema != nil {
+		resp["content"] = map[string]interface{}{
+			contentType: map[string]interface{}{"schema": schema},
 		}
 	}
-	return operation
+	return resp
 }
 
-// Constants for content types
-const (
-	// TypeJSON represents the JSON content type
-	TypeJSON   = "application/json"
-	TypeURI    = "uri"
-	TypeForm   = "form"
-	TypeHeader = "header"
-	TypeQuery  = "query"
-)
-
-// FieldInfo contains information about a struct field for OpenAPI documentation
-type FieldInfo struct {
-	Name string
-	Type string
-	// VD   []string
+// checkReferences checks that the schemas and security schemes the routes name
+// are in components, and that operation IDs are unique
+func checkReferences(routes []FuncInfo, components map[string]interface{}) error {
+	schemas, _ := components["schemas"].(map[string]interface{})
+	schemes, _ := components["securitySchemes"].(map[string]interface{})
+	operationIDs := map[string]FuncInfo{}
+	for _, route := range routes {
+		for _, r := range route.Responses {
+			if _, ok := schemas[r.Schema]; r.Schema != "" && !ok {
+				return fmt.Errorf("%s %s: response %d: unknown schema %q", route.Method, route.Path, r.Status, r.Schema)
+			}
+		}
+		for _, scheme := range route.Security {
+			if _, ok := schemes[scheme]; !ok {
+				return fmt.Errorf("%s %s: unknown security scheme %q", route.Method, route.Path, scheme)
+			}
+		}
+		if route.OperationID == "" {
+			continue
+		}
+		if other, ok := operationIDs[route.OperationID]; ok {
+			return fmt.Errorf("%s %s: operation ID %q is also used by %s %s", route.Method, route.Path, route.OperationID, other.Method, other.Path)
+		}
+		operationIDs[route.OperationID] = route
+	}
+	return nil
 }
 
-func getTypeFieldTags(t reflect.Type) map[string][]FieldInfo {
-	fieldsInfo := make(map[string][]FieldInfo)
-	// Handle nil type
-	if t == nil {
-		return fieldsInfo
+// errorCodesByStatus collects the error codes an operation may return, grouped by status.
+// Generic errors are derived from the route, domain errors come from `@error` annotations.
+// Database timeouts and unique violations surface as generic errors too, see middleware.ToAPIError.
+func errorCodesByStatus(route FuncInfo) map[int][]string {
+	codes := map[int][]string{
+		http.StatusInternalServerError: {"internal_error"},
+		http.StatusServiceUnavailable:  {"service_unavailable"},
+	}
+	add := func(status int, code string) {
+		if !slices.Contains(codes[status], code) {
+			codes[status] = append(codes[status], code)
+		}
 	}
 
-	// Handle pointer types
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
+	if route.RequireAuth {
+		add(http.StatusUnauthorized, "unauthorized")
+		add(http.StatusUnauthorized, "auth.token_revoked")
+		add(http.StatusUnauthorized, "auth.inactive_user")
 	}
-
-	// Only process struct types
-	if t.Kind() != reflect.Struct {
-		return fieldsInfo
+	switch route.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		add(http.StatusConflict, "conflict")
 	}
-
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		if jsonTag, ok := field.Tag.Lookup("json"); ok {
-			jsonField := FieldInfo{
-				Name: jsonTag,
-				Type: TypeJSON,
-			}
-			fieldsInfo[TypeJSON] = append(fieldsInfo[TypeJSON], jsonField)
-		} else if uriTag, ok := field.Tag.Lookup("uri"); ok {
-			uriField := FieldInfo{
-				Name: uriTag,
-				Type: TypeURI,
-			}
-			fieldsInfo[TypeURI] = append(fieldsInfo[TypeURI], uriField)
-		} else if formTag, ok := field.Tag.Lookup("form"); ok {
-			formField := FieldInfo{
-				Name: formTag,
-				Type: TypeForm,
-			}
-			fieldsInfo[TypeForm] = append(fieldsInfo[TypeForm], formField)
-		} else if headerTag, ok := field.Tag.Lookup("header"); ok {
-			headerField := FieldInfo{
-				Name: headerTag,
-				Type: TypeHeader,
-			}
-			fieldsInfo[TypeHeader] = append(fieldsInfo[TypeHeader], headerField)
-		} else if queryTag, ok := field.Tag.Lookup("query"); ok {
-			queryField := FieldInfo{
-				Name: queryTag,
-				Type: TypeQuery,
-			}
-			fieldsInfo[TypeQuery] = append(fieldsInfo[TypeQuery], queryField)
-		}
+	if len(route.RequestFields) > 0 || len(requestJSONFields(route.RequestType)) > 0 {
+		add(http.StatusBadRequest, "bad_request")
+	}
+	if hasBindingRules(route.RequestType) {
+		add(http.StatusUnprocessableEntity, "validation_failed")
 	}
-	return fieldsInfo
+	for _, e := range route.Errors {
+		add(e.Status, e.Code)
+	}
+	return codes
 }
 
-// getQueryParameters extracts query parameters from a struct type
-func getQueryParameters(method string, t reflect.Type) []map[string]interface{} {
-	var params []map[string]interface{}
-	// Handle nil type
+// hasBindingRules reports whether any field of t declares validation rules
+func hasBindingRules(t reflect.Type) bool {
 	if t == nil {
-		return params
+		return false
 	}
-
-	// Handle pointer types
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
-
-	// Only process struct types
 	if t.Kind() != reflect.Struct {
-		return params
+		return false
 	}
 	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		var fieldTag string
-		var queryType string
-		if _, ok := field.Tag.Lookup("query"); ok {
-			fieldTag = field.Tag.Get("query")
-			queryType = "query"
-		} else if _, ok := field.Tag.Lookup("header"); ok {
-			fieldTag = field.Tag.Get("header")
-			queryType = "header"
-		} else if _, ok := field.Tag.Lookup("uri"); ok {
-			fieldTag = field.Tag.Get("uri")
-			queryType = "path"
-		} else if _, ok := field.Tag.Lookup("cookie"); ok {
-			fieldTag = field.Tag.Get("cookie")
-			queryType = "cookie"
-		} else {
-			if strings.ToUpper(method) == "GET" {
-				if _, ok := field.Tag.Lookup("form"); ok {
-					fieldTag = field.Tag.Get("form")
-					queryType = "query"
-				}
-			}
+		if rules := t.Field(i).Tag.Get("binding"); rules != "" && rules != "omitempty" {
+			return true
 		}
-		if fieldTag == "" {
-			continue
-		}
-		param := map[string]interface{}{
-			"name":     fieldTag,
-			"in":       queryType,
-			"required": field.Tag.Get("binding") != "" && strings.Contains(field.Tag.Get("binding"), "required"),
-			"schema":   getTypeSchema(field.Type),
-		}
-		// Add default value if specified
-		defaultTag := field.Tag.Get("default")
-		if defaultTag != "" {
-			param["schema"].(map[string]interface{})["default"] = defaultTag
-		}
-		params = append(params, param)
 	}
-
-	return params
+	return false
 }
 
-// getSchemaRef returns a schema reference for a type
-func getSchemaRef(t reflect.Type) map[string]interface{} {
-	if t == nil {
-		return map[string]interface{}{
-			"type": "object",
-		}
+// createOperation creates an operation object for the OpenAPI spec
+func createOperation(g *schemaGenerator, route FuncInfo, extraFields ...map[string]interface{}) (map[string]interface{}, error) {
+	operation := map[string]interface{}{
+		"summary":     route.Summary,
+		"description": route.Description,
+		"tags":        []string{route.Tag},
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "Successful Response",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": g.body(route.ResponseType, response),
+					},
+				},
+			},
+		},
 	}
 
-	// Handle pointer types
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
+	if params := getParameters(route, g); len(params) > 0 {
+		operation["parameters"] = params
 	}
-
-	// Get schema properties and required fields
-	properties := getStructProperties(t)
-	required := getRequiredFields(t)
-
-	schema := map[string]interface{}{
-		"type":       "object",
-		"properties": properties,
+	if body := getRequestBody(route, g); body != nil {
+		operation["requestBody"] = body
 	}
-
-	if len(required) > 0 {
-		schema["required"] = required
+	if route.OperationID != "" {
+		operation["operationId"] = route.OperationID
+	}
+	if route.Deprecated {
+		operation["deprecated"] = true
 	}
 
-	// Add example if available
-	if example := generateExample(t); len(example) > 0 {
-		schema["example"] = example
+	// The declared example replaces the generated one
+	if route.Example != nil {
+		if raw, ok := route.Example.(json.RawMessage); ok && !json.Valid(raw) {
+			return nil, fmt.Errorf("example isn't valid JSON: %s", raw)
+		}
+		body, ok := operation["requestBody"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("example for an operation without a request body")
+		}
+		for _, mediaType := range body["content"].(map[string]interface{}) {
+			mediaType.(map[string]interface{})["example"] = route.Example
+		}
 	}
 
-	return schema
+	// Add extra fields if provided
+	if len(extraFields) > 0 {
+		for k, v := range extraFields[0] {
+			operation[k] = v
+		}
+	}
+	return operation, nil
 }
 
-// generateExample generates an example object for a type
-// TODO: make it apply to the validation rules
+// Constants for content types
+const (
+	// TypeJSON represents the JSON content type
+	TypeJSON = "application/json"
+	// TypeFormURLEncoded represents the content type of HTML forms
+	TypeFormURLEncoded = "application/x-www-form-urlencoded"
+	TypeURI            = "uri"
+	TypeForm           = "form"
+	TypeHeader         = "header"
+	TypeQuery          = "query"
+	TypeCookie         = "cookie"
+	TypeFile           = "file"
+	// TypeMultipart represents the multipart form content type used for file uploads
+	TypeMultipart = "multipart/form-data"
+	// ProblemContentType represents the RFC 9457 error content type
+	ProblemContentType = "application/problem+json"
+)
+
+// generateExample generates an example JSON body for a request type
 func generateExample(t reflect.Type) map[string]interface{} {
 	example := make(map[string]interface{})
+	for _, f := range requestJSONFields(t) {
+		field, name := f.field, f.name
 
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-
-		// Get field name from json or form tag
-		var name string
-		if jsonTag := field.Tag.Get("json"); jsonTag != "" && jsonTag != "-" {
-			name = strings.Split(jsonTag, ",")[0]
-		} else if formTag := field.Tag.Get("form"); formTag != "" && formTag != "-" {
-			name = strings.Split(formTag, ",")[0]
-		} else {
+		// Values the rules allow come first
+		rules := map[string]interface{}{}
+		applyRules(rules, field)
+		if value, ok := rules["const"]; ok {
+			example[name] = value
+			continue
+		}
+		if enum, ok := rules["enum"].([]any); ok {
+			example[name] = enum[0]
 			continue
 		}
 
@@ -463,144 +423,61 @@ func generateExample(t reflect.Type) map[string]interface{} {
 	return example
 }
 
-// getRequiredFields returns a list of required field names
-func getRequiredFields(t reflect.Type) []string {
-	var required []string
-
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-
-		jsonTag := field.Tag.Get("json")
-		if jsonTag == "" || jsonTag == "-" {
-			continue
-		}
-		name := strings.Split(jsonTag, ",")[0]
-
-		// Check binding tag for required
-		bindingTag := field.Tag.Get("binding")
-		if strings.Contains(bindingTag, "required") {
-			required = append(required, name)
-		}
-	}
-
-	return required
-}
-
-// getTypeSchema returns a schema for a specific type
-func getTypeSchema(t reflect.Type) map[string]interface{} {
-	schema := make(map[string]interface{})
-
-	switch t.Kind() {
-	case reflect.String:
-		schema["type"] = "string"
-	case reflect.Bool:
-		schema["type"] = "boolean"
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		schema["type"] = "integer"
-	case reflect.Float32, reflect.Float64:
-		schema["type"] = "number"
-	case reflect.Slice, reflect.Array:
-		schema["type"] = "array"
-		schema["items"] = getTypeSchema(t.Elem())
-	case reflect.Struct:
-		if t == reflect.TypeOf(time.Time{}) {
-			schema["type"] = "string"
-			schema["format"] = "date-time"
-		} else if t == reflect.TypeOf(uuid.UUID{}) {
-			schema["type"] = "string"
-			schema["format"] = "uuid"
-		} else {
-			schema["type"] = "object"
-			schema["properties"] = getStructProperties(t)
-		}
-	case reflect.Map:
-		schema["type"] = "object"
-		if t.Key().Kind() == reflect.String {
-			schema["additionalProperties"] = getTypeSchema(t.Elem())
-		}
-	default:
-		schema["type"] = "object"
-	}
-
-	return schema
-}
-
-// getStructProperties extracts properties from a struct type
-func getStructProperties(t reflect.Type) map[string]interface{} {
-	properties := make(map[string]interface{})
-
-	// Handle nil type
-	if t == nil {
-		return properties
-	}
-
-	// Handle pointer types
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
-	}
-
-	// Only process struct types
-	if t.Kind() != reflect.Struct {
-		return properties
-	}
-
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-
-		// Skip unexported fields
-		if !field.IsExported() {
-			continue
-		}
-
-		jsonTag := field.Tag.Get("json")
-		if jsonTag == "" || jsonTag == "-" {
-			continue
-		}
-
-		// Parse the json tag to get the field name and options
-		parts := strings.Split(jsonTag, ",")
-		name := parts[0]
-
-		// Check if the field is required
-		// requiredFields := []string{}
-		// bindingTag := field.Tag.Get("binding")
-		// if bindingTag != "" && strings.Contains(bindingTag, "required") {
-		// 	requiredFields = append(requiredFields, name)
-		// }
-
-		properties[name] = getTypeSchema(field.Type)
-	}
-
-	return properties
-}
-
 // generateComponents creates the components section of the OpenAPI spec
-func generateComponents() map[string]interface{} {
+func generateComponents(g *schemaGenerator) map[string]interface{} {
 	components := make(map[string]interface{})
-	schemas := make(map[string]interface{})
 
-	// Add schemas from route registry
-	for _, route := range handlerFuncs {
-		// Add request type schema if available
-		if route.RequestType != nil {
-			addSchemas(schemas, route.RequestType)
-		}
-
-		// Add response type schema if available
-		if route.ResponseType != nil {
-			addSchemas(schemas, route.ResponseType)
-		}
-	}
+	// Add the schemas referenced by the routes
+	schemas := g.schemas()
 
-	// Add validation error schemas
-	schemas["HTTPValidationError"] = map[string]interface{}{
+	// Add error schemas, mirroring middleware.APIError and middleware.FieldError
+	schemas["ValidationFieldError"] = map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
-			"error": map[string]interface{}{
+			"field":   map[string]interface{}{"type": "string"},
+			"rule":    map[string]interface{}{"type": "string"},
+			"param":   map[string]interface{}{"type": "string"},
+			"message": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"field", "rule", "message"},
+	}
+	schemas["ProblemDetails"] = map[string]interface{}{
+		"type":        "object",
+		"description": "RFC 9457 problem details",
+		"properties": map[string]interface{}{
+			"type": map[string]interface{}{
+				"type":   "string",
+				"format": "uri-reference",
+			},
+			"title": map[string]interface{}{
+				"type": "string",
+			},
+			"status": map[string]interface{}{
+				"type": "integer",
+			},
+			"detail": map[string]interface{}{
 				"type": "string",
 			},
+			"instance": map[string]interface{}{
+				"type":   "string",
+				"format": "uri-reference",
+			},
+			"code": map[string]interface{}{
+				"type":        "string",
+				"description": "Stable machine-readable error code",
+			},
+			"request_id": map[string]interface{}{
+				"type": "string",
+			},
+			"errors": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"$ref": "#/components/schemas/ValidationFieldError",
+				},
+			},
 		},
+		"required":             []string{"type", "title", "status", "code"},
+		"additionalProperties": true,
 	}
 
 	components["schemas"] = schemas
@@ -611,8 +488,9 @@ func generateComponents() map[string]interface{} {
 			"type": "oauth2",
 			"flows": map[string]interface{}{
 				"password": map[string]interface{}{
-					"scopes":   map[string]interface{}{},
-					"tokenUrl": "/api/v1/login/access-token",
+					"scopes":     map[string]interface{}{},
+					"tokenUrl":   "/api/v1/login/access-token",
+					"refreshUrl": "/api/v1/login/refresh",
 				},
 			},
 		},
@@ -620,49 +498,3 @@ func generateComponents() map[string]interface{} {
 
 	return components
 }
-
-// addSchemas adds a schema to the schemas map
-func addSchemas(schemas map[string]interface{}, t reflect.Type) {
-	// Handle pointer types
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
-	}
-	// Only process struct types
-	if t.Kind() != reflect.Struct {
-		return
-	}
-
-	// Skip if already added
-	if _, exists := schemas[t.Name()]; exists {
-		return
-	}
-
-	schema := map[string]interface{}{
-		"type":       "object",
-		"properties": getStructProperties(t),
-	}
-
-	// Add required fields
-	var required []string
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		jsonTag := field.Tag.Get("json")
-		if jsonTag == "" || jsonTag == "-" {
-			continue
-		}
-
-		parts := strings.Split(jsonTag, ",")
-		name := parts[0]
-
-		bindingTag := field.Tag.Get("binding")
-		if bindingTag != "" && strings.Contains(bindingTag, "required") {
-			required = append(required, name)
-		}
-	}
-
-	if len(required) > 0 {
-		schema["required"] = required
-	}
-
-	schemas[t.Name()] = schema
-}
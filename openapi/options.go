@@ -0,0 +1,80 @@
+package openapi
+
+import "reflect"
+
+// Option sets the documentation of an operation from Go code, for handlers whose
+// comments can't be read at runtime. Options override the annotations of the
+// doc comment, see middleware.WithHandler.
+type Option func(*FuncInfo)
+
+// Tag groups the operation under tag, like `@tag`
+func Tag(tag string) Option {
+	return func(fi *FuncInfo) { fi.Tag = tag }
+}
+
+// Summary sets the summary of the operation, like `@summary`
+func Summary(summary string) Option {
+	return func(fi *FuncInfo) { fi.Summary = summary }
+}
+
+// Description sets the description of the operation, like `@description`
+func Description(description string) Option {
+	return func(fi *FuncInfo) { fi.Description = description }
+}
+
+// OperationID sets the unique name of the operation, like `@operationId`
+func OperationID(id string) Option {
+	return func(fi *FuncInfo) { fi.OperationID = id }
+}
+
+// Deprecated marks the operation deprecated, like `@deprecated`
+func Deprecated() Option {
+	return func(fi *FuncInfo) { fi.Deprecated = true }
+}
+
+// Hidden leaves the operation out of the spec, like `@hidden`
+func Hidden() Option {
+	return func(fi *FuncInfo) { fi.Hidden = true }
+}
+
+// Error documents an error response with its code, like `@error`
+func Error(status int, code string) Option {
+	return func(fi *FuncInfo) {
+		fi.Errors = append(fi.Errors, ErrorInfo{Status: status, Code: code})
+	}
+}
+
+// Response documents a response whose body has the type of body, nil for no
+// body. An empty description defaults to the status text.
+func Response(status int, body any, description string) Option {
+	return func(fi *FuncInfo) {
+		fi.Responses = append(fi.Responses, ResponseInfo{
+			Status:      status,
+			Type:        reflect.TypeOf(body),
+			Description: description,
+		})
+	}
+}
+
+// ResponseRef documents a response whose body is the component schema named
+// schema, like `@response`
+func ResponseRef(status int, schema, description string) Option {
+	return func(fi *FuncInfo) {
+		fi.Responses = append(fi.Responses, ResponseInfo{
+			Status:      status,
+			Schema:      schema,
+			Description: description,
+		})
+	}
+}
+
+// Example sets the example request body, it's encoded as JSON like `@example`
+func Example(example any) Option {
+	return func(fi *FuncInfo) { fi.Example = example }
+}
+
+// Security lists the security schemes of the operation, like `@security`. With
+// no schemes the operation is documented as public.
+func Security(schemes ...string) Option {
+	return func(fi *FuncInfo) { fi.Security = append([]string{}, schemes...) }
+}
@@ -2,52 +2,28 @@ package openapi
 
 import (
 	"context"
-	"fmt"
-	"go/build"
+	"encoding/json"
+	"go/ast"
 	"go/parser"
 	"go/token"
+	"io/fs"
 	"net/http"
-	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
-
-	"github.com/go-chi/chi/v5"
 )
 
-var handlerFuncs = make(map[string]FuncInfo)
-var mws = make(map[string][]string)
-
-func RegisterMws(r chi.Routes) {
-	clear(mws)
-	chi.Walk(r, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
-		for _, mw := range middlewares {
-			mws[method+":"+route] = append(mws[method+":"+route], runtime.FuncForPC(reflect.ValueOf(mw).Pointer()).Name())
-		}
-		return nil
-	})
-}
-
-// RegisterHandler adds route information to the registry
-func RegisterHandler[Req any, Resp any](method, pattern string, handlerFunc func(context.Context, Req) (Resp, error)) {
-	// return if is production env
-	if os.Getenv("ENV") == "production" {
-		return
-	}
-	if strings.Contains(pattern, "/test/") {
-		return
-	}
-	if _, ok := handlerFuncs[method+":"+pattern]; ok {
-		return
-	}
-	funcInfo := buildFuncInfo(method, pattern, handlerFunc)
-	handlerFuncs[method+":"+pattern] = funcInfo
+// Describer is implemented by handlers that document their operation, see middleware.WithHandler
+type Describer interface {
+	Describe(method, pattern string) FuncInfo
 }
 
-func requireAuth(method, pattern string) bool {
-	for _, mw := range mws[method+":"+pattern] {
-		if strings.Contains(mw, "RequireAuth") {
+// requireAuth reports whether one of the middlewares of a route requires authentication
+func requireAuth(middlewares []func(http.Handler) http.Handler) bool {
+	for _, mw := range middlewares {
+		if strings.Contains(runtime.FuncForPC(reflect.ValueOf(mw).Pointer()).Name(), "RequireAuth") {
 			return true
 		}
 	}
@@ -69,79 +45,160 @@ type FuncInfo struct {
 	Anonymous    bool   `json:"anonymous,omitempty"`
 	Unresolvable bool   `json:"unresolvable,omitempty"`
 	RequireAuth  bool   `json:"require_auth,omitempty"`
+	// Description is the comment without its annotations, unless `@description` sets it
+	Description string `json:"description,omitempty"`
+	// OperationID is the unique name of the operation for client generators, set with `@operationId`
+	OperationID string `json:"operation_id,omitempty"`
+	Deprecated  bool   `json:"deprecated,omitempty"`
+	// Hidden operations are left out of the spec, set with `@hidden`
+	Hidden bool `json:"hidden,omitempty"`
+	// Errors are the documented error responses, declared with `@error <status> <code>`
+	Errors []ErrorInfo `json:"errors,omitempty"`
+	// Responses are the other documented responses, declared with `@response <status> [schema|-] [description]`
+	Responses []ResponseInfo `json:"responses,omitempty"`
+	// Example is the example request body, `@example` takes it as JSON
+	Example any `json:"example,omitempty"`
+	// Security lists the security schemes of the operation, declared with `@security [scheme...]`.
+	// Nil derives them from the route's middlewares, empty documents a public operation.
+	Security []string `json:"security,omitempty"`
+	// RequestFields are the fields of RequestType bound from the request, set by the Describer
+	RequestFields []RequestField `json:"-"`
 }
 
-func getGoPath() string {
-	goPath := os.Getenv("GOPATH")
-	if goPath == "" {
-		goPath = build.Default.GOPATH
-	}
-	return goPath
+// ErrorInfo describes an error response an operation may return
+type ErrorInfo struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
 }
-func buildFuncInfo[Req any, Resp any](method, path string, i func(context.Context, Req) (Resp, error)) FuncInfo {
+
+// ResponseInfo describes a response an operation may return
+type ResponseInfo struct {
+	Status int `json:"status"`
+	// Schema names a component schema of the body, Type is the Go type of the body.
+	// A response with neither has no body.
+	Schema      string       `json:"schema,omitempty"`
+	Type        reflect.Type `json:"-"`
+	Description string       `json:"description,omitempty"`
+}
+
+// sources are the embedded source files of the handler packages by import path, see RegisterSources
+var sources = map[string]fs.FS{}
+
+// RegisterSources makes the doc comments of the handlers in package pkg available
+// from fsys, which holds the package's source files. Binaries built without the
+// sources next to them, like the Docker image, read the annotations from there.
+func RegisterSources(pkg string, fsys fs.FS) {
+	sources[pkg] = fsys
+}
+
+// Describe collects the route information of a typed handler: its request and
+// response types and the annotations in its doc comment
+func Describe[Req any, Resp any](method, path string, i func(context.Context, Req) (Resp, error)) FuncInfo {
 	fi := FuncInfo{}
 	fi.Method = method
 	fi.Path = path
-	// tag defaults to path first part after trim /api/v1/
-	fi.Tag = strings.Split(path, "/")[3]
-	fi.RequireAuth = requireAuth(method, path)
+	fi.Tag = defaultTag(path)
 	fi.RequestType = reflect.TypeOf((*Req)(nil)).Elem()
 	fi.ResponseType = reflect.TypeOf((*Resp)(nil)).Elem()
-	frame := getCallerFrame(i)
-	goPathSrc := filepath.Join(getGoPath(), "src")
 
+	frame := getCallerFrame(i)
 	if frame == nil {
 		fi.Unresolvable = true
 		return fi
 	}
-
-	pkgName := getPkgName(frame.File)
-	if pkgName == "chi" {
-		fi.Unresolvable = true
-	}
-	funcPath := frame.Func.Name()
-
-	idx := strings.Index(funcPath, "/"+pkgName)
-	if idx > 0 {
-		fi.Pkg = funcPath[:idx+1+len(pkgName)]
-		fi.Func = funcPath[idx+2+len(pkgName):]
-	} else {
-		fi.Func = funcPath
-	}
-
-	if strings.Index(fi.Func, ".func") > 0 {
-		fi.Anonymous = true
-	}
-
-	fi.File = frame.File
+	fi.Pkg, fi.Func = splitFuncName(frame.Function)
+	fi.Anonymous = strings.Contains(fi.Func, ".func")
+	fi.File = filepath.Base(frame.File)
 	fi.Line = frame.Line
-	if filepath.HasPrefix(fi.File, goPathSrc) {
-		fi.File = fi.File[len(goPathSrc)+1:]
-	}
 
-	// Check if file info is unresolvable
-	if !strings.Contains(funcPath, pkgName) {
+	if fi.Pkg == "" {
 		fi.Unresolvable = true
+		return fi
 	}
+	fi.Comment = getFuncComment(fi.Pkg, frame.File, frame.Line)
+	parseComment(&fi)
+	return fi
+}
 
-	if !fi.Unresolvable {
-		fi.Comment = getFuncComment(frame.File, frame.Line)
-		parseComment(&fi)
+// splitFuncName splits a qualified function name like example.com/mod/pkg.Func.func1
+// into its package import path and the name within the package
+func splitFuncName(name string) (pkg, fn string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
 	}
+	return name[:slash+1+dot], name[slash+2+dot:]
+}
 
-	return fi
+// defaultTag returns the first path segment after /api/v1/, or the first segment of other paths
+func defaultTag(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 2 && segments[0] == "api" {
+		return segments[2]
+	}
+	return segments[0]
 }
 
+// parseComment reads the annotations of the doc comment of a handler, the lines
+// starting with @. The other lines are the description.
 func parseComment(fi *FuncInfo) {
-	// split by new line and parse the line start with @tag
-	lines := strings.Split(fi.Comment, "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(strings.ToLower(line), "@tag") {
-			fi.Tag = strings.TrimSpace(line[5:])
-		} else if strings.HasPrefix(strings.ToLower(line), "@summary") {
-			fi.Summary = strings.TrimSpace(line[9:])
+	var description []string
+	for _, line := range strings.Split(fi.Comment, "\n") {
+		if !strings.HasPrefix(line, "@") {
+			description = append(description, line)
+			continue
+		}
+		keyword, value, _ := strings.Cut(line[1:], " ")
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(keyword) {
+		case "tag":
+			fi.Tag = value
+		case "summary":
+			fi.Summary = value
+		case "description":
+			fi.Description = value
+		case "operationid":
+			fi.OperationID = value
+		case "deprecated":
+			fi.Deprecated = true
+		case "hidden":
+			fi.Hidden = true
+		case "error":
+			fields := strings.Fields(value)
+			if len(fields) < 2 {
+				continue
+			}
+			status, err := strconv.Atoi(fields[0])
+			if err != nil {
+				continue
+			}
+			fi.Errors = append(fi.Errors, ErrorInfo{Status: status, Code: fields[1]})
+		case "response":
+			code, rest, _ := strings.Cut(value, " ")
+			status, err := strconv.Atoi(code)
+			if err != nil {
+				continue
+			}
+			// - stands for no body, to describe one
+			schema, description, _ := strings.Cut(strings.TrimSpace(rest), " ")
+			if schema == "-" {
+				schema = ""
+			}
+			fi.Responses = append(fi.Responses, ResponseInfo{
+				Status:      status,
+				Schema:      schema,
+				Description: strings.TrimSpace(description),
+			})
+		case "example":
+			fi.Example = json.RawMessage(value)
+		case "security":
+			fi.Security = append([]string{}, strings.Fields(value)...)
 		}
 	}
+	if fi.Description == "" {
+		fi.Description = strings.TrimSpace(strings.Join(description, "\n"))
+	}
 }
 
 func getCallerFrame(i interface{}) *runtime.Frame {
@@ -161,38 +218,48 @@ func getCallerFrame(i interface{}) *runtime.Frame {
 	return &frame
 }
 
-func getFuncComment(file string, line int) string {
-	fset := token.NewFileSet()
+// getFuncComment returns the doc comment of the function declared at line of file,
+// read from the registered sources of pkg or else from disk
+func getFuncComment(pkg, file string, line int) string {
+	var src any // nil reads file from disk
+	if fsys, ok := sources[pkg]; ok {
+		data, err := fs.ReadFile(fsys, filepath.Base(file))
+		if err != nil {
+			return ""
+		}
+		src = data
+	}
 
-	astFile, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, file, src, parser.ParseComments)
 	if err != nil {
-		fmt.Printf("Error parsing file: %v\n", err)
 		return ""
 	}
 
-	if len(astFile.Comments) == 0 {
-		fmt.Printf("No comments found in file %s\n", file)
-		return ""
+	// line is where the function's code starts, its declaration line or, for
+	// functions without a prologue, the line of its first statement. Find the
+	// innermost function around it.
+	var fn ast.Node
+	ast.Inspect(astFile, func(n ast.Node) bool {
+		if n == nil || fset.Position(n.Pos()).Line > line || fset.Position(n.End()).Line < line {
+			return false
+		}
+		switch n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			fn = n
+		}
+		return true
+	})
+	if decl, ok := fn.(*ast.FuncDecl); ok {
+		return decl.Doc.Text()
+	}
+	if fn != nil {
+		line = fset.Position(fn.Pos()).Line
 	}
-
 	for _, cmt := range astFile.Comments {
 		if fset.Position(cmt.End()).Line+1 == line {
 			return cmt.Text()
 		}
 	}
-
-	fmt.Printf("No comment found at line %d in file %s\n", line, file)
 	return ""
 }
-
-func getPkgName(file string) string {
-	fset := token.NewFileSet()
-	astFile, err := parser.ParseFile(fset, file, nil, parser.PackageClauseOnly)
-	if err != nil {
-		return ""
-	}
-	if astFile.Name == nil {
-		return ""
-	}
-	return astFile.Name.Name
-}
@@ -0,0 +1,191 @@
+package openapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wangfenjin/mojito/middleware"
+	"github.com/wangfenjin/mojito/openapi"
+)
+
+type ArchiveNodeRequest struct {
+	ID     string `uri:"id"`
+	Reason string `json:"reason"`
+}
+
+// Archive a node, its children are archived too
+// @summary Archive node
+// @tag nodes
+// @description Archive a node and its children
+// @operationId archiveNode
+// @deprecated
+// @error 404 node.not_found
+// @response 404 ProblemDetails The node doesn't exist
+// @response 202 - Archiving started
+// @example {"reason": "obsolete"}
+// @security
+func archiveNode(context.Context, ArchiveNodeRequest) (*NodeResponse, error) {
+	return nil, nil
+}
+
+func archiveNodeWithOptions(context.Context, ArchiveNodeRequest) (*NodeResponse, error) {
+	return nil, nil
+}
+
+var archiveNodeOptions = []openapi.Option{
+	openapi.Summary("Archive node"),
+	openapi.Tag("nodes"),
+	openapi.Description("Archive a node and its children"),
+	openapi.OperationID("archiveNode"),
+	openapi.Deprecated(),
+	openapi.Error(http.StatusNotFound, "node.not_found"),
+	openapi.ResponseRef(http.StatusNotFound, "ProblemDetails", "The node doesn't exist"),
+	openapi.Response(http.StatusAccepted, nil, "Archiving started"),
+	openapi.Example(map[string]string{"reason": "obsolete"}),
+	openapi.Security(),
+}
+
+// Ping the server
+// @hidden
+func ping(context.Context, ArchiveNodeRequest) (*NodeResponse, error) {
+	return nil, nil
+}
+
+// operation generates the spec of r and returns the operation of method and path
+func operation(t *testing.T, r chi.Routes, method, path string) map[string]any {
+	t.Helper()
+	spec, err := openapi.Generate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(spec.Paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths map[string]map[string]any
+	if err := json.Unmarshal(data, &paths); err != nil {
+		t.Fatal(err)
+	}
+	op, _ := paths[path][strings.ToLower(method)].(map[string]any)
+	return op
+}
+
+func TestAnnotations(t *testing.T) {
+	r := chi.NewRouter()
+	r.Method(http.MethodPost, "/api/v1/nodes/{id}/archive", middleware.WithHandler(archiveNode))
+	r.Method(http.MethodGet, "/ping", middleware.WithHandler(ping))
+	op := operation(t, r, http.MethodPost, "/nodes/{id}/archive")
+
+	want := map[string]any{
+		"summary":     `"Archive node"`,
+		"tags":        `["nodes"]`,
+		"description": `"Archive a node and its children"`,
+		"operationId": `"archiveNode"`,
+		"deprecated":  `true`,
+		"security":    `[]`,
+	}
+	for key, value := range want {
+		if got, want := op[key], jsonValue(t, value.(string)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+
+	responses := op["responses"].(map[string]any)
+	notFound := responses["404"].(map[string]any)
+	if notFound["description"] != "The node doesn't exist" || notFound["x-error-codes"] == nil {
+		t.Errorf("404 response = %v, want the description and the error codes", notFound)
+	}
+	if accepted := responses["202"]; !reflect.DeepEqual(accepted, jsonValue(t, `{"description": "Archiving started"}`)) {
+		t.Errorf("202 response = %v", accepted)
+	}
+	example := op["requestBody"].(map[string]any)["content"].(map[string]any)[openapi.TypeJSON].(map[string]any)["example"]
+	if want := jsonValue(t, `{"reason": "obsolete"}`); !reflect.DeepEqual(example, want) {
+		t.Errorf("example = %v, want %v", example, want)
+	}
+
+	if op := operation(t, r, http.MethodGet, "/ping"); op != nil {
+		t.Errorf("hidden operation is documented: %v", op)
+	}
+}
+
+// fakeRequireAuth stands for the authentication middleware, routes are matched by its name
+func fakeRequireAuth(next http.Handler) http.Handler {
+	return next
+}
+
+func TestGenericErrors(t *testing.T) {
+	r := chi.NewRouter()
+	r.With(fakeRequireAuth).Method(http.MethodPost, "/api/v1/nodes/{id}/archive", middleware.WithHandler(archiveNodeWithOptions))
+	r.Method(http.MethodGet, "/api/v1/nodes/{id}", middleware.WithHandler(archiveNodeWithOptions))
+
+	codes := func(op map[string]any) map[string]any {
+		got := map[string]any{}
+		for status, resp := range op["responses"].(map[string]any) {
+			if c, ok := resp.(map[string]any)["x-error-codes"]; ok {
+				got[status] = c
+			}
+		}
+		return got
+	}
+	want := jsonValue(t, `{
+		"400": ["bad_request"],
+		"401": ["unauthorized", "auth.token_revoked", "auth.inactive_user"],
+		"409": ["conflict"],
+		"500": ["internal_error"],
+		"503": ["service_unavailable"]
+	}`)
+	if got := codes(operation(t, r, http.MethodPost, "/nodes/{id}/archive")); !reflect.DeepEqual(got, want) {
+		t.Errorf("authenticated write error codes = %v, want %v", got, want)
+	}
+	want = jsonValue(t, `{
+		"400": ["bad_request"],
+		"500": ["internal_error"],
+		"503": ["service_unavailable"]
+	}`)
+	if got := codes(operation(t, r, http.MethodGet, "/nodes/{id}")); !reflect.DeepEqual(got, want) {
+		t.Errorf("public read error codes = %v, want %v", got, want)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	annotated := chi.NewRouter()
+	annotated.Method(http.MethodPost, "/api/v1/nodes/{id}/archive", middleware.WithHandler(archiveNode))
+	withOptions := chi.NewRouter()
+	withOptions.Method(http.MethodPost, "/api/v1/nodes/{id}/archive", middleware.WithHandler(archiveNodeWithOptions, archiveNodeOptions...))
+
+	got := operation(t, withOptions, http.MethodPost, "/nodes/{id}/archive")
+	want := operation(t, annotated, http.MethodPost, "/nodes/{id}/archive")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("options document\n%v\nannotations document\n%v", got, want)
+	}
+}
+
+func TestOptionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options [][]openapi.Option
+		want    string
+	}{
+		{"unknown schema", [][]openapi.Option{{openapi.ResponseRef(http.StatusConflict, "Conflict", "")}}, `unknown schema "Conflict"`},
+		{"unknown security scheme", [][]openapi.Option{{openapi.Security("APIKey")}}, `unknown security scheme "APIKey"`},
+		{"invalid example", [][]openapi.Option{{openapi.Example(json.RawMessage(`{"reason":`))}}, "example isn't valid JSON"},
+		{"duplicate operation ID", [][]openapi.Option{{openapi.OperationID("archive")}, {openapi.OperationID("archive")}}, `operation ID "archive" is also used`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			for i, options := range tt.options {
+				r.Method(http.MethodPost, "/api/v1/nodes/{id}/archive/"+strings.Repeat("x", i), middleware.WithHandler(archiveNodeWithOptions, options...))
+			}
+			_, err := openapi.Generate(r)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Generate() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
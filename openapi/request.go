@@ -0,0 +1,229 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// RequestField is a field of a request type and where the binder reads it from.
+// Fields decoded from a JSON body aren't listed, see BodyFields.
+type RequestField struct {
+	// Source is TypeURI, TypeQuery, TypeHeader, TypeCookie, TypeForm or TypeFile
+	Source string
+	// Name is the name of the value in its source
+	Name  string
+	Field reflect.StructField
+}
+
+// formBodyMethods are the methods whose form values are read from the body, as
+// http.Request.ParseForm does. Other methods read them from the query string.
+var formBodyMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch}
+
+// describedHeaders are the headers OpenAPI doesn't allow as parameters
+var describedHeaders = []string{"Accept", "Content-Type", "Authorization"}
+
+// openAPIPath converts a chi route pattern to an OpenAPI path, it drops the
+// regexps of the parameters and returns their names
+func openAPIPath(pattern string) (string, []string) {
+	var path strings.Builder
+	var names []string
+	for {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			path.WriteString(pattern)
+			return path.String(), names
+		}
+		// Regexps may hold braces too
+		depth, end := 0, len(pattern)
+		for i := start; i < len(pattern); i++ {
+			if pattern[i] == '{' {
+				depth++
+			} else if pattern[i] == '}' {
+				depth--
+				if depth == 0 {
+					end = i
+					break
+				}
+			}
+		}
+		name, _, _ := strings.Cut(pattern[start+1:min(end, len(pattern))], ":")
+		names = append(names, name)
+		path.WriteString(pattern[:start] + "{" + name + "}")
+		pattern = pattern[min(end+1, len(pattern)):]
+	}
+}
+
+// getParameters returns the parameters of a route: the path parameters of its
+// pattern and the query, header and cookie values its request type binds
+func getParameters(route FuncInfo, g *schemaGenerator) []map[string]interface{} {
+	var params []map[string]interface{}
+
+	_, names := openAPIPath(route.Path)
+	for _, name := range names {
+		schema := map[string]interface{}{"type": "string"}
+		if i := slices.IndexFunc(route.RequestFields, func(f RequestField) bool {
+			return f.Source == TypeURI && f.Name == name
+		}); i >= 0 {
+			schema = g.field(route.RequestFields[i].Field, request)
+		}
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+
+	for _, f := range route.RequestFields {
+		in := f.Source
+		switch f.Source {
+		case TypeQuery, TypeCookie:
+		case TypeHeader:
+			if slices.ContainsFunc(describedHeaders, func(h string) bool { return strings.EqualFold(h, f.Name) }) {
+				continue
+			}
+		case TypeForm:
+			if slices.Contains(formBodyMethods, route.Method) {
+				continue
+			}
+			in = TypeQuery
+		default:
+			continue
+		}
+		params = append(params, map[string]interface{}{
+			"name":     f.Name,
+			"in":       in,
+			"required": hasRule(f.Field.Tag.Get("binding"), "required"),
+			"schema":   g.field(f.Field, request),
+		})
+	}
+	return params
+}
+
+// getRequestBody returns the request body of a route, nil when it has none. The
+// binder decodes JSON bodies whatever the method, form fields are read from a
+// url-encoded body, or a multipart body when there are files.
+func getRequestBody(route FuncInfo, g *schemaGenerator) map[string]interface{} {
+	content := map[string]interface{}{}
+	required := false
+
+	if fields := requestJSONFields(route.RequestType); len(fields) > 0 {
+		mediaType := map[string]interface{}{
+			"schema": g.body(route.RequestType, request),
+		}
+		if example := generateExample(route.RequestType); len(example) > 0 {
+			mediaType["example"] = example
+		}
+		content[TypeJSON] = mediaType
+		required = slices.ContainsFunc(fields, func(f jsonField) bool {
+			return hasRule(f.field.Tag.Get("binding"), "required")
+		})
+	}
+
+	var form []RequestField
+	for _, f := range route.RequestFields {
+		if f.Source == TypeFile || f.Source == TypeForm && slices.Contains(formBodyMethods, route.Method) {
+			form = append(form, f)
+		}
+	}
+	if len(form) > 0 {
+		mediaType := TypeFormURLEncoded
+		if slices.ContainsFunc(form, func(f RequestField) bool { return f.Source == TypeFile }) {
+			mediaType = TypeMultipart
+		}
+		schema, formRequired := getFormSchema(form, g)
+		content[mediaType] = map[string]interface{}{"schema": schema}
+		required = required || formRequired
+	}
+
+	if len(content) == 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"content":  content,
+		"required": required,
+	}
+}
+
+// getFormSchema returns the schema of a form body and whether a field is required
+func getFormSchema(fields []RequestField, g *schemaGenerator) (map[string]interface{}, bool) {
+	properties := make(map[string]interface{})
+	var required []string
+	for _, f := range fields {
+		var schema map[string]interface{}
+		if f.Source == TypeFile {
+			schema = map[string]interface{}{
+				"type":   "string",
+				"format": "binary",
+			}
+			if accept := f.Field.Tag.Get("accept"); accept != "" {
+				schema["contentMediaType"] = accept
+			}
+			if f.Field.Type.Kind() == reflect.Slice {
+				schema = map[string]interface{}{
+					"type":  "array",
+					"items": schema,
+				}
+			}
+		} else {
+			schema = g.field(f.Field, request)
+		}
+
+		properties[f.Name] = schema
+		if hasRule(f.Field.Tag.Get("binding"), "required") {
+			required = append(required, f.Name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema, len(required) > 0
+}
+
+// BodyField is a field of a request type decoded from a JSON body
+type BodyField struct {
+	// Index is the path to the field, through embedded structs
+	Index []int
+	// Name is the key of the field in the body
+	Name  string
+	Field reflect.StructField
+}
+
+// BodyFields returns the fields of the request type t documented in its JSON body:
+// fields with a json tag, and untagged fields that aren't read from another source.
+// The binder decodes only these, so a body can't set what the spec leaves out.
+func BodyFields(t reflect.Type) []BodyField {
+	var fields []BodyField
+	for _, f := range requestJSONFields(t) {
+		fields = append(fields, BodyField{Index: f.index, Name: f.name, Field: f.field})
+	}
+	return fields
+}
+
+// requestJSONFields returns the fields of a JSON request body of type t
+func requestJSONFields(t reflect.Type) []jsonField {
+	if t == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return jsonFields(t)
+}
+
+// bindsAuthorization reports whether the request type of a route reads the Authorization header itself
+func bindsAuthorization(route FuncInfo) bool {
+	return slices.ContainsFunc(route.RequestFields, func(f RequestField) bool {
+		return f.Source == TypeHeader && strings.EqualFold(f.Name, "Authorization")
+	})
+}
@@ -0,0 +1,536 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// schemaRefPrefix prefixes the references to component schemas
+const schemaRefPrefix = "#/components/schemas/"
+
+// Enumer is implemented by types with a fixed set of values, which are documented
+// as the enum of their schema. Pointer receivers are supported.
+type Enumer interface {
+	Enum() []any
+}
+
+var (
+	enumerType        = reflect.TypeOf((*Enumer)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// knownSchemas are the schemas of common types that marshal themselves
+var knownSchemas = map[reflect.Type]map[string]any{
+	reflect.TypeOf(time.Time{}):          {"type": "string", "format": "date-time"},
+	reflect.TypeOf(time.Duration(0)):     {"type": "integer", "description": "Duration in nanoseconds"},
+	reflect.TypeOf(uuid.UUID{}):          {"type": "string", "format": "uuid"},
+	reflect.TypeOf(json.RawMessage{}):    {},
+	reflect.TypeOf(pgtype.Text{}):        {"type": []any{"string", "null"}},
+	reflect.TypeOf(pgtype.UUID{}):        {"type": []any{"string", "null"}, "format": "uuid"},
+	reflect.TypeOf(pgtype.Timestamptz{}): {"type": []any{"string", "null"}, "format": "date-time"},
+	reflect.TypeOf(pgtype.Timestamp{}):   {"type": []any{"string", "null"}, "format": "date-time"},
+	reflect.TypeOf(pgtype.Date{}):        {"type": []any{"string", "null"}, "format": "date"},
+	reflect.TypeOf(pgtype.Bool{}):        {"type": []any{"boolean", "null"}},
+	reflect.TypeOf(pgtype.Int2{}):        {"type": []any{"integer", "null"}},
+	reflect.TypeOf(pgtype.Int4{}):        {"type": []any{"integer", "null"}},
+	reflect.TypeOf(pgtype.Int8{}):        {"type": []any{"integer", "null"}},
+	reflect.TypeOf(pgtype.Float8{}):      {"type": []any{"number", "null"}},
+}
+
+// ruleFormats maps validator rules to JSON Schema formats
+var ruleFormats = map[string]string{
+	"email":            "email",
+	"uuid":             "uuid",
+	"uuid4":            "uuid",
+	"uuid_rfc4122":     "uuid",
+	"uuid4_rfc4122":    "uuid",
+	"url":              "uri",
+	"uri":              "uri",
+	"http_url":         "uri",
+	"hostname":         "hostname",
+	"hostname_rfc1123": "hostname",
+	"ipv4":             "ipv4",
+	"ip4_addr":         "ipv4",
+	"ipv6":             "ipv6",
+	"ip6_addr":         "ipv6",
+}
+
+// rulePatterns maps validator rules to the patterns they check
+var rulePatterns = map[string]string{
+	"alpha":    `^[a-zA-Z]+$`,
+	"alphanum": `^[a-zA-Z0-9]+$`,
+	"numeric":  `^[-+]?[0-9]+(?:\.[0-9]+)?$`,
+	"number":   `^[0-9]+$`,
+	"e164":     `^\+[1-9]?[0-9]{7,14}$`,
+}
+
+// bindingSources are the struct tags of request fields bound from outside the JSON body
+var bindingSources = []string{TypeURI, TypeQuery, TypeHeader, TypeCookie, TypeForm, TypeFile}
+
+// schemaGenerator converts Go types to JSON Schema 2020-12, the dialect of OpenAPI 3.1.
+// Named structs become components referenced with $ref, which also ends the
+// recursion of recursive types. It isn't safe for concurrent use.
+type schemaGenerator struct {
+	components map[reflect.Type]*component
+	// names are the component names in use, reserved names have a nil type
+	names map[string]reflect.Type
+}
+
+// component is the schema of a named struct. The properties it requires depend
+// on the direction: a request requires what validation requires, a response
+// always has the fields that aren't omitempty.
+type component struct {
+	name     string
+	schema   map[string]any
+	required map[direction][]string
+}
+
+// jsonField is a struct field as encoding/json sees it
+type jsonField struct {
+	field reflect.StructField
+	// index is the path to the field, through embedded structs
+	index     []int
+	name      string
+	omitEmpty bool
+	asString  bool
+}
+
+func newSchemaGenerator(reserved ...string) *schemaGenerator {
+	g := &schemaGenerator{
+		components: map[reflect.Type]*component{},
+		names:      map[string]reflect.Type{},
+	}
+	for _, name := range reserved {
+		g.names[name] = nil
+	}
+	return g
+}
+
+// body returns the schema of a request or response body of type t. A pointer
+// to a body isn't nullable, handlers return nil only along with an error.
+func (g *schemaGenerator) body(t reflect.Type, dir direction) map[string]any {
+	if t == nil {
+		return map[string]any{"type": "object"}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return g.schema(t, dir)
+}
+
+// schema returns the schema of the values of type t
+func (g *schemaGenerator) schema(t reflect.Type, dir direction) map[string]any {
+	if s, ok := knownSchemas[t]; ok {
+		return maps.Clone(s)
+	}
+	if t.Kind() == reflect.Ptr {
+		return nullable(g.schema(t.Elem(), dir))
+	}
+	if reflect.PointerTo(t).Implements(enumerType) {
+		s := g.kindSchema(t, dir)
+		s["enum"] = reflect.New(t).Interface().(Enumer).Enum()
+		return s
+	}
+	if implements(t, jsonMarshalerType) {
+		// Its JSON is unknown
+		return map[string]any{}
+	}
+	if implements(t, textMarshalerType) {
+		return map[string]any{"type": "string"}
+	}
+	return g.kindSchema(t, dir)
+}
+
+// kindSchema returns the schema of t from its kind
+func (g *schemaGenerator) kindSchema(t reflect.Type, dir direction) map[string]any {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem(), dir)}
+	case reflect.Array:
+		return map[string]any{
+			"type":     "array",
+			"items":    g.schema(t.Elem(), dir),
+			"minItems": t.Len(),
+			"maxItems": t.Len(),
+		}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem(), dir)}
+	case reflect.Struct:
+		if t.Name() != "" {
+			return g.ref(t, dir)
+		}
+		schema, required := g.object(t, dir)
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		// Interfaces hold any value
+		return map[string]any{}
+	}
+}
+
+// ref returns a reference to the component of the named struct t
+func (g *schemaGenerator) ref(t reflect.Type, dir direction) map[string]any {
+	c, ok := g.components[t]
+	if !ok {
+		c = &component{name: g.name(t), required: map[direction][]string{}}
+		g.components[t] = c
+	}
+	if _, walked := c.required[dir]; !walked {
+		// Mark it first, the properties may refer to t
+		c.required[dir] = nil
+		schema, required := g.object(t, dir)
+		if c.schema == nil {
+			c.schema = schema
+		}
+		c.required[dir] = required
+	}
+	return map[string]any{"$ref": schemaRefPrefix + c.name}
+}
+
+// object returns the schema of the struct t and the properties it requires
+func (g *schemaGenerator) object(t reflect.Type, dir direction) (map[string]any, []string) {
+	properties := map[string]any{}
+	var required []string
+	for _, f := range jsonFields(t) {
+		var s map[string]any
+		switch {
+		case f.asString:
+			s = map[string]any{"type": "string"}
+		case dir == response && f.omitEmpty && f.field.Type.Kind() == reflect.Ptr:
+			// Nil is left out rather than null
+			s = g.schema(f.field.Type.Elem(), dir)
+			applyRules(s, f.field)
+		default:
+			s = g.field(f.field, dir)
+		}
+		properties[f.name] = s
+
+		if dir == request && hasRule(f.field.Tag.Get("binding"), "required") ||
+			dir == response && !f.omitEmpty {
+			required = append(required, f.name)
+		}
+	}
+	return map[string]any{"type": "object", "properties": properties}, required
+}
+
+// field returns the schema of a struct field, with its validation rules and default
+func (g *schemaGenerator) field(sf reflect.StructField, dir direction) map[string]any {
+	s := g.schema(sf.Type, dir)
+	applyRules(s, sf)
+	if def, ok := sf.Tag.Lookup("default"); ok {
+		if v, ok := typedValue(sf.Type, def); ok {
+			s["default"] = v
+		}
+	}
+	return s
+}
+
+// schemas returns the component schemas. A component read in both directions
+// requires the properties required in both.
+func (g *schemaGenerator) schemas() map[string]any {
+	schemas := map[string]any{}
+	for _, c := range g.components {
+		schema := maps.Clone(c.schema)
+		in, inRequest := c.required[request]
+		out, inResponse := c.required[response]
+		required := in
+		switch {
+		case inRequest && inResponse:
+			required = slices.DeleteFunc(slices.Clone(in), func(name string) bool {
+				return !slices.Contains(out, name)
+			})
+		case inResponse:
+			required = out
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		schemas[c.name] = schema
+	}
+	return schemas
+}
+
+var typeArgsRe = regexp.MustCompile(`[\w./-]*[./]`)
+
+// name returns an unused component name for t. Types with the same name in
+// different packages are prefixed with their package name.
+func (g *schemaGenerator) name(t reflect.Type) string {
+	// Type arguments of generic types are qualified with their package path
+	base := typeArgsRe.ReplaceAllString(t.Name(), "")
+	base = strings.NewReplacer("[", "_", ",", "_", "]", "", "*", "").Replace(base)
+
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	candidates := []string{base, capitalize(pkg) + base}
+	for i := 2; ; i++ {
+		for _, name := range candidates {
+			if _, taken := g.names[name]; !taken {
+				g.names[name] = t
+				return name
+			}
+		}
+		candidates = []string{capitalize(pkg) + base + strconv.Itoa(i)}
+	}
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// jsonFields returns the fields of the struct t in its JSON body, following the
+// rules of encoding/json. Fields bound from other parts of the request are left out.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields, promoted []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, hasTag := sf.Tag.Lookup("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for _, f := range jsonFields(ft) {
+				f.index = append([]int{i}, f.index...)
+				promoted = append(promoted, f)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if !hasTag && slices.ContainsFunc(bindingSources, func(source string) bool {
+			_, ok := sf.Tag.Lookup(source)
+			return ok
+		}) {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+		options := strings.Split(opts, ",")
+		f := jsonField{field: sf, index: []int{i}, name: name, omitEmpty: slices.Contains(options, "omitempty")}
+		switch ft.Kind() {
+		case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f.asString = slices.Contains(options, "string")
+		}
+		fields = append(fields, f)
+	}
+
+	// Fields of the struct hide the promoted ones
+	for _, f := range promoted {
+		if !slices.ContainsFunc(fields, func(other jsonField) bool { return other.name == f.name }) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// nullable returns s allowing null
+func nullable(s map[string]any) map[string]any {
+	switch typ := s["type"].(type) {
+	case string:
+		s["type"] = []any{typ, "null"}
+	case []any:
+		if !slices.Contains(typ, "null") {
+			s["type"] = append(slices.Clone(typ), "null")
+		}
+	default:
+		if len(s) == 0 {
+			// Any value, null included
+			return s
+		}
+		return map[string]any{"anyOf": []any{s, map[string]any{"type": "null"}}}
+	}
+	if enum, ok := s["enum"].([]any); ok && !slices.Contains(enum, nil) {
+		s["enum"] = append(slices.Clone(enum), nil)
+	}
+	return s
+}
+
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// hasRule reports whether the validator rules contain rule
+func hasRule(rules, rule string) bool {
+	for _, r := range strings.Split(rules, ",") {
+		if name, _, _ := strings.Cut(r, "="); name == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRules maps the validator rules in the binding tag of sf to s
+func applyRules(s map[string]any, sf reflect.StructField) {
+	if rules := sf.Tag.Get("binding"); rules != "" {
+		applyRuleList(s, sf.Type, strings.Split(rules, ","))
+	}
+}
+
+// applyRuleList maps validator rules for values of type t to s. The rules after
+// dive apply to the items.
+func applyRuleList(s map[string]any, t reflect.Type, rules []string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if _, known := knownSchemas[t]; known {
+		return
+	}
+
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		if strings.Contains(rule, "|") {
+			// Alternatives can't be mapped to one schema
+			continue
+		}
+		switch name {
+		case "dive":
+			items, _ := s["items"].(map[string]any)
+			if items == nil {
+				items, _ = s["additionalProperties"].(map[string]any)
+			}
+			if items != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+				applyRuleList(items, t.Elem(), rules[i+1:])
+			}
+			return
+		case "min", "gte":
+			bound(s, t, "min", param, 0)
+		case "max", "lte":
+			bound(s, t, "max", param, 0)
+		case "gt":
+			bound(s, t, "min", param, 1)
+		case "lt":
+			bound(s, t, "max", param, -1)
+		case "len":
+			bound(s, t, "min", param, 0)
+			bound(s, t, "max", param, 0)
+		case "eq":
+			if v, ok := typedValue(t, param); ok {
+				s["const"] = v
+			}
+		case "ne":
+			if v, ok := typedValue(t, param); ok {
+				s["not"] = map[string]any{"const": v}
+			}
+		case "oneof":
+			var enum []any
+			for _, value := range strings.Fields(param) {
+				if v, ok := typedValue(t, value); ok {
+					enum = append(enum, v)
+				}
+			}
+			if len(enum) > 0 {
+				s["enum"] = enum
+			}
+		default:
+			if format, ok := ruleFormats[name]; ok && t.Kind() == reflect.String {
+				s["format"] = format
+			} else if pattern, ok := rulePatterns[name]; ok && t.Kind() == reflect.String {
+				s["pattern"] = pattern
+			}
+		}
+	}
+}
+
+// bound maps a min or max rule with param to the keyword for the kind of t. For
+// lengths and counts the exclusive bounds gt and lt shift param by offset.
+func bound(s map[string]any, t reflect.Type, side, param string, offset int) {
+	var keyword string
+	switch t.Kind() {
+	case reflect.String:
+		keyword = "Length"
+	case reflect.Slice, reflect.Array:
+		keyword = "Items"
+	case reflect.Map:
+		keyword = "Properties"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		v, ok := typedValue(t, param)
+		if !ok {
+			return
+		}
+		switch {
+		case side == "min" && offset != 0:
+			s["exclusiveMinimum"] = v
+		case side == "max" && offset != 0:
+			s["exclusiveMaximum"] = v
+		case side == "min":
+			s["minimum"] = v
+		default:
+			s["maximum"] = v
+		}
+		return
+	default:
+		return
+	}
+
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		return
+	}
+	s[side+keyword] = max(n+offset, 0)
+}
+
+// typedValue parses value as a value of type t, like defaults and rule parameters
+func typedValue(t reflect.Type, value string) (any, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var v any
+	var err error
+	switch t.Kind() {
+	case reflect.String:
+		v = value
+	case reflect.Bool:
+		v, err = strconv.ParseBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err = strconv.ParseInt(value, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err = strconv.ParseUint(value, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		v, err = strconv.ParseFloat(value, 64)
+	default:
+		return nil, false
+	}
+	return v, err == nil
+}
@@ -0,0 +1,189 @@
+package openapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/wangfenjin/mojito/middleware"
+	"github.com/wangfenjin/mojito/openapi"
+	"github.com/wangfenjin/mojito/outbox"
+)
+
+type Role string
+
+func (Role) Enum() []any { return []any{"admin", "member"} }
+
+type Audit struct {
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Status collides with outbox.Status
+type Status struct {
+	Code int `json:"code"`
+}
+
+type Node struct {
+	Name     string `json:"name"`
+	Parent   *Node  `json:"parent,omitempty"`
+	Children []Node `json:"children"`
+}
+
+type CreateNodeRequest struct {
+	ID       string   `uri:"id" binding:"required,uuid"`
+	Name     string   `json:"name" binding:"required,min=3,max=50"`
+	Email    *string  `json:"email" binding:"omitempty,email"`
+	Role     Role     `json:"role" binding:"required"`
+	Kind     string   `json:"kind" binding:"oneof=leaf branch" default:"leaf"`
+	Weight   int      `json:"weight" binding:"gt=0,lte=10"`
+	Tags     []string `json:"tags" binding:"max=5,dive,alphanum"`
+	Note     *string  `json:"note"`
+	Internal string   `json:"-"`
+	Count    int64    `json:"count,string"`
+	Node     Node     `json:"node"`
+	Extra    *Audit   `json:"extra"`
+	Data     []byte   `json:"data"`
+	Any      any      `json:"any"`
+	Labels   map[string]string
+	Locale   string `header:"Accept-Language"`
+}
+
+type NodeResponse struct {
+	Audit
+	ID          uuid.UUID       `json:"id"`
+	Description pgtype.Text     `json:"description"`
+	Deleted     *time.Time      `json:"deleted,omitempty"`
+	Owner       *Audit          `json:"owner"`
+	Node        Node            `json:"node"`
+	Status      Status          `json:"status"`
+	Outbox      *outbox.Status  `json:"outbox,omitempty"`
+	Raw         json.RawMessage `json:"raw,omitempty"`
+	Meta        struct {
+		Total int `json:"total"`
+	} `json:"meta"`
+}
+
+func createNode(context.Context, CreateNodeRequest) (*NodeResponse, error) {
+	return nil, nil
+}
+
+// schemas generates the component schemas of the createNode route
+func schemas(t *testing.T) map[string]any {
+	t.Helper()
+	r := chi.NewRouter()
+	r.Method(http.MethodPost, "/api/v1/nodes/{id}", middleware.WithHandler(createNode))
+	spec, err := openapi.Generate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Compare the JSON the spec is served as
+	data, err := json.Marshal(spec.Components["schemas"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schemas map[string]any
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		t.Fatal(err)
+	}
+	return schemas
+}
+
+func property(t *testing.T, schemas map[string]any, schema, name string) any {
+	t.Helper()
+	s, ok := schemas[schema].(map[string]any)
+	if !ok {
+		t.Fatalf("no %s schema in %v", schema, keys(schemas))
+	}
+	return s["properties"].(map[string]any)[name]
+}
+
+func keys(m map[string]any) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func jsonValue(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestSchemaProperties(t *testing.T) {
+	schemas := schemas(t)
+
+	tests := []struct {
+		schema, property string
+		want             string
+	}{
+		{"CreateNodeRequest", "name", `{"type": "string", "minLength": 3, "maxLength": 50}`},
+		{"CreateNodeRequest", "email", `{"type": ["string", "null"], "format": "email"}`},
+		{"CreateNodeRequest", "role", `{"type": "string", "enum": ["admin", "member"]}`},
+		{"CreateNodeRequest", "kind", `{"type": "string", "enum": ["leaf", "branch"], "default": "leaf"}`},
+		{"CreateNodeRequest", "weight", `{"type": "integer", "exclusiveMinimum": 0, "maximum": 10}`},
+		{"CreateNodeRequest", "tags", `{"type": "array", "maxItems": 5, "items": {"type": "string", "pattern": "^[a-zA-Z0-9]+$"}}`},
+		{"CreateNodeRequest", "note", `{"type": ["string", "null"]}`},
+		{"CreateNodeRequest", "count", `{"type": "string"}`},
+		{"CreateNodeRequest", "node", `{"$ref": "#/components/schemas/Node"}`},
+		{"CreateNodeRequest", "extra", `{"anyOf": [{"$ref": "#/components/schemas/Audit"}, {"type": "null"}]}`},
+		{"CreateNodeRequest", "data", `{"type": "string", "contentEncoding": "base64"}`},
+		{"CreateNodeRequest", "any", `{}`},
+		{"CreateNodeRequest", "Labels", `{"type": "object", "additionalProperties": {"type": "string"}}`},
+		{"NodeResponse", "created_at", `{"type": "string", "format": "date-time"}`},
+		{"NodeResponse", "id", `{"type": "string", "format": "uuid"}`},
+		{"NodeResponse", "description", `{"type": ["string", "null"]}`},
+		{"NodeResponse", "deleted", `{"type": "string", "format": "date-time"}`},
+		{"NodeResponse", "owner", `{"anyOf": [{"$ref": "#/components/schemas/Audit"}, {"type": "null"}]}`},
+		{"NodeResponse", "status", `{"$ref": "#/components/schemas/Status"}`},
+		{"NodeResponse", "outbox", `{"$ref": "#/components/schemas/OutboxStatus"}`},
+		{"NodeResponse", "meta", `{"type": "object", "properties": {"total": {"type": "integer"}}, "required": ["total"]}`},
+		{"Node", "parent", `{"$ref": "#/components/schemas/Node"}`},
+		{"Node", "children", `{"type": "array", "items": {"$ref": "#/components/schemas/Node"}}`},
+	}
+	for _, tt := range tests {
+		got := property(t, schemas, tt.schema, tt.property)
+		if want := jsonValue(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s.%s = %v, want %v", tt.schema, tt.property, got, want)
+		}
+	}
+
+	// Fields bound from elsewhere or ignored aren't in the body
+	for _, name := range []string{"id", "Locale", "Internal", "-"} {
+		if p := property(t, schemas, "CreateNodeRequest", name); p != nil {
+			t.Errorf("CreateNodeRequest has property %s", name)
+		}
+	}
+}
+
+func TestSchemaRequired(t *testing.T) {
+	schemas := schemas(t)
+
+	tests := []struct {
+		schema string
+		want   string
+	}{
+		// Requests require what validation requires
+		{"CreateNodeRequest", `["name", "role"]`},
+		// Responses have the fields that aren't omitempty
+		{"NodeResponse", `["id", "description", "owner", "node", "status", "meta", "created_at"]`},
+		// Node is used in both, the request doesn't require anything
+		{"Node", `null`},
+	}
+	for _, tt := range tests {
+		got := schemas[tt.schema].(map[string]any)["required"]
+		if want := jsonValue(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s requires %v, want %v", tt.schema, got, want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/wangfenjin/mojito/models/gen"
+)
+
+// Options tune the dispatcher, zero values use the defaults below
+type Options struct {
+	// PollInterval is how often the outbox is polled when it is empty
+	PollInterval time.Duration
+	// BatchSize is the maximum number of messages claimed at once
+	BatchSize int
+	// MaxAttempts is the number of deliveries tried before a message is dead-lettered
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry, it doubles with every attempt up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Lease is how long a claimed message is hidden from other dispatchers, it must exceed the delivery time
+	Lease time.Duration
+	// Retention is how long delivered messages are kept, older ones are purged every PurgeInterval
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.PollInterval <= 0 {
+		o.PollInterval = 2 * time.Second
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 20
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 10
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = 5 * time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Hour
+	}
+	if o.Lease <= 0 {
+		o.Lease = time.Minute
+	}
+	if o.Retention <= 0 {
+		o.Retention = 7 * 24 * time.Hour
+	}
+	if o.PurgeInterval <= 0 {
+		o.PurgeInterval = time.Hour
+	}
+	return o
+}
+
+// Status is a snapshot of the dispatcher, counters are since the process started
+type Status struct {
+	Running      bool       `json:"running"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	Delivered    int64      `json:"delivered"`
+	Retried      int64      `json:"retried"`
+	DeadLettered int64      `json:"dead_lettered"`
+	Purged       int64      `json:"purged"`
+}
+
+// Dispatcher claims pending outbox messages and delivers them with the sink registered for their topic.
+// Messages are claimed with FOR UPDATE SKIP LOCKED, so several instances can run side by side.
+type Dispatcher struct {
+	db     gen.Querier
+	opts   Options
+	logger *slog.Logger
+	sinks  map[string]Sink
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewDispatcher creates a dispatcher reading the outbox through db
+func NewDispatcher(db gen.Querier, opts Options, logger *slog.Logger) *Dispatcher {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Dispatcher{
+		db:     db,
+		opts:   opts.withDefaults(),
+		logger: logger,
+		sinks:  make(map[string]Sink),
+	}
+}
+
+// Register sets the sink for a topic, call it before Run
+func (d *Dispatcher) Register(topic string, sink Sink) {
+	d.sinks[topic] = sink
+}
+
+// Run delivers messages until ctx is canceled
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.setRunning(true)
+	defer d.setRunning(false)
+
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+	var lastPurge time.Time
+	for {
+		// Keep going while full batches come back, there's probably more waiting
+		for {
+			n, err := d.DispatchOnce(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					d.logger.Error("outbox dispatch failed", "error", err)
+				}
+				break
+			}
+			if n < d.opts.BatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastPurge) >= d.opts.PurgeInterval {
+			lastPurge = time.Now()
+			if _, err := d.Purge(ctx); err != nil && ctx.Err() == nil {
+				d.logger.Error("outbox purge failed", "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce claims one batch of due messages and delivers them.
+// It returns the number of messages claimed.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	msgs, err := d.db.ClaimOutbox(ctx, gen.ClaimOutboxParams{
+		LeaseSeconds: d.opts.Lease.Seconds(),
+		BatchSize:    int32(d.opts.BatchSize),
+	})
+	d.recordRun(err)
+	if err != nil {
+		return 0, fmt.Errorf("error claiming outbox messages: %w", err)
+	}
+
+	for _, msg := range msgs {
+		if err := d.deliver(ctx, msg); err != nil {
+			return len(msgs), err
+		}
+	}
+	return len(msgs), nil
+}
+
+// deliver hands a claimed message to its sink and records the outcome.
+// Only errors updating the outbox are returned, delivery errors are stored on the message.
+func (d *Dispatcher) deliver(ctx context.Context, msg gen.Outbox) error {
+	var err error
+	if sink, ok := d.sinks[msg.Topic]; ok {
+		err = sink.Deliver(ctx, msg.Payload)
+	} else {
+		err = Permanent(fmt.Errorf("no sink registered for topic %q", msg.Topic))
+	}
+	if ctx.Err() != nil {
+		// Shutting down, the lease expires and the message is picked up again
+		return ctx.Err()
+	}
+
+	switch {
+	case err == nil:
+		d.count(&d.status.Delivered)
+		return d.db.MarkOutboxDelivered(ctx, msg.ID)
+
+	case IsPermanent(err) || int(msg.Attempts) >= d.opts.MaxAttempts:
+		d.count(&d.status.DeadLettered)
+		d.logger.Error("outbox message dead-lettered", "id", msg.ID, "topic", msg.Topic, "attempts", msg.Attempts, "error", err)
+		return d.db.DeadLetterOutbox(ctx, gen.DeadLetterOutboxParams{
+			ID:        msg.ID,
+			LastError: pgtype.Text{String: err.Error(), Valid: true},
+		})
+
+	default:
+		d.count(&d.status.Retried)
+		next := time.Now().Add(d.backoff(int(msg.Attempts)))
+		d.logger.Warn("outbox delivery failed, retrying", "id", msg.ID, "topic", msg.Topic, "attempts", msg.Attempts, "next_attempt", next, "error", err)
+		return d.db.RetryOutbox(ctx, gen.RetryOutboxParams{
+			ID:          msg.ID,
+			AvailableAt: pgtype.Timestamptz{Time: next, Valid: true},
+			LastError:   pgtype.Text{String: err.Error(), Valid: true},
+		})
+	}
+}
+
+// Purge deletes the messages delivered more than Retention ago.
+// It returns the number of messages deleted.
+func (d *Dispatcher) Purge(ctx context.Context) (int64, error) {
+	n, err := d.db.PurgeOutbox(ctx, pgtype.Timestamptz{Time: time.Now().Add(-d.opts.Retention), Valid: true})
+	if err != nil {
+		return 0, fmt.Errorf("error purging outbox messages: %w", err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status.Purged += n
+	return n, nil
+}
+
+// backoff returns the delay before the next attempt: BaseBackoff doubled for every
+// previous attempt, capped at MaxBackoff, with ±20% jitter so failures don't retry in lockstep
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.opts.MaxBackoff
+	if shift := attempts - 1; shift < 32 {
+		if exp := d.opts.BaseBackoff << shift; exp > 0 && exp < delay {
+			delay = exp
+		}
+	}
+	jitter := 0.8 + 0.4*rand.Float64()
+	return time.Duration(float64(delay) * jitter)
+}
+
+// Status returns a snapshot of the dispatcher
+func (d *Dispatcher) Status() Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+func (d *Dispatcher) setRunning(running bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status.Running = running
+}
+
+func (d *Dispatcher) recordRun(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	d.status.LastRunAt = &now
+	d.status.LastError = ""
+	if err != nil && !errors.Is(err, context.Canceled) {
+		d.status.LastError = err.Error()
+	}
+}
+
+func (d *Dispatcher) count(counter *int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	*counter++
+}
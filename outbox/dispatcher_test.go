@@ -0,0 +1,232 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wangfenjin/mojito/email"
+	"github.com/wangfenjin/mojito/models/gen"
+	"github.com/wangfenjin/mojito/models/memory"
+)
+
+// sinkFunc adapts a function to a Sink and records the payloads it was given
+type sinkFunc struct {
+	mu       sync.Mutex
+	deliver  func(payload []byte) error
+	payloads [][]byte
+}
+
+func (s *sinkFunc) Deliver(_ context.Context, payload []byte) error {
+	s.mu.Lock()
+	s.payloads = append(s.payloads, payload)
+	s.mu.Unlock()
+	if s.deliver == nil {
+		return nil
+	}
+	return s.deliver(payload)
+}
+
+func enqueue(t *testing.T, store *memory.Store, topic string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := Enqueue(context.Background(), store, topic, map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func dispatch(t *testing.T, d *Dispatcher) int {
+	t.Helper()
+	n, err := d.DispatchOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func messages(t *testing.T, store *memory.Store, status string) []gen.Outbox {
+	t.Helper()
+	msgs, err := store.ListOutboxByStatus(context.Background(), gen.ListOutboxByStatusParams{Status: status, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msgs
+}
+
+func TestDispatchDeliversEmail(t *testing.T) {
+	store := memory.New()
+	mailer := email.NewMemoryMailer()
+	d := NewDispatcher(store, Options{}, nil)
+	d.Register(TopicEmail, &EmailSink{Mailer: mailer})
+
+	msg := &email.Message{To: []string{"user@example.com"}, Subject: "Reset", Text: "https://example.com/reset?token=secret"}
+	if err := EnqueueEmail(context.Background(), store, msg); err != nil {
+		t.Fatal(err)
+	}
+	if n := dispatch(t, d); n != 1 {
+		t.Fatalf("claimed %d messages, want 1", n)
+	}
+
+	if sent, ok := mailer.Last(); !ok || sent.Text != msg.Text {
+		t.Errorf("sent %+v, want %+v", sent, msg)
+	}
+	delivered := messages(t, store, StatusDelivered)
+	if len(delivered) != 1 {
+		t.Fatalf("%d delivered messages, want 1", len(delivered))
+	}
+	if delivered[0].Payload != nil || !delivered[0].DeliveredAt.Valid {
+		t.Errorf("delivered message = %+v, want its payload cleared", delivered[0])
+	}
+	if s := d.Status(); s.Delivered != 1 {
+		t.Errorf("status = %+v, want 1 delivered", s)
+	}
+}
+
+func TestDispatchClaimsBatches(t *testing.T) {
+	store := memory.New()
+	sink := &sinkFunc{}
+	d := NewDispatcher(store, Options{BatchSize: 2}, nil)
+	d.Register(TopicWebhook, sink)
+	enqueue(t, store, TopicWebhook, 3)
+
+	for _, want := range []int{2, 1, 0} {
+		if n := dispatch(t, d); n != want {
+			t.Errorf("claimed %d messages, want %d", n, want)
+		}
+	}
+	// Oldest first
+	for i, payload := range sink.payloads {
+		if want := fmt.Sprintf(`{"n":%d}`, i); string(payload) != want {
+			t.Errorf("payload %d = %s, want %s", i, payload, want)
+		}
+	}
+}
+
+func TestDispatchHidesClaimedMessages(t *testing.T) {
+	store := memory.New()
+	enqueue(t, store, TopicWebhook, 1)
+
+	params := gen.ClaimOutboxParams{LeaseSeconds: time.Minute.Seconds(), BatchSize: 10}
+	claimed, err := store.ClaimOutbox(context.Background(), params)
+	if err != nil || len(claimed) != 1 || claimed[0].Attempts != 1 {
+		t.Fatalf("claimed %+v, %v, want the message with one attempt", claimed, err)
+	}
+	// Another dispatcher doesn't get it while the lease runs
+	if again, _ := store.ClaimOutbox(context.Background(), params); len(again) != 0 {
+		t.Errorf("claimed %d leased messages", len(again))
+	}
+}
+
+func TestDispatchRetriesWithBackoff(t *testing.T) {
+	store := memory.New()
+	sink := &sinkFunc{deliver: func([]byte) error { return errors.New("unavailable") }}
+	d := NewDispatcher(store, Options{BaseBackoff: time.Minute}, nil)
+	d.Register(TopicWebhook, sink)
+	enqueue(t, store, TopicWebhook, 1)
+
+	start := time.Now()
+	dispatch(t, d)
+	pending := messages(t, store, StatusPending)
+	if len(pending) != 1 {
+		t.Fatalf("%d pending messages, want 1", len(pending))
+	}
+	msg := pending[0]
+	if msg.LastError.String != "unavailable" || msg.Payload == nil {
+		t.Errorf("retried message = %+v, want the error and its payload", msg)
+	}
+	if delay := msg.AvailableAt.Time.Sub(start); delay < 47*time.Second || delay > 73*time.Second {
+		t.Errorf("retried after %v, want a minute ±20%%", delay)
+	}
+	if n := dispatch(t, d); n != 0 {
+		t.Errorf("claimed %d messages before the backoff elapsed", n)
+	}
+	if s := d.Status(); s.Retried != 1 {
+		t.Errorf("status = %+v, want 1 retried", s)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, Options{BaseBackoff: time.Second, MaxBackoff: time.Minute}, nil)
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{7, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		got := d.backoff(tt.attempts)
+		if got < tt.want*8/10 || got > tt.want*12/10 {
+			t.Errorf("backoff(%d) = %v, want %v ±20%%", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestDispatchDeadLetters(t *testing.T) {
+	tests := []struct {
+		name     string
+		topic    string
+		err      error
+		attempts int
+	}{
+		{"attempts exhausted", TopicWebhook, errors.New("unavailable"), 2},
+		{"permanent error", TopicWebhook, Permanent(errors.New("rejected")), 1},
+		{"no sink", "unknown", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memory.New()
+			d := NewDispatcher(store, Options{MaxAttempts: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, nil)
+			d.Register(TopicWebhook, &sinkFunc{deliver: func([]byte) error { return tt.err }})
+			enqueue(t, store, tt.topic, 1)
+
+			for i := 0; i < tt.attempts; i++ {
+				time.Sleep(5 * time.Millisecond)
+				if n := dispatch(t, d); n != 1 {
+					t.Fatalf("attempt %d claimed %d messages, want 1", i+1, n)
+				}
+			}
+			dead := messages(t, store, StatusDead)
+			if len(dead) != 1 {
+				t.Fatalf("%d dead messages, want 1", len(dead))
+			}
+			if dead[0].Payload != nil || !dead[0].LastError.Valid || int(dead[0].Attempts) != tt.attempts {
+				t.Errorf("dead message = %+v, want %d attempts, the error and no payload", dead[0], tt.attempts)
+			}
+			if s := d.Status(); s.DeadLettered != 1 {
+				t.Errorf("status = %+v, want 1 dead-lettered", s)
+			}
+		})
+	}
+}
+
+func TestPurge(t *testing.T) {
+	store := memory.New()
+	d := NewDispatcher(store, Options{Retention: time.Millisecond}, nil)
+	d.Register(TopicWebhook, &sinkFunc{})
+	enqueue(t, store, TopicWebhook, 2)
+	dispatch(t, d)
+	enqueue(t, store, TopicWebhook, 1)
+
+	time.Sleep(5 * time.Millisecond)
+	n, err := d.Purge(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || len(messages(t, store, StatusDelivered)) != 0 {
+		t.Errorf("purged %d messages, want the 2 delivered", n)
+	}
+	if pending := messages(t, store, StatusPending); len(pending) != 1 {
+		t.Errorf("%d pending messages left, want 1", len(pending))
+	}
+	if s := d.Status(); s.Purged != 2 {
+		t.Errorf("status = %+v, want 2 purged", s)
+	}
+}
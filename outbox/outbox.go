@@ -0,0 +1,89 @@
+// Package outbox implements the transactional outbox. Messages are written in the same
+// transaction as the domain change that caused them and delivered by a background
+// Dispatcher, so they are neither lost when delivery fails nor sent for rolled back changes.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/wangfenjin/mojito/email"
+	"github.com/wangfenjin/mojito/models/gen"
+)
+
+// Topics select the sink a message is delivered with
+const (
+	TopicEmail   = "email"
+	TopicWebhook = "webhook"
+)
+
+// Message statuses stored in the outbox table
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Sink delivers the payload of outbox messages of one topic
+type Sink interface {
+	Deliver(ctx context.Context, payload []byte) error
+}
+
+// Event is the payload of webhook messages
+type Event struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// permanentError marks a delivery failure that retrying can't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the dispatcher dead-letters the message instead of retrying it
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
+
+// Enqueue writes a message to the outbox. Call it with the querier of the
+// transaction that makes the domain change.
+func Enqueue(ctx context.Context, q gen.Querier, topic string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding %s outbox message: %w", topic, err)
+	}
+	if err := q.EnqueueOutbox(ctx, gen.EnqueueOutboxParams{
+		ID:      uuid.New(),
+		Topic:   topic,
+		Payload: data,
+	}); err != nil {
+		return fmt.Errorf("error enqueueing %s outbox message: %w", topic, err)
+	}
+	return nil
+}
+
+// EnqueueEmail writes an email to the outbox
+func EnqueueEmail(ctx context.Context, q gen.Querier, msg *email.Message) error {
+	return Enqueue(ctx, q, TopicEmail, msg)
+}
+
+// Publish writes an event for the webhook sink to the outbox
+func Publish(ctx context.Context, q gen.Querier, eventType string, data any) error {
+	return Enqueue(ctx, q, TopicWebhook, Event{Type: eventType, Data: data})
+}
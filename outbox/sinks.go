@@ -0,0 +1,84 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/wangfenjin/mojito/email"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the webhook body, keyed with the webhook secret
+const SignatureHeader = "X-Mojito-Signature"
+
+// EmailSink delivers email messages with a mailer
+type EmailSink struct {
+	Mailer email.Mailer
+}
+
+// Deliver implements Sink
+func (s *EmailSink) Deliver(ctx context.Context, payload []byte) error {
+	var msg email.Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return Permanent(fmt.Errorf("invalid email payload: %w", err))
+	}
+	err := s.Mailer.Send(ctx, &msg)
+	if errors.Is(err, email.ErrDisabled) {
+		return Permanent(err)
+	}
+	return err
+}
+
+// WebhookSink posts events as JSON to a URL
+type WebhookSink struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// NewWebhookSink creates a webhook sink, requests time out after timeout
+func NewWebhookSink(url, secret string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{
+		URL:    url,
+		Secret: secret,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Deliver implements Sink. Client errors other than 408 and 429 are permanent.
+func (s *WebhookSink) Deliver(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.Secret))
+		mac.Write(payload)
+		req.Header.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	if resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
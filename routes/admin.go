@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/wangfenjin/mojito/app"
+	"github.com/wangfenjin/mojito/common"
+	"github.com/wangfenjin/mojito/middleware"
+	"github.com/wangfenjin/mojito/models"
+	"github.com/wangfenjin/mojito/models/gen"
+	"github.com/wangfenjin/mojito/outbox"
+)
+
+// RegisterAdminRoutes registers all admin related routes
+func RegisterAdminRoutes(r chi.Router, a *app.App) {
+	r.Route("/api/v1/admin", func(r chi.Router) {
+		r.Use(a.RequireAuth())
+
+		r.Method(http.MethodGet, "/outbox", middleware.WithHandler(outboxStatusHandler))
+		r.Method(http.MethodGet, "/db", middleware.WithHandler(dbStatsHandler))
+	})
+}
+
+// OutboxStatusRequest represents the request parameters for the outbox status
+type OutboxStatusRequest struct {
+	DeadLimit int64 `form:"dead_limit" binding:"min=0,max=100" default:"20"`
+}
+
+// OutboxCount is the number of outbox messages in one status
+type OutboxCount struct {
+	Status string     `json:"status"`
+	Count  int64      `json:"count"`
+	Oldest *time.Time `json:"oldest,omitempty"`
+}
+
+// OutboxMessage is an outbox message without its payload, which may hold secrets like reset links
+type OutboxMessage struct {
+	ID        uuid.UUID `json:"id"`
+	Topic     string    `json:"topic"`
+	Attempts  int32     `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OutboxStatusResponse represents the outbox status.
+// Dispatcher is missing when this instance doesn't run a dispatcher.
+type OutboxStatusResponse struct {
+	Dispatcher  *outbox.Status  `json:"dispatcher,omitempty"`
+	Counts      []OutboxCount   `json:"counts"`
+	DeadLetters []OutboxMessage `json:"dead_letters"`
+}
+
+// Show the outbox backlog, the dispatcher of this instance and the most recent dead letters
+// @summary Outbox status
+// @tag admin
+// @error 403 auth.superuser_required
+func outboxStatusHandler(ctx context.Context, req OutboxStatusRequest) (*OutboxStatusResponse, error) {
+	claims := ctx.Value("claims").(*common.Claims)
+	if !claims.IsSuperUser {
+		return nil, middleware.NewForbiddenError("only superusers can see the outbox").WithCode(ErrCodeSuperuserRequired)
+	}
+	a := app.From(ctx)
+
+	counts, err := a.Store.CountOutboxByStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error counting outbox messages: %w", err)
+	}
+	dead, err := a.Store.ListOutboxByStatus(ctx, gen.ListOutboxByStatusParams{
+		Status: outbox.StatusDead,
+		Limit:  req.DeadLimit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing dead letters: %w", err)
+	}
+
+	resp := &OutboxStatusResponse{
+		Counts:      make([]OutboxCount, len(counts)),
+		DeadLetters: make([]OutboxMessage, len(dead)),
+	}
+	if d := a.Dispatcher; d != nil {
+		status := d.Status()
+		resp.Dispatcher = &status
+	}
+	for i, c := range counts {
+		resp.Counts[i] = OutboxCount{
+			Status: c.Status,
+			Count:  c.Count,
+		}
+		if c.Oldest.Valid {
+			resp.Counts[i].Oldest = &c.Oldest.Time
+		}
+	}
+	for i, m := range dead {
+		resp.DeadLetters[i] = OutboxMessage{
+			ID:        m.ID,
+			Topic:     m.Topic,
+			Attempts:  m.Attempts,
+			LastError: m.LastError.String,
+			CreatedAt: m.CreatedAt.Time,
+		}
+	}
+	return resp, nil
+}
+
+// Show the connection pool statistics of this instance
+// @summary Database pool stats
+// @tag admin
+// @error 403 auth.superuser_required
+// @error 404 not_found
+func dbStatsHandler(ctx context.Context, _ EmptyRequest) (*models.PoolStats, error) {
+	claims := ctx.Value("claims").(*common.Claims)
+	if !claims.IsSuperUser {
+		return nil, middleware.NewForbiddenError("only superusers can see database stats").WithCode(ErrCodeSuperuserRequired)
+	}
+	// Stores that aren't backed by a connection pool have no stats
+	pool, ok := app.From(ctx).Store.(interface{ Stats() models.PoolStats })
+	if !ok {
+		return nil, middleware.NewNotFoundError("the store has no connection pool")
+	}
+	stats := pool.Stats()
+	return &stats, nil
+}
@@ -2,32 +2,40 @@
 package routes
 
 import (
-	"log/slog"
+	"embed"
+	"fmt"
 	"net/http"
+	"reflect"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/httplog/v2"
 	"github.com/wangfenjin/mojito/openapi"
 )
 
-// RegisterDocsRoutes registers routes for API documentation
+// sources are the handlers of this package, the spec is generated from their doc
+// comments even where the sources aren't deployed
+//
+//go:embed *.go
+var sources embed.FS
+
+func init() {
+	openapi.RegisterSources(reflect.TypeOf(EmptyRequest{}).PkgPath(), sources)
+}
+
+// RegisterDocsRoutes registers routes for API documentation. The spec documents the
+// routes registered so far, so call it after them. It is generated once, here, and
+// panics when that fails like chi does for invalid routes.
 func RegisterDocsRoutes(r chi.Router) {
+	doc, err := openapi.NewDocument(r)
+	if err != nil {
+		panic(fmt.Sprintf("mojito: failed to generate the OpenAPI spec: %v", err))
+	}
+
 	r.Route("/docs", func(r chi.Router) {
 		// Serve the OpenAPI spec
-		r.Get("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
-			http.ServeFile(w, r, "./api/openapi.json")
-		})
+		r.Method(http.MethodGet, "/openapi.json", doc)
 
 		// Serve Swagger UI using CDN
-		r.Get("/swagger/*", func(w http.ResponseWriter, r *http.Request) {
-			// Generate OpenAPI spec
-			err := openapi.GenerateSwaggerJSON("./api/openapi.json")
-			if err != nil {
-				httplog.LogEntrySetField(r.Context(), "generate swagger error", slog.StringValue(err.Error()))
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
-			}
-
+		r.Get("/swagger/*", func(w http.ResponseWriter, _ *http.Request) {
 			// HTML for Swagger UI using CDN
 			swaggerHTML := `
 <!DOCTYPE html>
@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/wangfenjin/mojito/app"
+	"github.com/wangfenjin/mojito/middleware"
+	"github.com/wangfenjin/mojito/models"
+)
+
+// Domain error codes returned by the handlers. They are part of the API contract, don't rename them.
+const (
+	ErrCodeInvalidCredentials  middleware.ErrorCode = "auth.invalid_credentials"
+	ErrCodeInactiveUser        middleware.ErrorCode = middleware.CodeInactiveUser
+	ErrCodeInvalidRefreshToken middleware.ErrorCode = "auth.invalid_refresh_token"
+	ErrCodeRefreshTokenReused  middleware.ErrorCode = "auth.refresh_token_reused"
+	ErrCodeInvalidResetToken   middleware.ErrorCode = "auth.invalid_reset_token"
+	ErrCodeInvalidVerifyToken  middleware.ErrorCode = "auth.invalid_verification_token"
+	ErrCodeEmailNotVerified    middleware.ErrorCode = "auth.email_not_verified"
+	ErrCodeSuperuserRequired   middleware.ErrorCode = "auth.superuser_required"
+	ErrCodeUserNotFound        middleware.ErrorCode = "user.not_found"
+	ErrCodeUserEmailTaken      middleware.ErrorCode = "user.email_taken"
+	ErrCodeIncorrectPassword   middleware.ErrorCode = "user.incorrect_password"
+	ErrCodeItemNotFound        middleware.ErrorCode = "item.not_found"
+	ErrCodeItemAccessDenied    middleware.ErrorCode = "item.access_denied"
+	ErrCodeEmailDisabled       middleware.ErrorCode = "email.disabled"
+	ErrCodeEmailDeliveryFailed middleware.ErrorCode = "email.delivery_failed"
+)
+
+// notFound turns a missing row into a not found error with the given code, other errors pass through
+func notFound(err error, code middleware.ErrorCode, message string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return middleware.NewNotFoundError(message).WithCode(code)
+	}
+	return err
+}
+
+// emailTaken turns a duplicate user email into a conflict with ErrCodeUserEmailTaken, other
+// errors pass through. It covers addresses taken between the existence check and the write.
+func emailTaken(err error) error {
+	var dbErr *models.DBError
+	if errors.As(models.TranslateError(err), &dbErr) && dbErr.Kind == models.ErrUniqueViolation && dbErr.Constraint == models.ConstraintUserEmail {
+		return middleware.NewConflictError("user with this email already exists").WithCode(ErrCodeUserEmailTaken)
+	}
+	return err
+}
+
+// checkPassword checks a new password against the password policy of the application,
+// it returns a validation error for field when the password doesn't comply
+func checkPassword(ctx context.Context, field, password string) error {
+	policy := app.From(ctx).Passwords
+	if err := policy.Validate(password); err != nil {
+		return middleware.NewValidationError("request validation failed", []middleware.FieldError{{
+			Field:   field,
+			Rule:    "min",
+			Param:   strconv.Itoa(policy.MinLength),
+			Message: err.Error(),
+		}})
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/httplog/v2"
+	"github.com/wangfenjin/mojito/app"
+	"github.com/wangfenjin/mojito/middleware"
+	"github.com/wangfenjin/mojito/models"
+)
+
+// CheckStatus is the outcome of a check, warnings are reported but don't make the server unready
+type CheckStatus string
+
+// Check statuses
+const (
+	checkPass CheckStatus = "pass"
+	checkWarn CheckStatus = "warn"
+	checkFail CheckStatus = "fail"
+)
+
+// Enum lists the check statuses in the OpenAPI spec
+func (CheckStatus) Enum() []any {
+	return []any{checkPass, checkWarn, checkFail}
+}
+
+// readinessTimeout bounds all readiness checks together, a database that doesn't answer in time is down
+const readinessTimeout = 2 * time.Second
+
+// poolSaturationWarn is the share of acquired connections from which the pool check warns
+const poolSaturationWarn = 0.9
+
+// RegisterHealthRoutes registers the liveness and readiness probes
+func RegisterHealthRoutes(r chi.Router) {
+	r.Method(http.MethodGet, "/livez", middleware.WithHandler(livenessHandler))
+	r.Method(http.MethodGet, "/readyz", middleware.WithHandler(readinessHandler))
+}
+
+// CheckResult is the outcome of one readiness check. The probes are public, so
+// a check that didn't pass reports a generic error, the cause is only logged.
+type CheckResult struct {
+	Name      string      `json:"name"`
+	Status    CheckStatus `json:"status"`
+	LatencyMs float64     `json:"latency_ms"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// ProbeResponse is the response of the liveness and readiness probes.
+// Status is warn when the server is ready but a check warned.
+type ProbeResponse struct {
+	Status CheckStatus   `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// check is a readiness check, run returns a status and the error that caused it
+type check struct {
+	name string
+	// failure is reported when the check doesn't pass
+	failure string
+	run     func(ctx context.Context) (CheckStatus, error)
+}
+
+// Report whether the process is up. It doesn't check dependencies, so a failing database doesn't get the process restarted.
+// @summary Liveness probe
+// @tag health
+func livenessHandler(_ context.Context, _ EmptyRequest) (*ProbeResponse, error) {
+	return &ProbeResponse{Status: checkPass}, nil
+}
+
+// Report whether the server can take traffic: it isn't shutting down, the database answers and its schema is up to date
+// @summary Readiness probe
+// @tag health
+// @error 503 service_unavailable
+func readinessHandler(ctx context.Context, _ EmptyRequest) (*ProbeResponse, error) {
+	return checkReadiness(ctx, app.From(ctx))
+}
+
+// checkReadiness runs the readiness checks of a concurrently. It fails with a
+// 503 problem carrying the results when a check failed.
+func checkReadiness(ctx context.Context, a *app.App) (*ProbeResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	checks := readinessChecks(a)
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			status, err := c.run(ctx)
+			results[i] = CheckResult{
+				Name:      c.name,
+				Status:    status,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if status != checkPass {
+				results[i].Error = c.failure
+				httplog.LogEntry(ctx).Warn("readiness check didn't pass", "check", c.name, "status", status, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	resp := &ProbeResponse{Status: checkPass, Checks: results}
+	for _, r := range results {
+		switch r.Status {
+		case checkFail:
+			return nil, middleware.NewError(http.StatusServiceUnavailable, middleware.CodeUnavailable, "not ready").
+				WithExtension("checks", results)
+		case checkWarn:
+			resp.Status = checkWarn
+		}
+	}
+	return resp, nil
+}
+
+// readinessChecks returns the checks that apply to the store of a
+func readinessChecks(a *app.App) []check {
+	checks := []check{{name: "shutdown", failure: "shutting down", run: func(context.Context) (CheckStatus, error) {
+		select {
+		case <-a.Stopping():
+			return checkFail, errors.New("shutting down")
+		default:
+			return checkPass, nil
+		}
+	}}}
+
+	if db, ok := a.Store.(interface{ Ping(context.Context) error }); ok {
+		checks = append(checks, check{name: "database", failure: "unavailable", run: func(ctx context.Context) (CheckStatus, error) {
+			if err := db.Ping(ctx); err != nil {
+				return checkFail, err
+			}
+			return checkPass, nil
+		}})
+	}
+
+	if db, ok := a.Store.(interface{ Stats() models.PoolStats }); ok {
+		checks = append(checks, check{name: "pool", failure: "saturated", run: func(context.Context) (CheckStatus, error) {
+			stats := db.Stats()
+			if stats.MaxConns > 0 && float64(stats.AcquiredConns)/float64(stats.MaxConns) >= poolSaturationWarn {
+				return checkWarn, fmt.Errorf("%d of %d connections in use, %d idle", stats.AcquiredConns, stats.MaxConns, stats.IdleConns)
+			}
+			return checkPass, nil
+		}})
+	}
+
+	if a.Migrator != nil {
+		checks = append(checks, check{name: "migrations", failure: "out of date", run: func(ctx context.Context) (CheckStatus, error) {
+			pending, err := a.Migrator.Pending(ctx)
+			if err != nil {
+				return checkFail, err
+			}
+			if pending > 0 {
+				return checkFail, fmt.Errorf("%d migrations are not applied", pending)
+			}
+			return checkPass, nil
+		}})
+	}
+
+	return checks
+}
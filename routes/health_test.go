@@ -0,0 +1,90 @@
+package routes_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/wangfenjin/mojito/models/memory"
+	"github.com/wangfenjin/mojito/routes"
+	"github.com/wangfenjin/mojito/testutil"
+)
+
+// unreachableStore is a store whose database doesn't answer pings
+type unreachableStore struct {
+	*memory.Store
+}
+
+func (unreachableStore) Ping(context.Context) error {
+	return errors.New("connection refused")
+}
+
+// notReady is the problem returned when the server isn't ready
+type notReady struct {
+	Code   string               `json:"code"`
+	Checks []routes.CheckResult `json:"checks"`
+}
+
+// check returns the result of the named check
+func check(t *testing.T, checks []routes.CheckResult, name string) routes.CheckResult {
+	t.Helper()
+	for _, c := range checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no %s check in %+v", name, checks)
+	return routes.CheckResult{}
+}
+
+func TestLiveness(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+
+	probe := testutil.Expect[routes.ProbeResponse](s.Get("/livez").Do(), http.StatusOK)
+	if probe.Status != "pass" {
+		t.Errorf("status = %q, want pass", probe.Status)
+	}
+
+	// Liveness doesn't depend on the shutdown
+	s.App.Stop()
+	s.Get("/livez").Do().Status(http.StatusOK)
+}
+
+func TestReadiness(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+
+	probe := testutil.Expect[routes.ProbeResponse](s.Get("/readyz").Do(), http.StatusOK)
+	if probe.Status != "pass" || check(t, probe.Checks, "shutdown").Status != "pass" {
+		t.Errorf("probe = %+v", probe)
+	}
+	health := testutil.Expect[routes.HealthCheckResponse](s.Get("/api/v1/utils/health-check/").Do(), http.StatusOK)
+	if !health.Status || len(health.Checks) != len(probe.Checks) {
+		t.Errorf("health = %+v, want the readiness checks", health)
+	}
+
+	// Not ready once shutdown starts
+	s.App.Stop()
+	for _, path := range []string{"/readyz", "/api/v1/utils/health-check/"} {
+		problem := testutil.Expect[notReady](s.Get(path).Do(), http.StatusServiceUnavailable)
+		if c := check(t, problem.Checks, "shutdown"); c.Status != "fail" || c.Error != "shutting down" {
+			t.Errorf("%s: shutdown check = %+v", path, c)
+		}
+	}
+}
+
+func TestReadinessDatabaseDown(t *testing.T) {
+	s := testutil.New(t, testutil.Options{Store: unreachableStore{memory.New()}})
+
+	problem := testutil.Expect[notReady](s.Get("/readyz").Do(), http.StatusServiceUnavailable)
+	if problem.Code != "service_unavailable" {
+		t.Errorf("code = %q", problem.Code)
+	}
+	// The cause is logged, not returned
+	if c := check(t, problem.Checks, "database"); c.Status != "fail" || c.Error != "unavailable" {
+		t.Errorf("database check = %+v, want a generic error", c)
+	}
+	if c := check(t, problem.Checks, "shutdown"); c.Status != "pass" {
+		t.Errorf("shutdown check = %+v", c)
+	}
+}
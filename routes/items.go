@@ -3,28 +3,29 @@ package routes
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/wangfenjin/mojito/app"
 	"github.com/wangfenjin/mojito/common"
 	"github.com/wangfenjin/mojito/middleware"
-	"github.com/wangfenjin/mojito/models"
 	"github.com/wangfenjin/mojito/models/gen"
 )
 
 // RegisterItemsRoutes registers all item related routes
-func RegisterItemsRoutes(r chi.Router) {
+func RegisterItemsRoutes(r chi.Router, a *app.App) {
 	r.Route("/api/v1/items", func(r chi.Router) {
 		// Apply auth middleware to all item routes
-		r.Use(middleware.RequireAuth())
+		r.Use(a.RequireAuth())
 
-		r.Post("/", middleware.WithHandler(createItemHandler))
-		r.Get("/{id}", middleware.WithHandler(getItemHandler))
-		r.Patch("/{id}", middleware.WithHandler(updateItemHandler))
-		r.Delete("/{id}", middleware.WithHandler(deleteItemHandler))
-		r.Get("/", middleware.WithHandler(listItemsHandler))
+		r.Method(http.MethodPost, "/", middleware.WithHandler(createItemHandler))
+		r.Method(http.MethodGet, "/{id}", middleware.WithHandler(getItemHandler))
+		r.Method(http.MethodPatch, "/{id}", middleware.WithHandler(updateItemHandler))
+		r.Method(http.MethodDelete, "/{id}", middleware.WithHandler(deleteItemHandler))
+		r.Method(http.MethodGet, "/", middleware.WithHandler(listItemsHandler))
 	})
 }
 
@@ -73,14 +74,14 @@ type ItemsResponse struct {
 // Update handlers to use the new response types
 func createItemHandler(ctx context.Context, req CreateItemRequest) (*ItemResponse, error) {
 	claims := ctx.Value("claims").(*common.Claims)
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	ownerID, err := uuid.Parse(claims.UserID)
 	if err != nil {
 		return nil, middleware.NewBadRequestError("invalid owner ID")
 	}
 
-	item, err := db.CreateItem(ctx, gen.CreateItemParams{
+	item, err := a.Items.CreateItem(ctx, gen.CreateItemParams{
 		Title:       req.Title,
 		Description: pgtype.Text{String: req.Description, Valid: true},
 		OwnerID:     ownerID,
@@ -99,9 +100,11 @@ func createItemHandler(ctx context.Context, req CreateItemRequest) (*ItemRespons
 	}, nil
 }
 
+// @error 403 item.access_denied
+// @error 404 item.not_found
 func getItemHandler(ctx context.Context, req GetItemRequest) (*ItemResponse, error) {
 	claims := ctx.Value("claims").(*common.Claims)
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	ownerID, err := uuid.Parse(claims.UserID)
 	if err != nil {
@@ -113,12 +116,12 @@ func getItemHandler(ctx context.Context, req GetItemRequest) (*ItemResponse, err
 		return nil, middleware.NewBadRequestError("invalid item ID format")
 	}
 
-	item, err := db.GetItemByID(ctx, id)
+	item, err := a.Items.GetItemByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("error getting item: %w", err)
+		return nil, fmt.Errorf("error getting item: %w", notFound(err, ErrCodeItemNotFound, "item not found"))
 	}
 	if item.OwnerID != ownerID && !claims.IsSuperUser {
-		return nil, middleware.NewForbiddenError("item not found or access denied")
+		return nil, middleware.NewForbiddenError("item not found or access denied").WithCode(ErrCodeItemAccessDenied)
 	}
 
 	return &ItemResponse{
@@ -130,9 +133,11 @@ func getItemHandler(ctx context.Context, req GetItemRequest) (*ItemResponse, err
 	}, nil
 }
 
+// @error 403 item.access_denied
+// @error 404 item.not_found
 func updateItemHandler(ctx context.Context, req UpdateItemRequest) (*ItemResponse, error) {
 	claims := ctx.Value("claims").(*common.Claims)
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	ownerID, err := uuid.Parse(claims.UserID)
 	if err != nil {
@@ -143,15 +148,15 @@ func updateItemHandler(ctx context.Context, req UpdateItemRequest) (*ItemRespons
 		return nil, middleware.NewBadRequestError("invalid item ID format")
 	}
 
-	item, err := db.GetItemByID(ctx, id)
+	item, err := a.Items.GetItemByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("error getting item: %w", err)
+		return nil, fmt.Errorf("error getting item: %w", notFound(err, ErrCodeItemNotFound, "item not found"))
 	}
 	if item.OwnerID != ownerID && !claims.IsSuperUser {
-		return nil, middleware.NewForbiddenError("item not found or access denied")
+		return nil, middleware.NewForbiddenError("item not found or access denied").WithCode(ErrCodeItemAccessDenied)
 	}
 
-	item, err = db.UpdateItem(ctx, gen.UpdateItemParams{
+	item, err = a.Items.UpdateItem(ctx, gen.UpdateItemParams{
 		Title:       req.Title,
 		Description: pgtype.Text{String: req.Description, Valid: true},
 		ID:          id,
@@ -169,9 +174,11 @@ func updateItemHandler(ctx context.Context, req UpdateItemRequest) (*ItemRespons
 	}, nil
 }
 
+// @error 403 item.access_denied
+// @error 404 item.not_found
 func deleteItemHandler(ctx context.Context, req GetItemRequest) (*MessageResponse, error) {
 	claims := ctx.Value("claims").(*common.Claims)
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	// Get user_id from context
 	ownerID, err := uuid.Parse(claims.UserID)
@@ -185,15 +192,15 @@ func deleteItemHandler(ctx context.Context, req GetItemRequest) (*MessageRespons
 	}
 
 	// Check if item exists and belongs to the user
-	item, err := db.GetItemByID(ctx, id)
+	item, err := a.Items.GetItemByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("error getting item: %w", err)
+		return nil, fmt.Errorf("error getting item: %w", notFound(err, ErrCodeItemNotFound, "item not found"))
 	}
 	if item.OwnerID != ownerID && !claims.IsSuperUser {
-		return nil, middleware.NewBadRequestError("item not found or access denied")
+		return nil, middleware.NewForbiddenError("item not found or access denied").WithCode(ErrCodeItemAccessDenied)
 	}
 
-	err = db.DeleteItem(ctx, id)
+	err = a.Items.DeleteItem(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("error deleting item: %w", err)
 	}
@@ -205,7 +212,7 @@ func deleteItemHandler(ctx context.Context, req GetItemRequest) (*MessageRespons
 
 func listItemsHandler(ctx context.Context, req ListItemsRequest) (*ItemsResponse, error) {
 	claims := ctx.Value("claims").(*common.Claims)
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	// Get user_id from context
 	ownerID, err := uuid.Parse(claims.UserID)
@@ -213,7 +220,7 @@ func listItemsHandler(ctx context.Context, req ListItemsRequest) (*ItemsResponse
 		return nil, middleware.NewBadRequestError("invalid owner ID")
 	}
 
-	items, err := db.ListItemsByOwner(ctx, gen.ListItemsByOwnerParams{
+	items, err := a.Items.ListItemsByOwner(ctx, gen.ListItemsByOwnerParams{
 		OwnerID: ownerID,
 		Limit:   req.Limit,
 		Offset:  req.Skip,
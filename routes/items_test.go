@@ -0,0 +1,77 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/wangfenjin/mojito/routes"
+	"github.com/wangfenjin/mojito/testutil"
+)
+
+func TestItems(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	_, token := s.NewUser("test@example.com")
+
+	item := testutil.Expect[routes.ItemResponse](s.Post("/api/v1/items/").Token(token).JSON(routes.CreateItemRequest{
+		Title:       "Test Item",
+		Description: "This is a test item",
+	}).Do(), http.StatusOK)
+	if item.Title != "Test Item" || item.Description != "This is a test item" || item.CreatedAt.IsZero() {
+		t.Errorf("created item = %+v", item)
+	}
+	path := "/api/v1/items/" + item.ID.String()
+
+	got := testutil.Expect[routes.ItemResponse](s.Get(path).Token(token).Do(), http.StatusOK)
+	if got.ID != item.ID || got.Title != "Test Item" || got.Description != "This is a test item" {
+		t.Errorf("item = %+v, want %+v", got, item)
+	}
+
+	update := routes.UpdateItemRequest{Title: "Updated Item", Description: "This is an updated item"}
+	got = testutil.Expect[routes.ItemResponse](s.Patch(path).Token(token).JSON(update).Do(), http.StatusOK)
+	if got.ID != item.ID || got.Title != update.Title || got.Description != update.Description {
+		t.Errorf("updated item = %+v", got)
+	}
+
+	list := testutil.Expect[routes.ItemsResponse](
+		s.Get("/api/v1/items/").Token(token).Query("skip", "0").Query("limit", "10").Do(), http.StatusOK)
+	if len(list.Items) != 1 || list.Items[0].ID != item.ID {
+		t.Errorf("items = %+v, want the created item", list.Items)
+	}
+	if list.Meta.Skip != 0 || list.Meta.Limit != 10 {
+		t.Errorf("meta = %+v", list.Meta)
+	}
+
+	// Other users can't see or change the item
+	_, other := s.NewUser("test2@example.com")
+	s.Get(path).Token(other).Do().Problem(http.StatusForbidden, routes.ErrCodeItemAccessDenied)
+	s.Patch(path).Token(other).JSON(update).Do().Problem(http.StatusForbidden, routes.ErrCodeItemAccessDenied)
+	list = testutil.Expect[routes.ItemsResponse](
+		s.Get("/api/v1/items/").Token(other).Query("skip", "0").Query("limit", "10").Do(), http.StatusOK)
+	if len(list.Items) != 0 {
+		t.Errorf("other user lists %d items, want none", len(list.Items))
+	}
+
+	msg := testutil.Expect[routes.MessageResponse](s.Delete(path).Token(token).Do(), http.StatusOK)
+	if msg.Message != "item deleted successfully" {
+		t.Errorf("message = %q", msg.Message)
+	}
+	s.Get(path).Token(token).Do().Problem(http.StatusNotFound, routes.ErrCodeItemNotFound)
+}
+
+func TestListItemsPaging(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	_, token := s.NewUser("test@example.com")
+
+	for _, title := range []string{"first", "second", "third"} {
+		s.Post("/api/v1/items/").Token(token).JSON(routes.CreateItemRequest{Title: title, Description: title}).Do().Status(http.StatusOK)
+	}
+
+	// The newest items come first
+	list := testutil.Expect[routes.ItemsResponse](
+		s.Get("/api/v1/items/").Token(token).Query("skip", "1").Query("limit", "1").Do(), http.StatusOK)
+	if len(list.Items) != 1 || list.Items[0].Title != "second" {
+		t.Errorf("items = %+v, want the second item", list.Items)
+	}
+
+	s.Get("/api/v1/items/").Token(token).Query("limit", "0").Do().Status(http.StatusUnprocessableEntity)
+}
@@ -2,25 +2,53 @@ package routes
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/httplog/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/wangfenjin/mojito/app"
 	"github.com/wangfenjin/mojito/common"
 	"github.com/wangfenjin/mojito/middleware"
-	"github.com/wangfenjin/mojito/models"
+	"github.com/wangfenjin/mojito/models/gen"
+	"github.com/wangfenjin/mojito/outbox"
 )
 
+// user_token purposes
+const (
+	tokenPurposePasswordReset     = "password_reset"
+	tokenPurposeEmailVerification = "email_verification"
+	tokenPurposeEmailChange       = "email_change"
+)
+
+// topicPasswordRecovery is the outbox topic of password recovery requests, see passwordRecoverySink
+const topicPasswordRecovery = "password_recovery"
+
+// previewToken stands for the reset token in email previews, which must not issue a real one
+const previewToken = "preview"
+
+// recoverPasswordMessage is returned for every recovery request, whether or not the account exists
+const recoverPasswordMessage = "if the account exists, a password recovery email has been sent"
+
 // RegisterLoginRoutes registers all login related routes
-func RegisterLoginRoutes(r chi.Router) {
+func RegisterLoginRoutes(r chi.Router, a *app.App) {
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Post("/login/access-token", middleware.WithHandler(loginAccessTokenHandler))
-		r.Get("/login/test-token", middleware.WithHandler(testTokenHandler))
-		r.Post("/password-recovery/{email}", middleware.WithHandler(recoverPasswordHandler))
-		r.Post("/reset-password/", middleware.WithHandler(resetPasswordHandler))
-		r.Post("/password-recovery-html-content/{email}", middleware.WithHandler(recoverPasswordHTMLContentHandler))
+		r.Method(http.MethodPost, "/login/access-token", middleware.WithHandler(loginAccessTokenHandler))
+		r.Method(http.MethodPost, "/login/refresh", middleware.WithHandler(refreshTokenHandler))
+		r.Method(http.MethodPost, "/logout", middleware.WithHandler(logoutHandler))
+		r.With(a.RequireAuth()).Method(http.MethodGet, "/login/test-token", middleware.WithHandler(testTokenHandler))
+		r.Method(http.MethodPost, "/password-recovery/{email}", middleware.WithHandler(recoverPasswordHandler))
+		r.Method(http.MethodPost, "/reset-password/", middleware.WithHandler(resetPasswordHandler))
+		r.With(a.RequireAuth()).Method(http.MethodPost, "/password-recovery-html-content/{email}", middleware.WithHandler(recoverPasswordHTMLContentHandler))
 	})
+	if a.Dispatcher != nil {
+		a.Dispatcher.Register(topicPasswordRecovery, &passwordRecoverySink{app: a})
+	}
 }
 
 // LoginAccessTokenRequest structs
@@ -33,26 +61,41 @@ type LoginAccessTokenRequest struct {
 	ClientSecret string `form:"client_secret"`
 }
 
-// RecoverPasswordRequest structs
+// RefreshTokenRequest structs, accepted both as an OAuth2 form and as JSON
+type RefreshTokenRequest struct {
+	RefreshToken string `form:"refresh_token" json:"refresh_token" binding:"required"`
+	GrantType    string `form:"grant_type" json:"grant_type" binding:"omitempty,eq=refresh_token"`
+}
+
+// LogoutRequest structs
+type LogoutRequest struct {
+	RefreshToken string `form:"refresh_token" json:"refresh_token" binding:"required"`
+}
+
+// RecoverPasswordRequest structs, the email is sent in the language picked from Accept-Language
 type RecoverPasswordRequest struct {
-	Email string `uri:"email" binding:"required,email"`
+	Email  string `uri:"email" binding:"required,email"`
+	Locale string `header:"Accept-Language"`
 }
 
-// ResetPasswordRequest structs
+// ResetPasswordRequest structs, the password length is checked against the configured password policy
 type ResetPasswordRequest struct {
 	Token    string `json:"token" binding:"required"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
 }
 
 // RecoverPasswordHTMLContentRequest structs
 type RecoverPasswordHTMLContentRequest struct {
-	Email string `uri:"email" binding:"required,email"`
+	Email  string `uri:"email" binding:"required,email"`
+	Locale string `header:"Accept-Language"`
 }
 
 // TokenResponse structs
 type TokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 // MessageResponse structs
@@ -72,89 +115,359 @@ type HTMLContentResponse struct {
 }
 
 // Login handlers with updated signatures
+// @error 400 auth.invalid_credentials
+// @error 400 auth.inactive_user
+// @error 403 auth.email_not_verified
 func loginAccessTokenHandler(ctx context.Context, req LoginAccessTokenRequest) (*TokenResponse, error) {
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	// Get user by email
-	user, err := db.GetUserByEmail(ctx, req.Username)
+	user, err := a.Users.GetUserByEmail(ctx, req.Username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Don't reveal whether the account exists
+		return nil, middleware.NewBadRequestError("invalid credentials").WithCode(ErrCodeInvalidCredentials)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error getting user: %w", err)
 	}
 
 	// Check password using utils package
 	if !common.CheckPasswordHash(req.Password, user.HashedPassword) {
-		return nil, middleware.NewBadRequestError("invalid credentials")
+		return nil, middleware.NewBadRequestError("invalid credentials").WithCode(ErrCodeInvalidCredentials)
 	}
 	// Check if user is active
 	if !user.IsActive {
-		return nil, middleware.NewBadRequestError("inactive user")
+		return nil, middleware.NewBadRequestError("inactive user").WithCode(ErrCodeInactiveUser)
+	}
+	if a.Config.Auth.RequireEmailVerification && !user.EmailVerifiedAt.Valid {
+		return nil, middleware.NewForbiddenError("email is not verified").WithCode(ErrCodeEmailNotVerified)
 	}
 
-	// Generate token
-	token, err := common.GenerateToken(user.ID.String(), user.Email)
+	// Generate tokens, starting a new refresh token family
+	resp, _, err := issueTokens(ctx, a.Tokens, a.Store, user, uuid.New())
 	if err != nil {
-		return nil, fmt.Errorf("error generating token: %w", err)
+		return nil, err
 	}
+	return resp, nil
+}
+
+// issueTokens creates an access token and a refresh token in the given family.
+// It returns the id of the stored refresh token so callers can link rotated tokens to it.
+func issueTokens(ctx context.Context, tokens *common.TokenService, q gen.Querier, user gen.User, familyID uuid.UUID) (*TokenResponse, uuid.UUID, error) {
+	accessToken, err := tokens.GenerateToken(user.ID.String(), user.Email, user.TokenVersion)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("error generating token: %w", err)
+	}
+
+	refreshToken, hash, err := common.GenerateOpaqueToken()
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
+	stored, err := q.CreateRefreshToken(ctx, gen.CreateRefreshTokenParams{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(tokens.RefreshTokenTTL()), Valid: true},
+	})
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("error storing refresh token: %w", err)
+	}
+
 	return &TokenResponse{
-		AccessToken: token,
-		TokenType:   "bearer",
-	}, nil
+		AccessToken:  accessToken,
+		TokenType:    "bearer",
+		ExpiresIn:    int(tokens.AccessTokenTTL().Seconds()),
+		RefreshToken: refreshToken,
+	}, stored.ID, nil
 }
 
-// TestTokenRequest represents a request for generating test tokens
-type TestTokenRequest struct {
-	Token string `header:"Authorization" binding:"required"`
+// Exchange a refresh token for a new token pair. Every refresh token can be used once;
+// presenting an already rotated token revokes its whole family, since one of the
+// parties holding it must have stolen it.
+// @summary Refresh access token
+// @tag login
+// @error 401 auth.invalid_refresh_token
+// @error 401 auth.refresh_token_reused
+// @error 401 auth.inactive_user
+func refreshTokenHandler(ctx context.Context, req RefreshTokenRequest) (*TokenResponse, error) {
+	a := app.From(ctx)
+
+	var resp *TokenResponse
+	reused := false
+	err := a.Store.WithTx(ctx, func(q gen.Querier) error {
+		current, err := q.GetRefreshTokenByHash(ctx, common.HashOpaqueToken(req.RefreshToken))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return middleware.NewUnauthorizedError("invalid refresh token").WithCode(ErrCodeInvalidRefreshToken)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting refresh token: %w", err)
+		}
+
+		if current.RevokedAt.Valid {
+			// Commit the revocation, the error is returned after the transaction
+			reused = true
+			return q.RevokeRefreshTokenFamily(ctx, current.FamilyID)
+		}
+		if time.Now().After(current.ExpiresAt.Time) {
+			return middleware.NewUnauthorizedError("refresh token expired").WithCode(ErrCodeInvalidRefreshToken)
+		}
+
+		user, err := q.GetUserByID(ctx, current.UserID)
+		if err != nil {
+			return fmt.Errorf("error getting user: %w", err)
+		}
+		if !user.IsActive {
+			return middleware.NewUnauthorizedError("inactive user").WithCode(ErrCodeInactiveUser)
+		}
+
+		var nextID uuid.UUID
+		resp, nextID, err = issueTokens(ctx, a.Tokens, q, user, current.FamilyID)
+		if err != nil {
+			return err
+		}
+		rotated, err := q.RotateRefreshToken(ctx, gen.RotateRefreshTokenParams{
+			ID:         current.ID,
+			ReplacedBy: pgtype.UUID{Bytes: nextID, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("error rotating refresh token: %w", err)
+		}
+		if rotated == 0 {
+			return middleware.NewUnauthorizedError("invalid refresh token").WithCode(ErrCodeInvalidRefreshToken)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, middleware.NewUnauthorizedError("refresh token has already been used").WithCode(ErrCodeRefreshTokenReused)
+	}
+	return resp, nil
 }
 
-// Update handler signatures to use pointer returns
-func testTokenHandler(ctx context.Context, req TestTokenRequest) (*TestTokenResponse, error) {
-	// Get token from Authorization header
-	authHeader := req.Token
-	// Extract token from "Bearer <token>"
-	tokenString := string(authHeader[7:])
-	claims, err := common.ValidateToken(tokenString)
+// Revoke the refresh token family, signing the client out
+// @summary Logout
+// @tag login
+func logoutHandler(ctx context.Context, req LogoutRequest) (*MessageResponse, error) {
+	a := app.From(ctx)
+
+	err := a.Store.WithTx(ctx, func(q gen.Querier) error {
+		current, err := q.GetRefreshTokenByHash(ctx, common.HashOpaqueToken(req.RefreshToken))
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Logging out twice is not an error
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error getting refresh token: %w", err)
+		}
+		return q.RevokeRefreshTokenFamily(ctx, current.FamilyID)
+	})
 	if err != nil {
-		httplog.LogEntrySetField(ctx, "error", slog.StringValue(err.Error()))
-		return nil, middleware.NewUnauthorizedError("invalid token")
+		return nil, fmt.Errorf("error revoking refresh token: %w", err)
 	}
 
+	return &MessageResponse{
+		Message: "logged out",
+	}, nil
+}
+
+// Return the user the access token was issued to. The token is rejected when
+// its signature, user or version doesn't check out.
+func testTokenHandler(ctx context.Context, _ any) (*TestTokenResponse, error) {
+	claims := ctx.Value("claims").(*common.Claims)
+
 	return &TestTokenResponse{
 		UserID: claims.UserID,
 		Email:  claims.Email,
 	}, nil
 }
 
+// Send a password reset link. The response is the same whether or not the
+// account exists, so the endpoint can't be used to enumerate users.
 // @summary Recover password
 // @tag login
 func recoverPasswordHandler(ctx context.Context, req RecoverPasswordRequest) (*MessageResponse, error) {
-	db := models.GetDB()
+	a := app.From(ctx)
 
-	// Check if user exists
-	_, err := db.GetUserByEmail(ctx, req.Email)
-	if err != nil {
-		return nil, fmt.Errorf("error getting user: %w", err)
+	// The account is looked up by the outbox, so the request takes the same time whether or not it exists
+	if err := outbox.Enqueue(ctx, a.Store, topicPasswordRecovery, passwordRecovery{
+		Email:  req.Email,
+		Locale: req.Locale,
+	}); err != nil {
+		return nil, err
 	}
-
-	// TODO: Generate password reset token and send email
-	// For now, just return success message
 	return &MessageResponse{
-		Message: "password recovery email sent",
+		Message: recoverPasswordMessage,
 	}, nil
 }
 
+// passwordRecovery is the payload of password recovery messages
+type passwordRecovery struct {
+	Email  string `json:"email"`
+	Locale string `json:"locale,omitempty"`
+}
+
+// passwordRecoverySink sends the password reset email of recovery requests for active accounts,
+// requests for other addresses are dropped
+type passwordRecoverySink struct {
+	app *app.App
+}
+
+// Deliver implements outbox.Sink. The email is enqueued in the outbox together with its token.
+func (s *passwordRecoverySink) Deliver(ctx context.Context, payload []byte) error {
+	var req passwordRecovery
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return outbox.Permanent(fmt.Errorf("invalid password recovery payload: %w", err))
+	}
+
+	a := s.app
+	user, err := a.Users.GetUserByEmail(ctx, req.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	if !user.IsActive {
+		return nil
+	}
+
+	ttl := a.Tokens.PasswordResetTTL()
+	return a.Store.WithTx(ctx, func(q gen.Querier) error {
+		token, err := issueUserToken(ctx, a.Tokens, q, user.ID, tokenPurposePasswordReset, ttl, "")
+		if err != nil {
+			return err
+		}
+		msg, err := a.Sender.PasswordResetMessage(user.Email, token, ttl, req.Locale)
+		if err != nil {
+			return fmt.Errorf("error rendering password recovery email: %w", err)
+		}
+		return outbox.EnqueueEmail(ctx, q, msg)
+	})
+}
+
+// issueUserToken creates a single-use token for purpose, invalidating the user's
+// previous tokens for the same purpose so only the latest link works.
+// newEmail is only set for email change tokens.
+func issueUserToken(ctx context.Context, tokens *common.TokenService, q gen.Querier, userID uuid.UUID, purpose string, ttl time.Duration, newEmail string) (string, error) {
+	token, hash, err := tokens.NewActionToken(purpose)
+	if err != nil {
+		return "", fmt.Errorf("error generating %s token: %w", purpose, err)
+	}
+	if err := q.InvalidateUserTokens(ctx, gen.InvalidateUserTokensParams{
+		UserID:  userID,
+		Purpose: purpose,
+	}); err != nil {
+		return "", fmt.Errorf("error invalidating %s tokens: %w", purpose, err)
+	}
+	_, err = q.CreateUserToken(ctx, gen.CreateUserTokenParams{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(ttl), Valid: true},
+		NewEmail:  pgtype.Text{String: newEmail, Valid: newEmail != ""},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing %s token: %w", purpose, err)
+	}
+	return token, nil
+}
+
+// Set a new password with a token from the recovery email. The token can be used once
+// and all sessions of the user are signed out afterwards.
 // @summary Reset password
 // @tag login
-func resetPasswordHandler(_ context.Context, _ ResetPasswordRequest) (*MessageResponse, error) {
-	// TODO: Implement password reset logic with token validation
+// @error 400 auth.invalid_reset_token
+func resetPasswordHandler(ctx context.Context, req ResetPasswordRequest) (*MessageResponse, error) {
+	invalidToken := middleware.NewBadRequestError("invalid or expired reset token").WithCode(ErrCodeInvalidResetToken)
+
+	a := app.From(ctx)
+	hash, err := a.Tokens.VerifyActionToken(tokenPurposePasswordReset, req.Token)
+	if err != nil {
+		return nil, invalidToken
+	}
+	if err := checkPassword(ctx, "password", req.Password); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := a.Passwords.Hash(req.Password)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing password: %w", err)
+	}
+
+	err = a.Store.WithTx(ctx, func(q gen.Querier) error {
+		token, err := q.GetUserTokenByHash(ctx, gen.GetUserTokenByHashParams{
+			TokenHash: hash,
+			Purpose:   tokenPurposePasswordReset,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return invalidToken
+		}
+		if err != nil {
+			return fmt.Errorf("error getting reset token: %w", err)
+		}
+		if token.UsedAt.Valid || time.Now().After(token.ExpiresAt.Time) {
+			return invalidToken
+		}
+
+		user, err := q.GetUserByID(ctx, token.UserID)
+		if err != nil {
+			return fmt.Errorf("error getting user: %w", err)
+		}
+		if !user.IsActive {
+			return invalidToken
+		}
+
+		used, err := q.MarkUserTokenUsed(ctx, token.ID)
+		if err != nil {
+			return fmt.Errorf("error revoking reset token: %w", err)
+		}
+		if used == 0 {
+			return invalidToken
+		}
+		if _, err := q.UpdateUser(ctx, gen.UpdateUserParams{
+			ID:             user.ID,
+			HashedPassword: pgtype.Text{String: hashedPassword, Valid: true},
+		}); err != nil {
+			return fmt.Errorf("error updating password: %w", err)
+		}
+		return revokeUserTokens(ctx, q, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return &MessageResponse{
 		Message: "password reset successful",
 	}, nil
 }
 
+// Preview the password recovery email of a user. The reset link carries a
+// placeholder token, the links sent to the user keep working.
 // @summary Get password recovery HTML content
 // @tag login
-func recoverPasswordHTMLContentHandler(_ context.Context, _ RecoverPasswordHTMLContentRequest) (*HTMLContentResponse, error) {
+// @error 403 auth.superuser_required
+// @error 404 user.not_found
+func recoverPasswordHTMLContentHandler(ctx context.Context, req RecoverPasswordHTMLContentRequest) (*HTMLContentResponse, error) {
+	claims := ctx.Value("claims").(*common.Claims)
+	if !claims.IsSuperUser {
+		return nil, middleware.NewForbiddenError("only superusers can preview emails").WithCode(ErrCodeSuperuserRequired)
+	}
+
+	a := app.From(ctx)
+	user, err := a.Users.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", notFound(err, ErrCodeUserNotFound, "user not found"))
+	}
+
+	msg, err := a.Sender.PasswordResetMessage(user.Email, previewToken, a.Tokens.PasswordResetTTL(), req.Locale)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering password recovery email: %w", err)
+	}
+
 	return &HTMLContentResponse{
-		HTMLContent: "<h1>Reset Your Password</h1><p>Click the link below to reset your password.</p>",
+		HTMLContent: msg.HTML,
 	}, nil
 }
@@ -0,0 +1,230 @@
+package routes_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/wangfenjin/mojito/middleware"
+	"github.com/wangfenjin/mojito/models/gen"
+	"github.com/wangfenjin/mojito/models/memory"
+	"github.com/wangfenjin/mojito/routes"
+	"github.com/wangfenjin/mojito/testutil"
+)
+
+func TestLogin(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	s.SignUp("test@example.com", "password123", "Test User")
+
+	token := s.Login("test@example.com", "password123")
+	if token.AccessToken == "" || token.RefreshToken == "" {
+		t.Fatalf("login returned no tokens: %+v", token)
+	}
+	if token.ExpiresIn <= 0 {
+		t.Errorf("expires_in = %d, want > 0", token.ExpiresIn)
+	}
+	if token.TokenType != "bearer" {
+		t.Errorf("token_type = %q, want bearer", token.TokenType)
+	}
+
+	me := testutil.Expect[routes.TestTokenResponse](
+		s.Get("/api/v1/login/test-token").Token(token.AccessToken).Do(), http.StatusOK)
+	if me.UserID == "" || me.Email != "test@example.com" {
+		t.Errorf("test-token = %+v, want the user test@example.com", me)
+	}
+	s.Get("/api/v1/login/test-token").Do().Problem(http.StatusUnauthorized, middleware.CodeUnauthorized)
+	s.Get("/api/v1/login/test-token").Token("invalid").Do().Problem(http.StatusUnauthorized, middleware.CodeUnauthorized)
+}
+
+func TestLoginInvalidCredentials(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	s.SignUp("test@example.com", "password123", "Test User")
+
+	problem := s.Post("/api/v1/login/access-token").Form(url.Values{
+		"username":   {"test@example.com"},
+		"password":   {"wrongpassword"},
+		"grant_type": {"password"},
+	}).Do().Problem(http.StatusBadRequest, routes.ErrCodeInvalidCredentials)
+	if problem.Status != http.StatusBadRequest || problem.Detail != "invalid credentials" {
+		t.Errorf("problem = %+v", problem)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	s.SignUp("test@example.com", "password123", "Test User")
+	token := s.Login("test@example.com", "password123")
+
+	rotated := testutil.Expect[routes.TokenResponse](s.Post("/api/v1/login/refresh").Form(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+	}).Do(), http.StatusOK)
+	if rotated.AccessToken == "" || rotated.RefreshToken == token.RefreshToken {
+		t.Fatalf("refresh didn't rotate the token: %+v", rotated)
+	}
+
+	// Replaying the rotated token is detected and revokes the whole family
+	s.Post("/api/v1/login/refresh").Form(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+	}).Do().Problem(http.StatusUnauthorized, routes.ErrCodeRefreshTokenReused)
+	s.Post("/api/v1/login/refresh").JSON(routes.RefreshTokenRequest{
+		RefreshToken: rotated.RefreshToken,
+	}).Do().Status(http.StatusUnauthorized)
+}
+
+func TestLogout(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	s.SignUp("test@example.com", "password123", "Test User")
+	token := s.Login("test@example.com", "password123")
+
+	msg := testutil.Expect[routes.MessageResponse](s.Post("/api/v1/logout").JSON(routes.LogoutRequest{
+		RefreshToken: token.RefreshToken,
+	}).Do(), http.StatusOK)
+	if msg.Message != "logged out" {
+		t.Errorf("message = %q, want logged out", msg.Message)
+	}
+
+	s.Post("/api/v1/login/refresh").JSON(routes.RefreshTokenRequest{
+		RefreshToken: token.RefreshToken,
+	}).Do().Status(http.StatusUnauthorized)
+}
+
+func TestPasswordRecovery(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	s.SignUp("test@example.com", "password123", "Test User")
+	s.DeliverOutbox()
+	s.Mailer.Reset()
+
+	// Requests are queued as is, unknown accounts are only dropped by the outbox
+	s.Post("/api/v1/password-recovery/nonexistent@example.com").Do().Status(http.StatusOK)
+	if n := s.DeliverOutbox(); n != 1 || len(s.Mailer.Messages()) != 0 {
+		t.Fatalf("delivered %d messages and sent %v, want the recovery request and no email", n, s.Mailer.Messages())
+	}
+
+	// Unknown accounts get the same response
+	for _, address := range []string{"test@example.com", "nonexistent@example.com"} {
+		msg := testutil.Expect[routes.MessageResponse](
+			s.Post("/api/v1/password-recovery/"+address).Do(), http.StatusOK)
+		if msg.Message != "if the account exists, a password recovery email has been sent" {
+			t.Errorf("%s: message = %q", address, msg.Message)
+		}
+	}
+	s.DeliverOutbox()
+	if n := len(s.Mailer.Messages()); n != 1 {
+		t.Fatalf("%d emails sent, want 1", n)
+	}
+
+	s.Post("/api/v1/reset-password/").JSON(routes.ResetPasswordRequest{
+		Token:    "some-reset-token",
+		Password: "newpassword123",
+	}).Do().Problem(http.StatusBadRequest, routes.ErrCodeInvalidResetToken)
+
+	// The emailed link resets the password once
+	resetToken := linkToken(t, s.LastEmail().Text, "/reset-password?token=")
+	reset := routes.ResetPasswordRequest{Token: resetToken, Password: "newpassword123"}
+	s.Post("/api/v1/reset-password/").JSON(reset).Do().Status(http.StatusOK)
+	s.Post("/api/v1/reset-password/").JSON(reset).Do().
+		Problem(http.StatusBadRequest, routes.ErrCodeInvalidResetToken)
+	s.Login("test@example.com", "newpassword123")
+}
+
+func TestPasswordRecoveryHTMLContent(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	s.SignUp("test@example.com", "password123", "Test User")
+	s.Post("/api/v1/password-recovery/test@example.com").Do().Status(http.StatusOK)
+	s.DeliverOutbox()
+	resetToken := linkToken(t, s.LastEmail().Text, "/reset-password?token=")
+
+	s.Post("/api/v1/password-recovery-html-content/test@example.com").Do().Status(http.StatusUnauthorized)
+
+	admin := s.NewSuperuser("admin@example.com")
+	content := testutil.Expect[routes.HTMLContentResponse](
+		s.Post("/api/v1/password-recovery-html-content/test@example.com").Token(admin).Do(), http.StatusOK)
+	for _, want := range []string{"Reset your password", "/reset-password?token=preview", "test@example.com"} {
+		if !strings.Contains(content.HTMLContent, want) {
+			t.Errorf("html_content doesn't contain %q", want)
+		}
+	}
+	// The preview doesn't replace the link sent to the user
+	s.Post("/api/v1/reset-password/").JSON(routes.ResetPasswordRequest{Token: resetToken, Password: "newpassword123"}).
+		Do().Status(http.StatusOK)
+
+	// Preview in another locale
+	content = testutil.Expect[routes.HTMLContentResponse](
+		s.Post("/api/v1/password-recovery-html-content/test@example.com").
+			Token(admin).Header("Accept-Language", "zh-CN,zh;q=0.9").Do(), http.StatusOK)
+	if !strings.Contains(content.HTMLContent, "重置密码") {
+		t.Errorf("html_content isn't in Chinese")
+	}
+
+	s.Post("/api/v1/password-recovery-html-content/nobody@example.com").Token(admin).Do().Status(http.StatusNotFound)
+}
+
+// linkToken returns the token of the first link with prefix in an email body
+func linkToken(t *testing.T, body, prefix string) string {
+	t.Helper()
+
+	_, rest, ok := strings.Cut(body, prefix)
+	if !ok {
+		t.Fatalf("email has no %q link:\n%s", prefix, body)
+	}
+	token, _, _ := strings.Cut(rest, "\n")
+	token = strings.TrimSpace(token)
+	if unescaped, err := url.QueryUnescape(token); err == nil {
+		token = unescaped
+	}
+	return token
+}
+
+// brokenUsers is a store whose user lookups by id fail with err once it is set
+type brokenUsers struct {
+	*memory.Store
+	mu  sync.Mutex
+	err error
+}
+
+func (s *brokenUsers) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *brokenUsers) GetUserByID(ctx context.Context, id uuid.UUID) (gen.User, error) {
+	s.mu.Lock()
+	err := s.err
+	s.mu.Unlock()
+	if err != nil {
+		return gen.User{}, err
+	}
+	return s.Store.GetUserByID(ctx, id)
+}
+
+func TestAuthenticationErrors(t *testing.T) {
+	store := &brokenUsers{Store: memory.New()}
+	s := testutil.New(t, testutil.Options{Store: store})
+	_, token := s.NewUser("test@example.com")
+
+	problem := s.Get("/api/v1/users/me").Token("invalid").Do().Problem(http.StatusUnauthorized, middleware.CodeUnauthorized)
+	if problem.Detail != "invalid token" {
+		t.Errorf("detail = %q, want a fixed message", problem.Detail)
+	}
+
+	store.fail(pgx.ErrNoRows)
+	s.Get("/api/v1/users/me").Token(token).Do().Problem(http.StatusUnauthorized, middleware.CodeUnauthorized)
+
+	// Database failures aren't reported as authentication failures, nor leak their text
+	store.fail(context.DeadlineExceeded)
+	s.Get("/api/v1/users/me").Token(token).Do().Problem(http.StatusServiceUnavailable, middleware.CodeUnavailable)
+	store.fail(errors.New("read tcp 10.0.0.1:5432: connection reset by peer"))
+	problem = s.Get("/api/v1/users/me").Token(token).Do().Problem(http.StatusInternalServerError, middleware.CodeInternal)
+	if problem.RequestID == "" || strings.Contains(problem.Detail, "10.0.0.1") {
+		t.Errorf("problem = %+v, want a request id and no driver error", problem)
+	}
+}
@@ -0,0 +1,396 @@
+package routes_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/wangfenjin/mojito/middleware"
+	"github.com/wangfenjin/mojito/openapi"
+	"github.com/wangfenjin/mojito/testutil"
+)
+
+// TestOpenAPIRequests checks the documented parameters and request bodies of
+// every route against the binder: a request built from the spec alone must
+// bind every field of the request type, with the values the spec placed.
+func TestOpenAPIRequests(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	router := s.Config.Handler.(chi.Routes)
+
+	doc, err := openapi.NewDocument(router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec map[string]any
+	if err := json.Unmarshal(doc.JSON(), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	routes := 0
+	err = chi.Walk(router, func(method, route string, handler http.Handler, _ ...func(http.Handler) http.Handler) error {
+		d, ok := handler.(openapi.Describer)
+		if !ok || strings.Contains(route, "/test/") {
+			return nil
+		}
+		fi := d.Describe(method, route)
+		if fi.Hidden {
+			return nil
+		}
+		routes++
+		t.Run(method+" "+route, func(t *testing.T) {
+			path := strings.TrimPrefix(route, openapi.SwaggerDoc.BasePath)
+			op, ok := object(object(spec["paths"])[path])[strings.ToLower(method)].(map[string]any)
+			if !ok {
+				t.Fatalf("%s %s isn't documented", method, path)
+			}
+			if fi.RequestType.Kind() != reflect.Struct {
+				// Nothing is bound, nothing may be documented
+				if op["parameters"] != nil || op["requestBody"] != nil {
+					t.Errorf("%s %s documents inputs it doesn't read", method, path)
+				}
+				return
+			}
+			s := sampler{spec: spec, typ: fi.RequestType}
+			for _, sample := range s.requests(t, method, route, op) {
+				bound := bind(t, method, route, fi.RequestType, sample.req)
+				if sample.undocumented {
+					checkIgnored(t, bound)
+					continue
+				}
+				checkBound(t, bound, sample.values)
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if routes == 0 {
+		t.Fatal("no routes")
+	}
+}
+
+// bind binds req to a new value of the request type t with the router's binder
+func bind(t *testing.T, method, route string, typ reflect.Type, req *http.Request) reflect.Value {
+	t.Helper()
+	bound := reflect.New(typ)
+	r := chi.NewRouter()
+	r.MethodFunc(method, route, func(_ http.ResponseWriter, req *http.Request) {
+		if err := middleware.DefaultBinder.Bind(req, bound.Interface()); err != nil {
+			t.Errorf("%s request: bind: %v", req.Header.Get("Content-Type"), err)
+		}
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s %s isn't routed: %d", method, req.URL, w.Code)
+	}
+	return bound.Elem()
+}
+
+// checkBound checks that every field of v read from the request was bound,
+// and that the sampled values were bound
+func checkBound(t *testing.T, v reflect.Value, values []string) {
+	t.Helper()
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if !sf.IsExported() || !hasSourceTag(sf) {
+			continue
+		}
+		if v.Field(i).IsZero() {
+			t.Errorf("field %s isn't bound", sf.Name)
+		}
+	}
+
+	leaves := map[string]bool{}
+	collectLeaves(v, leaves)
+	for _, value := range values {
+		if !leaves[value] {
+			t.Errorf("value %q isn't bound to any field", value)
+		}
+	}
+}
+
+// checkIgnored checks that no field of v was bound from the undocumented body keys
+func checkIgnored(t *testing.T, v reflect.Value) {
+	t.Helper()
+	leaves := map[string]bool{}
+	collectLeaves(v, leaves)
+	if leaves[undocumented] {
+		t.Errorf("a body key left out of the spec was bound: %+v", v.Interface())
+	}
+}
+
+// undocumented is sent in JSON bodies under the keys the spec leaves out
+const undocumented = "undocumented"
+
+// undocumentedKeys returns the names of the fields of t read from other sources
+// than the JSON body, they must be ignored in a body documented by properties
+func undocumentedKeys(t reflect.Type, properties map[string]any) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		candidates := []string{sf.Name}
+		for _, tag := range []string{"uri", "query", "header", "cookie", "form", "file"} {
+			if name, _, _ := strings.Cut(sf.Tag.Get(tag), ","); name != "" {
+				candidates = append(candidates, name)
+			}
+		}
+		for _, key := range candidates {
+			documented := false
+			for name := range properties {
+				documented = documented || strings.EqualFold(name, key)
+			}
+			if !documented {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func hasSourceTag(sf reflect.StructField) bool {
+	for _, tag := range []string{"json", "uri", "query", "header", "cookie", "form", "file"} {
+		if name, ok := sf.Tag.Lookup(tag); ok && name != "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// collectLeaves adds the scalar values in v
+func collectLeaves(v reflect.Value, leaves map[string]bool) {
+	if s, ok := v.Interface().(fmt.Stringer); ok && v.Kind() != reflect.Ptr {
+		leaves[s.String()] = true
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectLeaves(v.Elem(), leaves)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				collectLeaves(v.Field(i), leaves)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectLeaves(v.Index(i), leaves)
+		}
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		leaves[fmt.Sprint(v.Interface())] = true
+	}
+}
+
+// sampler builds requests from the spec with a distinct value for each documented input
+type sampler struct {
+	spec map[string]any
+	// typ is the request type, its fields bound from other sources are sent in JSON bodies too
+	typ reflect.Type
+	n   int
+	// values are the distinct values sampled
+	values []string
+}
+
+// sampledRequest is a request and the values sampled for it
+type sampledRequest struct {
+	req    *http.Request
+	values []string
+	// undocumented is set for a JSON body carrying the keys of the other sources, without them
+	undocumented bool
+}
+
+// requests returns a request for each content type of the operation op
+func (s *sampler) requests(t *testing.T, method, route string, op map[string]any) []sampledRequest {
+	t.Helper()
+
+	path, query, header := route, url.Values{}, http.Header{}
+	var cookies []*http.Cookie
+	parameters, _ := op["parameters"].([]any)
+	for _, p := range parameters {
+		p := object(p)
+		name := p["name"].(string)
+		value := fmt.Sprint(s.sample(object(p["schema"])))
+		switch p["in"] {
+		case "path":
+			path = strings.Replace(path, "{"+name+"}", url.PathEscape(value), 1)
+		case "query":
+			query.Add(name, value)
+		case "header":
+			header.Add(name, value)
+		case "cookie":
+			cookies = append(cookies, &http.Cookie{Name: name, Value: value})
+		}
+	}
+	if security, _ := op["security"].([]any); len(security) > 0 {
+		header.Set("Authorization", "Bearer token")
+	}
+	pathOnly := path
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	// The parameters are in every request, the body values only in theirs
+	params := s.values
+	newRequest := func(contentType string, body []byte) sampledRequest {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		values := s.values
+		s.values = slices.Clone(params)
+		return sampledRequest{req: req, values: values}
+	}
+
+	body := object(op["requestBody"])
+	if body == nil {
+		return []sampledRequest{newRequest("", nil)}
+	}
+	var requests []sampledRequest
+	for contentType, mediaType := range object(body["content"]) {
+		schema := s.resolve(object(object(mediaType)["schema"]))
+		switch contentType {
+		case openapi.TypeJSON:
+			sample, _ := s.sample(schema).(map[string]any)
+			data, err := json.Marshal(sample)
+			if err != nil {
+				t.Fatal(err)
+			}
+			requests = append(requests, newRequest(contentType, data))
+
+			// The keys of the other sources are ignored in the body, also when their source is empty
+			for _, key := range undocumentedKeys(s.typ, object(schema["properties"])) {
+				sample[key] = undocumented
+			}
+			data, err = json.Marshal(sample)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(method, pathOnly, bytes.NewReader(data))
+			req.Header.Set("Content-Type", contentType)
+			requests = append(requests, sampledRequest{req: req, undocumented: true})
+		case openapi.TypeFormURLEncoded:
+			form := url.Values{}
+			for name, prop := range object(schema["properties"]) {
+				form.Set(name, fmt.Sprint(s.sample(object(prop))))
+			}
+			requests = append(requests, newRequest(contentType, []byte(form.Encode())))
+		case openapi.TypeMultipart:
+			var buf bytes.Buffer
+			w := multipart.NewWriter(&buf)
+			for name, prop := range object(schema["properties"]) {
+				prop := object(prop)
+				if items := object(prop["items"]); items != nil {
+					prop = items
+				}
+				if prop["format"] == "binary" {
+					part, _ := w.CreateFormFile(name, name+".txt")
+					part.Write([]byte("hello"))
+					continue
+				}
+				w.WriteField(name, fmt.Sprint(s.sample(prop)))
+			}
+			w.Close()
+			requests = append(requests, newRequest(w.FormDataContentType(), buf.Bytes()))
+		default:
+			t.Errorf("unexpected content type %s", contentType)
+		}
+	}
+	return requests
+}
+
+// sample returns a value valid for schema, distinct values are recorded
+func (s *sampler) sample(schema map[string]any) any {
+	schema = s.resolve(schema)
+	if alternatives, ok := schema["anyOf"].([]any); ok {
+		return s.sample(object(alternatives[0]))
+	}
+	if value, ok := schema["const"]; ok {
+		return value
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		return enum[0]
+	}
+
+	typ, _ := schema["type"].(string)
+	if types, ok := schema["type"].([]any); ok {
+		typ = types[0].(string)
+	}
+	switch typ {
+	case "string":
+		format, _ := schema["format"].(string)
+		return s.string(format)
+	case "integer", "number":
+		s.n++
+		if maximum, ok := schema["maximum"].(float64); ok && float64(s.n) > maximum {
+			return maximum
+		}
+		s.values = append(s.values, fmt.Sprint(s.n))
+		return s.n
+	case "boolean":
+		return true
+	case "array":
+		return []any{s.sample(object(schema["items"]))}
+	default:
+		obj := map[string]any{}
+		for name, prop := range object(schema["properties"]) {
+			obj[name] = s.sample(object(prop))
+		}
+		return obj
+	}
+}
+
+// string returns a distinct string in format
+func (s *sampler) string(format string) string {
+	s.n++
+	var value string
+	switch format {
+	case "uuid":
+		value = uuid.NewString()
+	case "email":
+		value = fmt.Sprintf("user%d@example.com", s.n)
+	case "date-time":
+		value = time.Date(2025, 1, 1, 0, 0, s.n, 0, time.UTC).Format(time.RFC3339)
+	default:
+		value = fmt.Sprintf("value%d", s.n)
+	}
+	s.values = append(s.values, value)
+	return value
+}
+
+// resolve follows a reference to a component schema
+func (s *sampler) resolve(schema map[string]any) map[string]any {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		return object(object(object(s.spec["components"])["schemas"])[name])
+	}
+	return schema
+}
+
+func object(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
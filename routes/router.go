@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	"github.com/go-chi/httplog/v2"
+	"github.com/wangfenjin/mojito/app"
+	"github.com/wangfenjin/mojito/common"
+)
+
+// NewRouter creates the HTTP handler serving a, with the request middleware and
+// all routes. The test routes are mounted outside production.
+func NewRouter(a *app.App, logger *httplog.Logger) http.Handler {
+	cfg := a.Config
+
+	r := chi.NewRouter()
+
+	// Add middleware
+	r.Use(chimw.RequestID)
+	r.Use(httplog.RequestLogger(logger))
+	// r.Use(middleware.Heartbeat("/ping"))
+
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   cfg.Server.AllowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: true,
+		MaxAge:           300,
+	}))
+
+	// Set up API routes
+	RegisterRoutes(r, a)
+	if !common.IsProduction() {
+		RegisterTestRoutes(r)
+	}
+	return r
+}
@@ -2,16 +2,18 @@ package routes
 
 import (
 	"github.com/go-chi/chi/v5"
-	"github.com/wangfenjin/mojito/openapi"
+	"github.com/wangfenjin/mojito/app"
 )
 
-// RegisterRoutes registers all application routes
-func RegisterRoutes(r chi.Router) {
-	RegisterUtilRoutes(r)
-	RegisterLoginRoutes(r)
-	RegisterUsersRoutes(r)
-	RegisterItemsRoutes(r)
-	RegisterDocsRoutes(r)
+// RegisterRoutes registers all application routes. Handlers get their dependencies from a.
+func RegisterRoutes(r chi.Router, a *app.App) {
+	r.Use(app.Inject(a))
 
-	openapi.RegisterMws(r)
+	RegisterHealthRoutes(r)
+	RegisterUtilRoutes(r, a)
+	RegisterLoginRoutes(r, a)
+	RegisterUsersRoutes(r, a)
+	RegisterItemsRoutes(r, a)
+	RegisterAdminRoutes(r, a)
+	RegisterDocsRoutes(r)
 }
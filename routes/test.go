@@ -3,65 +3,70 @@ package routes
 import (
 	"context"
 	"fmt"
-	"os"
+	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
-	"github.com/wangfenjin/mojito/common"
+	"github.com/wangfenjin/mojito/app"
 	"github.com/wangfenjin/mojito/middleware"
-	"github.com/wangfenjin/mojito/models"
 	"github.com/wangfenjin/mojito/models/gen"
 )
 
-// RegisterTestRoutes registers test-related routes
+// RegisterTestRoutes registers test-related routes, call it after RegisterRoutes
 func RegisterTestRoutes(r chi.Router) {
 	r.Route("/api/v1/test", func(r chi.Router) {
-		r.Delete("/cleanup", middleware.WithHandler(cleanupHandler))
-		r.Get("/shutdown", middleware.WithHandler(shutdownHandler))
-		r.Post("/superuser", middleware.WithHandler(createSuperUserHandler))
+		r.Method(http.MethodDelete, "/cleanup", middleware.WithHandler(cleanupHandler))
+		r.Method(http.MethodGet, "/shutdown", middleware.WithHandler(shutdownHandler))
+		r.Method(http.MethodPost, "/superuser", middleware.WithHandler(createSuperUserHandler))
 	})
 }
 
 // EmptyRequest represents an empty request
 type EmptyRequest struct{}
 
-// CreateSuperUserRequest represents the request body for creating a super user
+// CreateSuperUserRequest represents the request body for creating a super user,
+// the password length is checked against the configured password policy
 type CreateSuperUserRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 	FullName string `json:"full_name" binding:"required"`
 }
 
 func createSuperUserHandler(ctx context.Context, req CreateSuperUserRequest) (*MessageResponse, error) {
-	db := models.GetDB()
+	a := app.From(ctx)
+	if err := checkPassword(ctx, "password", req.Password); err != nil {
+		return nil, err
+	}
 
-	hashedPassword, err := common.HashPassword(req.Password)
+	hashedPassword, err := a.Passwords.Hash(req.Password)
 	if err != nil {
 		return nil, fmt.Errorf("error hashing password: %w", err)
 	}
 
-	if err := db.WithTx(ctx, func(q *gen.Queries) error {
+	if err := a.Store.WithTx(ctx, func(q gen.Querier) error {
 		// Check if email already exists
 		exists, err := q.IsUserEmailExists(ctx, req.Email)
 		if err != nil {
 			return fmt.Errorf("error checking email existence: %w", err)
 		}
 		if exists {
-			return middleware.NewBadRequestError("email already exists")
+			return middleware.NewConflictError("email already exists").WithCode(ErrCodeUserEmailTaken)
 		}
 
-		// Create super user
+		// Create super user, its email is trusted without verification
 		_, err = q.CreateUser(ctx, gen.CreateUserParams{
-			ID:             uuid.New(),
-			Email:          req.Email,
-			HashedPassword: hashedPassword,
-			IsActive:       true,
-			IsSuperuser:    true,
-			FullName:       pgtype.Text{String: req.FullName, Valid: true},
+			ID:              uuid.New(),
+			Email:           req.Email,
+			HashedPassword:  hashedPassword,
+			IsActive:        true,
+			IsSuperuser:     true,
+			FullName:        pgtype.Text{String: req.FullName, Valid: true},
+			EmailVerifiedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
 		})
 		if err != nil {
-			return fmt.Errorf("error creating super user: %w", err)
+			return fmt.Errorf("error creating super user: %w", emailTaken(err))
 		}
 		return nil
 	}); err != nil {
@@ -73,17 +78,18 @@ func createSuperUserHandler(ctx context.Context, req CreateSuperUserRequest) (*M
 	}, nil
 }
 
-func shutdownHandler(_ context.Context, _ EmptyRequest) (*MessageResponse, error) {
-	defer os.Exit(0)
+// shutdownHandler stops the server gracefully, in-flight requests including this one finish first
+func shutdownHandler(ctx context.Context, _ EmptyRequest) (*MessageResponse, error) {
+	app.From(ctx).Stop()
 	return &MessageResponse{
 		Message: "server shutting down",
 	}, nil
 }
 
 func cleanupHandler(ctx context.Context, _ EmptyRequest) (*MessageResponse, error) {
-	db := models.GetDB()
+	a := app.From(ctx)
 
-	if err := db.WithTx(ctx, func(q *gen.Queries) error {
+	if err := a.Store.WithTx(ctx, func(q gen.Querier) error {
 		if err := q.CleanupItems(ctx); err != nil {
 			return fmt.Errorf("error deleting items: %w", err)
 		}
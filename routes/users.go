@@ -2,42 +2,51 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/wangfenjin/mojito/app"
 	"github.com/wangfenjin/mojito/common"
 	"github.com/wangfenjin/mojito/middleware"
-	"github.com/wangfenjin/mojito/models"
 	"github.com/wangfenjin/mojito/models/gen"
+	"github.com/wangfenjin/mojito/outbox"
 )
 
 // RegisterUsersRoutes registers all user related routes
-func RegisterUsersRoutes(r chi.Router) {
+func RegisterUsersRoutes(r chi.Router, a *app.App) {
 	// Protected routes (require auth)
 	r.Route("/api/v1/users", func(r chi.Router) {
 		// Apply auth middleware to all routes in this group
-		r.Use(middleware.RequireAuth())
-
-		r.Get("/", middleware.WithHandler(listUsersHandler))
-		r.Get("/me", middleware.WithHandler(getCurrentUserHandler))
-		r.Delete("/me", middleware.WithHandler(deleteCurrentUserHandler))
-		r.Patch("/me", middleware.WithHandler(updateCurrentUserHandler))
-		r.Patch("/me/password", middleware.WithHandler(updatePasswordHandler))
-		r.Get("/{id}", middleware.WithHandler(getUserHandler))
-		r.Patch("/{id}", middleware.WithHandler(updateUserHandler))
+		r.Use(a.RequireAuth())
+
+		r.Method(http.MethodGet, "/", middleware.WithHandler(listUsersHandler))
+		r.Method(http.MethodGet, "/me", middleware.WithHandler(getCurrentUserHandler))
+		r.Method(http.MethodDelete, "/me", middleware.WithHandler(deleteCurrentUserHandler))
+		r.Method(http.MethodPatch, "/me", middleware.WithHandler(updateCurrentUserHandler))
+		r.Method(http.MethodPatch, "/me/password", middleware.WithHandler(updatePasswordHandler))
+		r.Method(http.MethodPost, "/me/sign-out", middleware.WithHandler(signOutCurrentUserHandler))
+		r.Method(http.MethodGet, "/{id}", middleware.WithHandler(getUserHandler))
+		r.Method(http.MethodPatch, "/{id}", middleware.WithHandler(updateUserHandler))
+		r.Method(http.MethodPost, "/{id}/sign-out", middleware.WithHandler(signOutUserHandler))
 	})
 
 	// Public routes (no auth required)
-	r.Post("/api/v1/users/signup", middleware.WithHandler(registerUserHandler))
+	r.Method(http.MethodPost, "/api/v1/users/signup", middleware.WithHandler(registerUserHandler))
+	r.Method(http.MethodPost, "/api/v1/users/verify-email", middleware.WithHandler(verifyEmailHandler))
+	r.Method(http.MethodPost, "/api/v1/users/resend-verification", middleware.WithHandler(resendVerificationHandler))
 }
 
-// CreateUserRequest represents the request body for creating a user
+// CreateUserRequest represents the request body for creating a user,
+// the password length is checked against the configured password policy
 type CreateUserRequest struct {
 	Email       string `json:"email" binding:"required,email"`
-	Password    string `json:"password" binding:"required,min=8"`
+	Password    string `json:"password" binding:"required"`
 	FullName    string `json:"full_name" binding:"required"`
 	IsActive    bool   `json:"is_active"`
 	IsSuperuser bool   `json:"is_superuser"`
@@ -52,17 +61,32 @@ type UpdateUserRequest struct {
 	IsSuperuser *bool   `json:"is_superuser" binding:"omitempty"`
 }
 
-// RegisterUserRequest represents the request body for user registration
+// RegisterUserRequest represents the request body for user registration,
+// the password length is checked against the configured password policy
 type RegisterUserRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 	FullName string `json:"full_name" binding:"required"`
+	Locale   string `header:"Accept-Language"`
 }
 
-// UpdateUserMeRequest represents the request body for updating the current user
+// UpdateUserMeRequest represents the request body for updating the current user.
+// A new email is only applied once it has been verified.
 type UpdateUserMeRequest struct {
 	Email    string `json:"email" binding:"omitempty,email"`
 	FullName string `json:"full_name"`
+	Locale   string `header:"Accept-Language"`
+}
+
+// VerifyEmailRequest represents the request body for verifying an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResendVerificationRequest represents the request body for resending the verification email
+type ResendVerificationRequest struct {
+	Email  string `json:"email" binding:"required,email"`
+	Locale string `header:"Accept-Language"`
 }
 
 // GetUserRequest represents the request parameters for getting a user
@@ -76,15 +100,18 @@ type ListUsersRequest struct {
 	Limit int64 `form:"limit" binding:"min=1,max=100" default:"10"`
 }
 
-// UserResponse represents the standard user response format
+// UserResponse represents the standard user response format.
+// PendingEmail is the new address waiting for verification after an email change.
 type UserResponse struct {
-	ID          uuid.UUID `json:"id"`
-	Email       string    `json:"email"`
-	FullName    string    `json:"full_name"`
-	IsActive    bool      `json:"is_active"`
-	IsSuperuser bool      `json:"is_superuser"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID            uuid.UUID `json:"id"`
+	Email         string    `json:"email"`
+	FullName      string    `json:"full_name"`
+	IsActive      bool      `json:"is_active"`
+	IsSuperuser   bool      `json:"is_superuser"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
 }
 
 // UsersResponse represents a paginated list of users
@@ -96,199 +123,402 @@ type UsersResponse struct {
 	} `json:"meta"`
 }
 
-// UpdatePasswordRequest represents the request body for updating a password
+// UpdatePasswordRequest represents the request body for updating a password,
+// the new password length is checked against the configured password policy
 type UpdatePasswordRequest struct {
 	CurrentPassword string `json:"current_password" binding:"required"`
 	NewPassword     string `json:"new_password" binding:"required"`
 }
 
+// resendVerificationMessage is returned for every resend request, whether or not the account exists
+const resendVerificationMessage = "if the account exists and is not verified, a verification email has been sent"
+
 // Add new handlers
 func deleteCurrentUserHandler(ctx context.Context, _ any) (*MessageResponse, error) {
 	// Get current user ID from context
 	claims := ctx.Value("claims").(*common.Claims)
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	id, err := uuid.Parse(claims.UserID)
 	if err != nil {
 		return nil, middleware.NewBadRequestError("invalid user ID")
 	}
 
-	err = db.DeleteUser(ctx, id)
+	// Deactivating the user also bumps its token version, revoking issued tokens
+	err = a.Store.WithTx(ctx, func(q gen.Querier) error {
+		if err := q.DeleteUser(ctx, id); err != nil {
+			return err
+		}
+		return q.RevokeUserRefreshTokens(ctx, id)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error deleting user: %w", err)
 	}
 	return &MessageResponse{Message: "User deleted successfully"}, nil
 }
 
+// @error 400 user.incorrect_password
 func updatePasswordHandler(ctx context.Context, req UpdatePasswordRequest) (*MessageResponse, error) {
 	claims := ctx.Value("claims").(*common.Claims)
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	id, err := uuid.Parse(claims.UserID)
 	if err != nil {
 		return nil, middleware.NewBadRequestError("invalid user ID")
 	}
+	if err := checkPassword(ctx, "new_password", req.NewPassword); err != nil {
+		return nil, err
+	}
 
 	// Get user with current password hash from DB
-	user, err := db.GetUserByID(ctx, id)
+	user, err := a.Users.GetUserByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("error getting user: %w", err)
+		return nil, fmt.Errorf("error getting user: %w", notFound(err, ErrCodeUserNotFound, "user not found"))
 	}
 
 	// Verify current password against stored hash
 	if !common.CheckPasswordHash(req.CurrentPassword, user.HashedPassword) {
-		return nil, middleware.NewBadRequestError("incorrect current password")
+		return nil, middleware.NewBadRequestError("incorrect current password").WithCode(ErrCodeIncorrectPassword)
 	}
 
 	// Hash the new password
-	hashedNewPassword, err := common.HashPassword(req.NewPassword)
+	hashedNewPassword, err := a.Passwords.Hash(req.NewPassword)
 	if err != nil {
 		return nil, fmt.Errorf("error hashing password: %w", err)
 	}
 
-	// Update with new password hash
-	user, err = db.UpdateUser(ctx, gen.UpdateUserParams{
-		ID:             user.ID,
-		HashedPassword: pgtype.Text{String: hashedNewPassword, Valid: true},
+	// Update with new password hash and invalidate tokens issued with the old password
+	err = a.Store.WithTx(ctx, func(q gen.Querier) error {
+		if _, err := q.UpdateUser(ctx, gen.UpdateUserParams{
+			ID:             user.ID,
+			HashedPassword: pgtype.Text{String: hashedNewPassword, Valid: true},
+		}); err != nil {
+			return err
+		}
+		return revokeUserTokens(ctx, q, user.ID)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error updating password: %w", err)
 	}
 
-	// TODO: invalid token after password update
-
 	return &MessageResponse{
 		Message: "Password updated successfully",
 	}, nil
 }
 
 // Update handler functions
+// @error 409 user.email_taken
 func registerUserHandler(ctx context.Context, req RegisterUserRequest) (*UserResponse, error) {
-	db := models.GetDB()
+	a := app.From(ctx)
+	if err := checkPassword(ctx, "password", req.Password); err != nil {
+		return nil, err
+	}
 	// Check if user with this email already exists
-	exists, err := db.IsUserEmailExists(ctx, req.Email)
+	exists, err := a.Users.IsUserEmailExists(ctx, req.Email)
 	if err != nil {
 		return nil, fmt.Errorf("error checking existing user: %w", err)
 	}
 	if exists {
-		return nil, middleware.NewBadRequestError("user with this email already exists")
+		return nil, middleware.NewConflictError("user with this email already exists").WithCode(ErrCodeUserEmailTaken)
 	}
-	hashPassword, err := common.HashPassword(req.Password)
+	hashPassword, err := a.Passwords.Hash(req.Password)
 	if err != nil {
 		return nil, fmt.Errorf("error hashing password: %w", err)
 	}
-	user, err := db.CreateUser(ctx, gen.CreateUserParams{
-		ID:             uuid.New(),
-		Email:          req.Email,
-		HashedPassword: hashPassword,
-		FullName:       pgtype.Text{String: req.FullName, Valid: true},
-		IsActive:       true,
-		IsSuperuser:    false,
+
+	// Create the user together with its verification email
+	ttl := a.Tokens.VerificationTTL()
+	var user gen.User
+	err = a.Store.WithTx(ctx, func(q gen.Querier) error {
+		var err error
+		user, err = q.CreateUser(ctx, gen.CreateUserParams{
+			ID:             uuid.New(),
+			Email:          req.Email,
+			HashedPassword: hashPassword,
+			FullName:       pgtype.Text{String: req.FullName, Valid: true},
+			IsActive:       true,
+			IsSuperuser:    false,
+		})
+		if err != nil {
+			return fmt.Errorf("error creating user: %w", emailTaken(err))
+		}
+		return enqueueVerificationEmail(ctx, a, q, user, user.Email, ttl, req.Locale)
 	})
 	if err != nil {
-		return nil, fmt.Errorf("error creating user: %w", err)
+		return nil, err
 	}
+
 	return &UserResponse{
-		ID:          user.ID,
-		Email:       user.Email,
-		FullName:    user.FullName.String,
-		IsActive:    user.IsActive,
-		IsSuperuser: user.IsSuperuser,
-		CreatedAt:   user.CreatedAt.Time,
-		UpdatedAt:   user.UpdatedAt.Time,
+		ID:            user.ID,
+		Email:         user.Email,
+		FullName:      user.FullName.String,
+		IsActive:      user.IsActive,
+		IsSuperuser:   user.IsSuperuser,
+		CreatedAt:     user.CreatedAt.Time,
+		UpdatedAt:     user.UpdatedAt.Time,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	}, nil
 }
 
-// Update response maps in other handlers to include phone_number
+// Update the current user. A changed email is not written directly, a verification
+// link is sent to the new address and the change is applied once it is opened.
+// @error 409 user.email_taken
 func updateCurrentUserHandler(ctx context.Context, req UpdateUserMeRequest) (*UserResponse, error) {
 	claims := ctx.Value("claims").(*common.Claims)
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	id, err := uuid.Parse(claims.UserID)
 	if err != nil {
 		return nil, middleware.NewBadRequestError("invalid user ID")
 	}
 
-	user, err := db.UpdateUser(ctx, gen.UpdateUserParams{
-		ID:       id,
-		FullName: pgtype.Text{String: req.FullName, Valid: true},
+	ttl := a.Tokens.VerificationTTL()
+	var user gen.User
+	var pendingEmail string
+	err = a.Store.WithTx(ctx, func(q gen.Querier) error {
+		var err error
+		user, err = q.UpdateUser(ctx, gen.UpdateUserParams{
+			ID:       id,
+			FullName: pgtype.Text{String: req.FullName, Valid: req.FullName != ""},
+		})
+		if err != nil {
+			return notFound(err, ErrCodeUserNotFound, "user not found")
+		}
+		if req.Email == "" || req.Email == user.Email {
+			return nil
+		}
+
+		exists, err := q.IsUserEmailExists(ctx, req.Email)
+		if err != nil {
+			return fmt.Errorf("error checking email existence: %w", err)
+		}
+		if exists {
+			return middleware.NewConflictError("user with this email already exists").WithCode(ErrCodeUserEmailTaken)
+		}
+		pendingEmail = req.Email
+		return enqueueVerificationEmail(ctx, a, q, user, pendingEmail, ttl, req.Locale)
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error updating user: %w", err)
 	}
 
 	return &UserResponse{
-		ID:          user.ID,
-		Email:       user.Email,
-		FullName:    user.FullName.String,
-		IsActive:    user.IsActive,
-		IsSuperuser: user.IsSuperuser,
-		CreatedAt:   user.CreatedAt.Time,
-		UpdatedAt:   user.UpdatedAt.Time,
+		ID:            user.ID,
+		Email:         user.Email,
+		FullName:      user.FullName.String,
+		IsActive:      user.IsActive,
+		IsSuperuser:   user.IsSuperuser,
+		CreatedAt:     user.CreatedAt.Time,
+		UpdatedAt:     user.UpdatedAt.Time,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  pendingEmail,
 	}, nil
 }
 
+// Verify an email address with the token from the verification email.
+// Tokens sent after an email change also switch the user to the new address.
+// @summary Verify email
+// @tag users
+// @error 400 auth.invalid_verification_token
+// @error 409 user.email_taken
+func verifyEmailHandler(ctx context.Context, req VerifyEmailRequest) (*MessageResponse, error) {
+	invalidToken := middleware.NewBadRequestError("invalid or expired verification token").WithCode(ErrCodeInvalidVerifyToken)
+
+	a := app.From(ctx)
+	tokens := a.Tokens
+	purpose := tokenPurposeEmailVerification
+	hash, err := tokens.VerifyActionToken(purpose, req.Token)
+	if err != nil {
+		purpose = tokenPurposeEmailChange
+		if hash, err = tokens.VerifyActionToken(purpose, req.Token); err != nil {
+			return nil, invalidToken
+		}
+	}
+
+	var user gen.User
+	err = a.Store.WithTx(ctx, func(q gen.Querier) error {
+		token, err := q.GetUserTokenByHash(ctx, gen.GetUserTokenByHashParams{
+			TokenHash: hash,
+			Purpose:   purpose,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return invalidToken
+		}
+		if err != nil {
+			return fmt.Errorf("error getting verification token: %w", err)
+		}
+		if token.UsedAt.Valid || time.Now().After(token.ExpiresAt.Time) {
+			return invalidToken
+		}
+
+		user, err = q.GetUserByID(ctx, token.UserID)
+		if err != nil {
+			return fmt.Errorf("error getting user: %w", err)
+		}
+		if !user.IsActive {
+			return invalidToken
+		}
+
+		used, err := q.MarkUserTokenUsed(ctx, token.ID)
+		if err != nil {
+			return fmt.Errorf("error revoking verification token: %w", err)
+		}
+		if used == 0 {
+			return invalidToken
+		}
+
+		if token.NewEmail.Valid {
+			user, err = q.ChangeUserEmail(ctx, gen.ChangeUserEmailParams{
+				ID:    user.ID,
+				Email: token.NewEmail.String,
+			})
+			if err != nil {
+				// The address may have been taken since the change was requested
+				return fmt.Errorf("error changing email: %w", emailTaken(err))
+			}
+			return nil
+		}
+		firstVerification := !user.EmailVerifiedAt.Valid
+		user, err = q.MarkUserEmailVerified(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("error verifying email: %w", err)
+		}
+		if !firstVerification {
+			return nil
+		}
+		msg, err := a.Sender.WelcomeMessage(user.Email, user.FullName.String, "")
+		if err != nil {
+			return fmt.Errorf("error rendering welcome email: %w", err)
+		}
+		return outbox.EnqueueEmail(ctx, q, msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MessageResponse{
+		Message: "email verified",
+	}, nil
+}
+
+// Send a new verification email. The response is the same whether or not the
+// account exists, so the endpoint can't be used to enumerate users.
+// @summary Resend verification email
+// @tag users
+func resendVerificationHandler(ctx context.Context, req ResendVerificationRequest) (*MessageResponse, error) {
+	a := app.From(ctx)
+	resp := &MessageResponse{
+		Message: resendVerificationMessage,
+	}
+
+	user, err := a.Users.GetUserByEmail(ctx, req.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return resp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+	if !user.IsActive || user.EmailVerifiedAt.Valid {
+		return resp, nil
+	}
+
+	ttl := a.Tokens.VerificationTTL()
+	err = a.Store.WithTx(ctx, func(q gen.Querier) error {
+		return enqueueVerificationEmail(ctx, a, q, user, user.Email, ttl, req.Locale)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// enqueueVerificationEmail issues a verification token for address and queues the email with
+// the link in the outbox. Verifying an address other than the user's current one changes the email.
+func enqueueVerificationEmail(ctx context.Context, a *app.App, q gen.Querier, user gen.User, address string, ttl time.Duration, locale string) error {
+	purpose, newEmail := tokenPurposeEmailVerification, ""
+	if address != user.Email {
+		purpose, newEmail = tokenPurposeEmailChange, address
+	}
+	token, err := issueUserToken(ctx, a.Tokens, q, user.ID, purpose, ttl, newEmail)
+	if err != nil {
+		return err
+	}
+	msg, err := a.Sender.VerificationMessage(address, user.FullName.String, token, ttl, locale)
+	if err != nil {
+		return fmt.Errorf("error rendering verification email: %w", err)
+	}
+	return outbox.EnqueueEmail(ctx, q, msg)
+}
+
 // Update getCurrentUserHandler response
 func getCurrentUserHandler(ctx context.Context, _ any) (*UserResponse, error) {
 	claims := ctx.Value("claims").(*common.Claims)
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	id, err := uuid.Parse(claims.UserID)
 	if err != nil {
 		return nil, middleware.NewBadRequestError("invalid user ID")
 	}
-	user, err := db.GetUserByID(ctx, id)
+	user, err := a.Users.GetUserByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("error getting user: %w", err)
+		return nil, fmt.Errorf("error getting user: %w", notFound(err, ErrCodeUserNotFound, "user not found"))
 	}
 
 	return &UserResponse{
-		ID:          user.ID,
-		Email:       user.Email,
-		FullName:    user.FullName.String,
-		IsActive:    user.IsActive,
-		IsSuperuser: user.IsSuperuser,
-		CreatedAt:   user.CreatedAt.Time,
-		UpdatedAt:   user.UpdatedAt.Time,
+		ID:            user.ID,
+		Email:         user.Email,
+		FullName:      user.FullName.String,
+		IsActive:      user.IsActive,
+		IsSuperuser:   user.IsSuperuser,
+		CreatedAt:     user.CreatedAt.Time,
+		UpdatedAt:     user.UpdatedAt.Time,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	}, nil
 }
 
 // Update getUserHandler response
+// @error 403 auth.superuser_required
+// @error 404 user.not_found
 func getUserHandler(ctx context.Context, req GetUserRequest) (*UserResponse, error) {
 	claims := ctx.Value("claims").(*common.Claims)
 	if !claims.IsSuperUser {
-		return nil, middleware.NewForbiddenError("only superusers can get other users")
+		return nil, middleware.NewForbiddenError("only superusers can get other users").WithCode(ErrCodeSuperuserRequired)
 	}
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	id, err := uuid.Parse(req.ID)
 	if err != nil {
 		return nil, middleware.NewBadRequestError("invalid user ID format")
 	}
 
-	user, err := db.GetUserByID(ctx, id)
+	user, err := a.Users.GetUserByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("error getting user: %w", err)
+		return nil, fmt.Errorf("error getting user: %w", notFound(err, ErrCodeUserNotFound, "user not found"))
 	}
 
 	return &UserResponse{
-		ID:          user.ID,
-		Email:       user.Email,
-		FullName:    user.FullName.String,
-		IsActive:    user.IsActive,
-		IsSuperuser: user.IsSuperuser,
-		CreatedAt:   user.CreatedAt.Time,
-		UpdatedAt:   user.UpdatedAt.Time,
+		ID:            user.ID,
+		Email:         user.Email,
+		FullName:      user.FullName.String,
+		IsActive:      user.IsActive,
+		IsSuperuser:   user.IsSuperuser,
+		CreatedAt:     user.CreatedAt.Time,
+		UpdatedAt:     user.UpdatedAt.Time,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	}, nil
 }
 
-// Update updateUserHandler to handle phone number
+// Update a user. As for the current user, a changed email is not written directly:
+// a verification link is sent to the new address and the change is applied once it is opened.
+// @error 403 auth.superuser_required
+// @error 404 user.not_found
+// @error 409 user.email_taken
 func updateUserHandler(ctx context.Context, req UpdateUserRequest) (*UserResponse, error) {
 	claims := ctx.Value("claims").(*common.Claims)
 	if !claims.IsSuperUser {
-		return nil, middleware.NewForbiddenError("only superusers can update other users")
+		return nil, middleware.NewForbiddenError("only superusers can update other users").WithCode(ErrCodeSuperuserRequired)
 	}
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	id, err := uuid.Parse(req.ID)
 	if err != nil {
@@ -301,39 +531,66 @@ func updateUserHandler(ctx context.Context, req UpdateUserRequest) (*UserRespons
 	if req.FullName != nil {
 		params.FullName = pgtype.Text{String: *req.FullName, Valid: true}
 	}
-	if req.Email != nil {
-		params.Email = pgtype.Text{String: *req.Email, Valid: true}
-	}
 	if req.IsActive != nil {
 		params.IsActive = pgtype.Bool{Bool: *req.IsActive, Valid: true}
 	}
 	if req.IsSuperuser != nil {
 		params.IsSuperuser = pgtype.Bool{Bool: *req.IsSuperuser, Valid: true}
 	}
-	// Save updates
-	user, err := db.UpdateUser(ctx, params)
+	// Save updates, deactivated users are signed out everywhere
+	ttl := a.Tokens.VerificationTTL()
+	var user gen.User
+	var pendingEmail string
+	err = a.Store.WithTx(ctx, func(q gen.Querier) error {
+		var err error
+		user, err = q.UpdateUser(ctx, params)
+		if err != nil {
+			return notFound(err, ErrCodeUserNotFound, "user not found")
+		}
+		if req.IsActive != nil && !*req.IsActive {
+			if err := revokeUserTokens(ctx, q, user.ID); err != nil {
+				return err
+			}
+		}
+		if req.Email == nil || *req.Email == user.Email {
+			return nil
+		}
+
+		exists, err := q.IsUserEmailExists(ctx, *req.Email)
+		if err != nil {
+			return fmt.Errorf("error checking email existence: %w", err)
+		}
+		if exists {
+			return middleware.NewConflictError("user with this email already exists").WithCode(ErrCodeUserEmailTaken)
+		}
+		pendingEmail = *req.Email
+		return enqueueVerificationEmail(ctx, a, q, user, pendingEmail, ttl, "")
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error updating user: %w", err)
 	}
 
 	return &UserResponse{
-		ID:          user.ID,
-		Email:       user.Email,
-		FullName:    user.FullName.String,
-		IsActive:    user.IsActive,
-		IsSuperuser: user.IsSuperuser,
-		CreatedAt:   user.CreatedAt.Time,
-		UpdatedAt:   user.UpdatedAt.Time,
+		ID:            user.ID,
+		Email:         user.Email,
+		FullName:      user.FullName.String,
+		IsActive:      user.IsActive,
+		IsSuperuser:   user.IsSuperuser,
+		CreatedAt:     user.CreatedAt.Time,
+		UpdatedAt:     user.UpdatedAt.Time,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  pendingEmail,
 	}, nil
 }
 
 // Update listUsersHandler response
+// @error 403 auth.superuser_required
 func listUsersHandler(ctx context.Context, req ListUsersRequest) (*UsersResponse, error) {
 	claims := ctx.Value("claims").(*common.Claims)
 	if !claims.IsSuperUser {
-		return nil, middleware.NewForbiddenError("only superusers can list users")
+		return nil, middleware.NewForbiddenError("only superusers can list users").WithCode(ErrCodeSuperuserRequired)
 	}
-	db := models.GetDB()
+	a := app.From(ctx)
 
 	// Set default values for pagination
 	if req.Limit <= 0 {
@@ -343,7 +600,7 @@ func listUsersHandler(ctx context.Context, req ListUsersRequest) (*UsersResponse
 		req.Skip = 0
 	}
 
-	users, err := db.ListUsers(ctx, gen.ListUsersParams{
+	users, err := a.Users.ListUsers(ctx, gen.ListUsersParams{
 		Limit:  req.Limit,
 		Offset: req.Skip,
 	})
@@ -355,13 +612,14 @@ func listUsersHandler(ctx context.Context, req ListUsersRequest) (*UsersResponse
 	userList := make([]UserResponse, len(users))
 	for i, user := range users {
 		userList[i] = UserResponse{
-			ID:          user.ID,
-			Email:       user.Email,
-			FullName:    user.FullName.String,
-			IsActive:    user.IsActive,
-			IsSuperuser: user.IsSuperuser,
-			CreatedAt:   user.CreatedAt.Time,
-			UpdatedAt:   user.UpdatedAt.Time,
+			ID:            user.ID,
+			Email:         user.Email,
+			FullName:      user.FullName.String,
+			IsActive:      user.IsActive,
+			IsSuperuser:   user.IsSuperuser,
+			CreatedAt:     user.CreatedAt.Time,
+			UpdatedAt:     user.UpdatedAt.Time,
+			EmailVerified: user.EmailVerifiedAt.Valid,
 		}
 	}
 
@@ -376,3 +634,59 @@ func listUsersHandler(ctx context.Context, req ListUsersRequest) (*UsersResponse
 		},
 	}, nil
 }
+
+// revokeUserTokens invalidates every access and refresh token issued to the user so far
+func revokeUserTokens(ctx context.Context, q gen.Querier, userID uuid.UUID) error {
+	if _, err := q.IncrementUserTokenVersion(ctx, userID); err != nil {
+		return fmt.Errorf("error revoking access tokens: %w", err)
+	}
+	if err := q.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// Sign the current user out on every device
+// @summary Sign out everywhere
+// @tag users
+func signOutCurrentUserHandler(ctx context.Context, _ any) (*MessageResponse, error) {
+	claims := ctx.Value("claims").(*common.Claims)
+	a := app.From(ctx)
+
+	id, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, middleware.NewBadRequestError("invalid user ID")
+	}
+
+	if err := a.Store.WithTx(ctx, func(q gen.Querier) error {
+		return revokeUserTokens(ctx, q, id)
+	}); err != nil {
+		return nil, err
+	}
+	return &MessageResponse{Message: "Signed out everywhere"}, nil
+}
+
+// Revoke every token of another user
+// @summary Sign user out everywhere
+// @tag users
+// @error 403 auth.superuser_required
+// @error 404 user.not_found
+func signOutUserHandler(ctx context.Context, req GetUserRequest) (*MessageResponse, error) {
+	claims := ctx.Value("claims").(*common.Claims)
+	if !claims.IsSuperUser {
+		return nil, middleware.NewForbiddenError("only superusers can sign out other users").WithCode(ErrCodeSuperuserRequired)
+	}
+	a := app.From(ctx)
+
+	id, err := uuid.Parse(req.ID)
+	if err != nil {
+		return nil, middleware.NewBadRequestError("invalid user ID format")
+	}
+
+	if err := a.Store.WithTx(ctx, func(q gen.Querier) error {
+		return revokeUserTokens(ctx, q, id)
+	}); err != nil {
+		return nil, notFound(err, ErrCodeUserNotFound, "user not found")
+	}
+	return &MessageResponse{Message: "User signed out everywhere"}, nil
+}
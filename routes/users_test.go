@@ -0,0 +1,243 @@
+package routes_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/wangfenjin/mojito/common"
+	"github.com/wangfenjin/mojito/middleware"
+	"github.com/wangfenjin/mojito/models/memory"
+	"github.com/wangfenjin/mojito/routes"
+	"github.com/wangfenjin/mojito/testutil"
+)
+
+func TestSignUp(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+
+	user := s.SignUp("test@example.com", "password123", "Test User")
+	if user.Email != "test@example.com" || user.FullName != "Test User" {
+		t.Errorf("user = %+v", user)
+	}
+	if !user.IsActive || user.IsSuperuser || user.EmailVerified {
+		t.Errorf("user flags = %+v, want active, not superuser and not verified", user)
+	}
+	if user.CreatedAt.IsZero() {
+		t.Error("created_at is missing")
+	}
+
+	s.Post("/api/v1/users/signup").JSON(map[string]string{
+		"email":     "test@example.com",
+		"password":  "password123",
+		"full_name": "Test User",
+	}).Do().Problem(http.StatusConflict, routes.ErrCodeUserEmailTaken)
+}
+
+// staleEmails is a store whose email checks miss existing users, as when an address
+// is taken between the check and the write
+type staleEmails struct {
+	*memory.Store
+}
+
+func (s staleEmails) IsUserEmailExists(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+func TestSignUpEmailTakenRace(t *testing.T) {
+	s := testutil.New(t, testutil.Options{Store: staleEmails{memory.New()}})
+	s.SignUp("test@example.com", "password123", "Test User")
+
+	s.Post("/api/v1/users/signup").JSON(map[string]string{
+		"email":     "test@example.com",
+		"password":  "password123",
+		"full_name": "Other User",
+	}).Do().Problem(http.StatusConflict, routes.ErrCodeUserEmailTaken)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	s.SignUp("test@example.com", "password123", "Test User")
+
+	s.Post("/api/v1/users/verify-email").JSON(routes.VerifyEmailRequest{
+		Token: "some-verification-token",
+	}).Do().Problem(http.StatusBadRequest, routes.ErrCodeInvalidVerifyToken)
+
+	// Resend returns the same response for unknown accounts
+	for _, address := range []string{"test@example.com", "nobody@example.com"} {
+		msg := testutil.Expect[routes.MessageResponse](s.Post("/api/v1/users/resend-verification").JSON(
+			routes.ResendVerificationRequest{Email: address}).Do(), http.StatusOK)
+		if msg.Message != "if the account exists and is not verified, a verification email has been sent" {
+			t.Errorf("%s: message = %q", address, msg.Message)
+		}
+	}
+
+	token := linkToken(t, s.LastEmail().Text, "/verify-email?token=")
+	s.Post("/api/v1/users/verify-email").JSON(routes.VerifyEmailRequest{Token: token}).Do().Status(http.StatusOK)
+
+	me := testutil.Expect[routes.UserResponse](
+		s.Get("/api/v1/users/me").Token(s.Token("test@example.com", "password123")).Do(), http.StatusOK)
+	if !me.EmailVerified {
+		t.Error("email isn't verified")
+	}
+}
+
+func TestUpdateMe(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	user := s.SignUp("test@example.com", "password123", "Test User")
+	token := s.Token("test@example.com", "password123")
+
+	me := testutil.Expect[routes.UserResponse](s.Get("/api/v1/users/me").Token(token).Do(), http.StatusOK)
+	if me.ID != user.ID || me.Email != "test@example.com" || me.FullName != "Test User" {
+		t.Errorf("me = %+v, want %+v", me, user)
+	}
+
+	// A normal user can't read other users
+	s.Get("/api/v1/users/" + user.ID.String()).Token(token).Do().Status(http.StatusForbidden)
+
+	me = testutil.Expect[routes.UserResponse](s.Patch("/api/v1/users/me").Token(token).JSON(map[string]string{
+		"full_name": "Updated User",
+	}).Do(), http.StatusOK)
+	if me.ID != user.ID || me.FullName != "Updated User" {
+		t.Errorf("updated me = %+v", me)
+	}
+
+	// Changing the email needs verification of the new address
+	me = testutil.Expect[routes.UserResponse](s.Patch("/api/v1/users/me").Token(token).JSON(map[string]string{
+		"email": "new-test@example.com",
+	}).Do(), http.StatusOK)
+	if me.Email != "test@example.com" || me.PendingEmail != "new-test@example.com" || me.FullName != "Updated User" {
+		t.Errorf("me after email change = %+v", me)
+	}
+}
+
+func TestUpdatePassword(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	s.SignUp("test@example.com", "password123", "Test User")
+	token := s.Token("test@example.com", "password123")
+
+	msg := testutil.Expect[routes.MessageResponse](s.Patch("/api/v1/users/me/password").Token(token).JSON(
+		routes.UpdatePasswordRequest{CurrentPassword: "password123", NewPassword: "newpassword123"},
+	).Do(), http.StatusOK)
+	if msg.Message != "Password updated successfully" {
+		t.Errorf("message = %q", msg.Message)
+	}
+
+	// Tokens issued before the password change are revoked
+	s.Get("/api/v1/users/me").Token(token).Do().Problem(http.StatusUnauthorized, middleware.CodeTokenRevoked)
+
+	token = s.Token("test@example.com", "newpassword123")
+	s.Get("/api/v1/users/me").Token(token).Do().Status(http.StatusOK)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	s := testutil.New(t, testutil.Options{Configure: func(cfg *common.Config) {
+		cfg.Auth.PasswordMinLength = 12
+	}})
+
+	signup := map[string]string{"email": "test@example.com", "password": "password123", "full_name": "Test User"}
+	problem := s.Post("/api/v1/users/signup").JSON(signup).Do().Problem(http.StatusUnprocessableEntity, middleware.CodeValidationFailed)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "password" || problem.Errors[0].Param != "12" {
+		t.Errorf("errors = %+v, want the configured minimum length of password", problem.Errors)
+	}
+
+	s.SignUp("test@example.com", "password1234", "Test User")
+	token := s.Token("test@example.com", "password1234")
+	problem = s.Patch("/api/v1/users/me/password").Token(token).JSON(
+		routes.UpdatePasswordRequest{CurrentPassword: "password1234", NewPassword: "password123"},
+	).Do().Problem(http.StatusUnprocessableEntity, middleware.CodeValidationFailed)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "new_password" {
+		t.Errorf("errors = %+v, want new_password", problem.Errors)
+	}
+	// The password is unchanged
+	s.Token("test@example.com", "password1234")
+
+	// The policy belongs to the application, one with the default policy doesn't change it
+	other := testutil.New(t, testutil.Options{})
+	other.SignUp("test@example.com", "password123", "Test User")
+	signup["email"] = "other@example.com"
+	s.Post("/api/v1/users/signup").JSON(signup).Do().Problem(http.StatusUnprocessableEntity, middleware.CodeValidationFailed)
+}
+
+func TestSuperuserManagesUsers(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	user, token := s.NewUser("test@example.com")
+
+	s.Get("/api/v1/users/").Token(token).Query("skip", "0").Query("limit", "10").Do().
+		Status(http.StatusForbidden)
+
+	admin := s.NewSuperuser("admin@example.com")
+	updated := testutil.Expect[routes.UserResponse](s.Patch("/api/v1/users/"+user.ID.String()).Token(admin).JSON(
+		map[string]string{"full_name": "Updated User By Admin"},
+	).Do(), http.StatusOK)
+	if updated.ID != user.ID || updated.FullName != "Updated User By Admin" {
+		t.Errorf("updated user = %+v", updated)
+	}
+
+	got := testutil.Expect[routes.UserResponse](
+		s.Get("/api/v1/users/"+user.ID.String()).Token(admin).Do(), http.StatusOK)
+	if got.Email != "test@example.com" || got.FullName != "Updated User By Admin" {
+		t.Errorf("user = %+v", got)
+	}
+
+	list := testutil.Expect[routes.UsersResponse](
+		s.Get("/api/v1/users/").Token(admin).Query("skip", "0").Query("limit", "10").Do(), http.StatusOK)
+	if len(list.Users) != 2 {
+		t.Errorf("listed %d users, want 2", len(list.Users))
+	}
+	if list.Meta.Skip != 0 || list.Meta.Limit != 10 {
+		t.Errorf("meta = %+v", list.Meta)
+	}
+}
+
+func TestSuperuserChangesEmail(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	user, token := s.NewUser("test@example.com")
+	s.Post("/api/v1/users/verify-email").JSON(routes.VerifyEmailRequest{
+		Token: linkToken(t, s.LastEmail().Text, "/verify-email?token="),
+	}).Do().Status(http.StatusOK)
+	admin := s.NewSuperuser("admin@example.com")
+
+	s.Patch("/api/v1/users/"+user.ID.String()).Token(admin).JSON(map[string]string{
+		"email": "admin@example.com",
+	}).Do().Problem(http.StatusConflict, routes.ErrCodeUserEmailTaken)
+
+	// The new address is only applied once it is verified
+	updated := testutil.Expect[routes.UserResponse](s.Patch("/api/v1/users/"+user.ID.String()).Token(admin).JSON(
+		map[string]string{"email": "new-test@example.com"},
+	).Do(), http.StatusOK)
+	if updated.Email != "test@example.com" || updated.PendingEmail != "new-test@example.com" || !updated.EmailVerified {
+		t.Errorf("updated user = %+v, want the verified address with a pending change", updated)
+	}
+	msg := s.LastEmail()
+	if len(msg.To) != 1 || msg.To[0] != "new-test@example.com" {
+		t.Fatalf("verification sent to %v, want the new address", msg.To)
+	}
+	s.Token("test@example.com", testutil.DefaultPassword)
+
+	s.Post("/api/v1/users/verify-email").JSON(routes.VerifyEmailRequest{
+		Token: linkToken(t, msg.Text, "/verify-email?token="),
+	}).Do().Status(http.StatusOK)
+	me := testutil.Expect[routes.UserResponse](
+		s.Get("/api/v1/users/me").Token(token).Do(), http.StatusOK)
+	if me.Email != "new-test@example.com" || !me.EmailVerified {
+		t.Errorf("me after verification = %+v", me)
+	}
+}
+
+func TestDeleteMe(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+	_, token := s.NewUser("test@example.com")
+
+	msg := testutil.Expect[routes.MessageResponse](s.Delete("/api/v1/users/me").Token(token).Do(), http.StatusOK)
+	if msg.Message != "User deleted successfully" {
+		t.Errorf("message = %q", msg.Message)
+	}
+
+	problem := testutil.Expect[middleware.APIError](s.Get("/api/v1/users/me").Do(), http.StatusUnauthorized)
+	if problem.Detail != "Authorization header is required" {
+		t.Errorf("detail = %q", problem.Detail)
+	}
+
+	// The deleted user's token is rejected
+	s.Get("/api/v1/users/me").Token(token).Do().Status(http.StatusUnauthorized)
+}
@@ -2,29 +2,69 @@ package routes
 
 import (
 	"context"
+	"errors"
+	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/httplog/v2"
+	"github.com/wangfenjin/mojito/app"
+	"github.com/wangfenjin/mojito/common"
+	"github.com/wangfenjin/mojito/email"
 	"github.com/wangfenjin/mojito/middleware"
 )
 
 // RegisterUtilRoutes registers all utility related routes
-func RegisterUtilRoutes(r chi.Router) {
+func RegisterUtilRoutes(r chi.Router, a *app.App) {
 	r.Route("/api/v1/utils", func(r chi.Router) {
-		r.Get("/health-check/", middleware.WithHandler(healthCheckHandler))
-		r.Post("/test-email/", middleware.WithHandler(testEmailHandler))
+		r.Method(http.MethodGet, "/health-check/", middleware.WithHandler(healthCheckHandler))
+		r.With(a.RequireAuth()).Method(http.MethodPost, "/test-email/", middleware.WithHandler(testEmailHandler))
 	})
 }
 
-// HealthCheckResponse is the response for the health check
+// HealthCheckResponse is the response for the health check, with the results of the readiness checks
 type HealthCheckResponse struct {
-	Status bool `json:"status"`
+	Status bool          `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
 }
 
-// healthCheckHandler returns the health check response
-func healthCheckHandler(_ context.Context, _ any) (*HealthCheckResponse, error) {
-	return &HealthCheckResponse{Status: true}, nil
+// TestEmailRequest is the request for sending a test email
+type TestEmailRequest struct {
+	EmailTo string `query:"email_to" binding:"required,email"`
+	Locale  string `header:"Accept-Language"`
 }
 
-func testEmailHandler(_ context.Context, _ any) (*MessageResponse, error) {
-	panic("Not implemented: testEmailHandler")
+// healthCheckHandler runs the readiness checks, see /readyz
+// @error 503 service_unavailable
+func healthCheckHandler(ctx context.Context, _ any) (*HealthCheckResponse, error) {
+	probe, err := checkReadiness(ctx, app.From(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &HealthCheckResponse{Status: true, Checks: probe.Checks}, nil
+}
+
+// Send a test email to check the email configuration
+// @summary Test email
+// @tag utils
+// @error 403 auth.superuser_required
+// @error 503 email.disabled
+// @error 502 email.delivery_failed
+func testEmailHandler(ctx context.Context, req TestEmailRequest) (*MessageResponse, error) {
+	claims := ctx.Value("claims").(*common.Claims)
+	if !claims.IsSuperUser {
+		return nil, middleware.NewForbiddenError("only superusers can send test emails").WithCode(ErrCodeSuperuserRequired)
+	}
+
+	err := app.From(ctx).Sender.SendTestEmail(ctx, req.EmailTo, req.Locale)
+	if errors.Is(err, email.ErrDisabled) {
+		return nil, middleware.NewError(http.StatusServiceUnavailable, ErrCodeEmailDisabled, "email delivery is disabled")
+	}
+	if err != nil {
+		httplog.LogEntry(ctx).Error("error sending test email", "error", err)
+		return nil, middleware.NewError(http.StatusBadGateway, ErrCodeEmailDeliveryFailed, "error sending test email")
+	}
+
+	return &MessageResponse{
+		Message: "test email sent",
+	}, nil
 }
@@ -0,0 +1,116 @@
+package routes_test
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/wangfenjin/mojito/models"
+	"github.com/wangfenjin/mojito/openapi"
+	"github.com/wangfenjin/mojito/routes"
+	"github.com/wangfenjin/mojito/testutil"
+)
+
+func TestHealthCheck(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+
+	health := testutil.Expect[routes.HealthCheckResponse](s.Get("/api/v1/utils/health-check/").Do(), http.StatusOK)
+	if !health.Status {
+		t.Error("status = false, want true")
+	}
+}
+
+func TestDocs(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+
+	s.Get("/docs/swagger/").Do().Status(http.StatusOK)
+
+	// Routes are documented before they are called
+	resp := s.Get("/docs/openapi.json").Do()
+	spec := testutil.Expect[openapi.Spec](resp, http.StatusOK)
+	for _, path := range []string{"/items/{id}", "/users/me", "/login/access-token", "/readyz"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("%s isn't documented", path)
+		}
+	}
+	if _, ok := spec.Paths["/test/cleanup"]; ok {
+		t.Error("test routes are documented")
+	}
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("the spec has no ETag")
+	}
+	s.Get("/docs/openapi.json").Header("If-None-Match", etag).Do().Status(http.StatusNotModified)
+}
+
+func TestTestEmail(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+
+	s.Post("/api/v1/utils/test-email/").Query("email_to", "test@example.com").Do().Status(http.StatusUnauthorized)
+
+	admin := s.NewSuperuser("admin@example.com")
+	s.Post("/api/v1/utils/test-email/").Token(admin).Query("email_to", "not-an-email").Do().
+		Status(http.StatusUnprocessableEntity)
+
+	msg := testutil.Expect[routes.MessageResponse](
+		s.Post("/api/v1/utils/test-email/").Token(admin).Query("email_to", "test@example.com").Do(), http.StatusOK)
+	if msg.Message != "test email sent" {
+		t.Errorf("message = %q", msg.Message)
+	}
+	sent := s.LastEmail()
+	if !slices.Contains(sent.To, "test@example.com") {
+		t.Errorf("test email sent to %v", sent.To)
+	}
+}
+
+func TestAdminOutbox(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+
+	s.Get("/api/v1/admin/outbox").Do().Status(http.StatusUnauthorized)
+
+	admin := s.NewSuperuser("admin@example.com")
+	s.SignUp("test@example.com", "password123", "Test User")
+	status := testutil.Expect[routes.OutboxStatusResponse](s.Get("/api/v1/admin/outbox").Token(admin).Do(), http.StatusOK)
+	if status.Dispatcher == nil {
+		t.Fatal("dispatcher status is missing")
+	}
+	if len(status.Counts) != 1 || status.Counts[0].Count != 1 {
+		t.Errorf("counts = %+v, want the pending verification email", status.Counts)
+	}
+	if status.DeadLetters == nil {
+		t.Error("dead_letters is missing")
+	}
+}
+
+func TestAdminDB(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+
+	s.Get("/api/v1/admin/db").Do().Status(http.StatusUnauthorized)
+
+	// The in-memory store has no connection pool to report on
+	admin := s.NewSuperuser("admin@example.com")
+	resp := s.Get("/api/v1/admin/db").Token(admin).Do()
+	if _, ok := s.Store.(interface{ Stats() models.PoolStats }); !ok {
+		resp.Status(http.StatusNotFound)
+		return
+	}
+	stats := testutil.Expect[models.PoolStats](resp, http.StatusOK)
+	if stats.MaxConns != s.App.Config.Database.MaxConns || stats.TotalConns < 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestShutdownRoute(t *testing.T) {
+	s := testutil.New(t, testutil.Options{})
+
+	msg := testutil.Expect[routes.MessageResponse](s.Get("/api/v1/test/shutdown").Do(), http.StatusOK)
+	if msg.Message != "server shutting down" {
+		t.Errorf("message = %q", msg.Message)
+	}
+	select {
+	case <-s.App.Stopping():
+	default:
+		t.Error("shutdown wasn't requested")
+	}
+}
@@ -0,0 +1,164 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/wangfenjin/mojito/middleware"
+)
+
+// Request is an API call being built, send it with Do
+type Request struct {
+	s      *Server
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   io.Reader
+}
+
+// NewRequest starts a request to path, which may include a query string
+func (s *Server) NewRequest(method, path string) *Request {
+	return &Request{
+		s:      s,
+		method: method,
+		path:   path,
+		query:  url.Values{},
+		header: http.Header{},
+	}
+}
+
+// Get starts a GET request
+func (s *Server) Get(path string) *Request { return s.NewRequest(http.MethodGet, path) }
+
+// Post starts a POST request
+func (s *Server) Post(path string) *Request { return s.NewRequest(http.MethodPost, path) }
+
+// Patch starts a PATCH request
+func (s *Server) Patch(path string) *Request { return s.NewRequest(http.MethodPatch, path) }
+
+// Delete starts a DELETE request
+func (s *Server) Delete(path string) *Request { return s.NewRequest(http.MethodDelete, path) }
+
+// Token authenticates the request with a bearer token
+func (r *Request) Token(token string) *Request {
+	return r.Header("Authorization", "Bearer "+token)
+}
+
+// Header sets a request header
+func (r *Request) Header(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// Query adds a query parameter
+func (r *Request) Query(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// JSON sends body encoded as JSON
+func (r *Request) JSON(body any) *Request {
+	r.s.t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		r.s.t.Fatalf("failed to encode request body: %v", err)
+	}
+	r.body = bytes.NewReader(data)
+	return r.Header("Content-Type", "application/json")
+}
+
+// Form sends values as an URL encoded form
+func (r *Request) Form(values url.Values) *Request {
+	r.body = strings.NewReader(values.Encode())
+	return r.Header("Content-Type", "application/x-www-form-urlencoded")
+}
+
+// Do sends the request and reads the whole response
+func (r *Request) Do() *Response {
+	t := r.s.t
+	t.Helper()
+
+	target := r.s.URL + r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(r.path, "?") {
+			sep = "&"
+		}
+		target += sep + r.query.Encode()
+	}
+	req, err := http.NewRequest(r.method, target, r.body)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header = r.header
+
+	resp, err := r.s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", r.method, r.path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: failed to read response: %v", r.method, r.path, err)
+	}
+	return &Response{Response: resp, Body: body, t: t}
+}
+
+// Response is a received response with its body
+type Response struct {
+	*http.Response
+	Body []byte
+
+	t testing.TB
+}
+
+// Status fails the test unless the response has the status code
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+
+	if r.StatusCode != code {
+		r.t.Fatalf("%s %s: status = %d, want %d\n%s",
+			r.Request.Method, r.Request.URL.Path, r.StatusCode, code, r.Body)
+	}
+	return r
+}
+
+// Problem fails the test unless the response is a problem details object with
+// the status and error code, and returns it
+func (r *Response) Problem(status int, code middleware.ErrorCode) middleware.APIError {
+	r.t.Helper()
+
+	r.Status(status)
+	if ct := r.Header.Get("Content-Type"); ct != middleware.ProblemContentType {
+		r.t.Fatalf("%s %s: Content-Type = %q, want %q", r.Request.Method, r.Request.URL.Path, ct, middleware.ProblemContentType)
+	}
+	problem := Decode[middleware.APIError](r)
+	if problem.Code != code {
+		r.t.Fatalf("%s %s: code = %q, want %q (%s)", r.Request.Method, r.Request.URL.Path, problem.Code, code, problem.Detail)
+	}
+	return problem
+}
+
+// Decode decodes the JSON body of r
+func Decode[T any](r *Response) T {
+	r.t.Helper()
+
+	var v T
+	if err := json.Unmarshal(r.Body, &v); err != nil {
+		r.t.Fatalf("%s %s: failed to decode %T: %v\n%s", r.Request.Method, r.Request.URL.Path, v, err, r.Body)
+	}
+	return v
+}
+
+// Expect fails the test unless r has the status code and decodes its JSON body
+func Expect[T any](r *Response, status int) T {
+	r.t.Helper()
+	return Decode[T](r.Status(status))
+}
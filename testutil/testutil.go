@@ -0,0 +1,216 @@
+// Package testutil runs the application inside go test. It builds the same router
+// as cmd/mojito on top of an injectable store, in-memory by default, and offers
+// helpers to create users, get tokens and call the API with typed JSON.
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/go-chi/httplog/v2"
+	"github.com/wangfenjin/mojito/app"
+	"github.com/wangfenjin/mojito/common"
+	"github.com/wangfenjin/mojito/email"
+	"github.com/wangfenjin/mojito/models"
+	"github.com/wangfenjin/mojito/models/gen"
+	"github.com/wangfenjin/mojito/models/memory"
+	"github.com/wangfenjin/mojito/routes"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultPassword is the password of users created by NewUser and NewSuperuser
+const DefaultPassword = "password123"
+
+// Options customize the server created by New
+type Options struct {
+	// Store is the database of the application, a new in-memory store when nil.
+	// Stores shared between tests are reset when the server is created.
+	Store models.Store
+	// Configure changes the configuration before the application is built
+	Configure func(cfg *common.Config)
+}
+
+// Server is the application served by an httptest.Server.
+//
+// Emails are kept by Mailer. The outbox dispatcher isn't started so tests
+// decide when messages go out, see DeliverOutbox.
+type Server struct {
+	*httptest.Server
+	App    *app.App
+	Store  models.Store
+	Mailer *email.MemoryMailer
+
+	t testing.TB
+}
+
+// New starts the application for the test t, it is closed when the test ends
+func New(t testing.TB, opts Options) *Server {
+	t.Helper()
+
+	cfg := loadConfig(t)
+	if opts.Configure != nil {
+		opts.Configure(cfg)
+	}
+	store := opts.Store
+	if store == nil {
+		store = memory.New()
+	}
+
+	// Failed requests are reported by the assertions, keep the output of go test quiet
+	logger := httplog.NewLogger("mojito", httplog.Options{
+		LogLevel: slog.LevelError + 1,
+		Concise:  true,
+	})
+	mailer := email.NewMemoryMailer()
+	a, err := app.Build(cfg, store, mailer, logger.Logger)
+	if err != nil {
+		t.Fatalf("failed to build application: %v", err)
+	}
+
+	s := &Server{
+		Server: httptest.NewServer(routes.NewRouter(a, logger)),
+		App:    a,
+		Store:  store,
+		Mailer: mailer,
+		t:      t,
+	}
+	t.Cleanup(s.Close)
+	if opts.Store != nil {
+		s.Reset()
+	}
+	return s
+}
+
+// loadConfig reads config/config.yaml of this repository and points it at
+// in-memory backends. Passwords are hashed with the minimum cost to keep tests fast.
+func loadConfig(t testing.TB) *common.Config {
+	t.Helper()
+
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatal("failed to locate the testutil package")
+	}
+	cfg, err := common.Load(filepath.Join(filepath.Dir(file), "..", "config", "config.yaml"))
+	if err != nil {
+		t.Fatalf("failed to load configuration: %v", err)
+	}
+
+	cfg.Database.Driver = models.DriverMemory
+	cfg.Email.Enabled = true
+	cfg.Email.Driver = email.DriverMemory
+	cfg.Auth.PasswordHashCost = bcrypt.MinCost
+	return cfg
+}
+
+// Reset deletes all data and forgets sent emails
+func (s *Server) Reset() {
+	s.t.Helper()
+
+	s.Mailer.Reset()
+	if store, ok := s.Store.(interface{ Reset() }); ok {
+		store.Reset()
+		return
+	}
+	err := s.Store.WithTx(context.Background(), func(q gen.Querier) error {
+		if err := q.CleanupItems(context.Background()); err != nil {
+			return err
+		}
+		return q.CleanupUsers(context.Background())
+	})
+	if err != nil {
+		s.t.Fatalf("failed to reset the store: %v", err)
+	}
+}
+
+// DeliverOutbox delivers every due outbox message and returns how many were claimed
+func (s *Server) DeliverOutbox() int {
+	s.t.Helper()
+
+	if s.App.Dispatcher == nil {
+		s.t.Fatal("the outbox is disabled")
+	}
+	total := 0
+	for {
+		n, err := s.App.Dispatcher.DispatchOnce(context.Background())
+		if err != nil {
+			s.t.Fatalf("failed to deliver the outbox: %v", err)
+		}
+		if n == 0 {
+			return total
+		}
+		total += n
+	}
+}
+
+// LastEmail delivers the outbox and returns the most recent email
+func (s *Server) LastEmail() email.Message {
+	s.t.Helper()
+
+	s.DeliverOutbox()
+	msg, ok := s.Mailer.Last()
+	if !ok {
+		s.t.Fatal("no email was sent")
+	}
+	return msg
+}
+
+// SignUp registers a user through the signup endpoint
+func (s *Server) SignUp(email, password, fullName string) routes.UserResponse {
+	s.t.Helper()
+
+	return Expect[routes.UserResponse](s.Post("/api/v1/users/signup").JSON(map[string]string{
+		"email":     email,
+		"password":  password,
+		"full_name": fullName,
+	}).Do(), http.StatusOK)
+}
+
+// CreateSuperuser creates a superuser through the test routes
+func (s *Server) CreateSuperuser(email, password, fullName string) {
+	s.t.Helper()
+
+	s.Post("/api/v1/test/superuser").JSON(routes.CreateSuperUserRequest{
+		Email:    email,
+		Password: password,
+		FullName: fullName,
+	}).Do().Status(http.StatusOK)
+}
+
+// Login signs in with the password grant
+func (s *Server) Login(email, password string) routes.TokenResponse {
+	s.t.Helper()
+
+	return Expect[routes.TokenResponse](s.Post("/api/v1/login/access-token").Form(map[string][]string{
+		"username":   {email},
+		"password":   {password},
+		"grant_type": {"password"},
+	}).Do(), http.StatusOK)
+}
+
+// Token signs in and returns the access token to send as bearer token
+func (s *Server) Token(email, password string) string {
+	s.t.Helper()
+	return s.Login(email, password).AccessToken
+}
+
+// NewUser signs up a user with DefaultPassword and returns it with an access token
+func (s *Server) NewUser(email string) (routes.UserResponse, string) {
+	s.t.Helper()
+
+	user := s.SignUp(email, DefaultPassword, fmt.Sprintf("User %s", email))
+	return user, s.Token(email, DefaultPassword)
+}
+
+// NewSuperuser creates a superuser with DefaultPassword and returns its access token
+func (s *Server) NewSuperuser(email string) string {
+	s.t.Helper()
+
+	s.CreateSuperuser(email, DefaultPassword, "Admin User")
+	return s.Token(email, DefaultPassword)
+}